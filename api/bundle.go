@@ -0,0 +1,33 @@
+package api
+
+import "k8s.io/apimachinery/pkg/runtime/schema"
+
+var (
+	BundleGVK = schema.FromAPIVersionAndKind(Group+"/"+Version, "LinkBundle")
+)
+
+// LinkBundle combines several GrafanaLink templates into a single Explore link with multiple panes i.e. a split view.
+// A patch whose template is the name of the bundle is applied to every template in the bundle so that the panes
+// share the same parameters and time range.
+type LinkBundle struct {
+	APIVersion string   `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string   `json:"kind" yaml:"kind"`
+	Metadata   Metadata `json:"metadata" yaml:"metadata"`
+
+	// Description describes what the bundle shows.
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+
+	// Templates are the templates to combine. Explore displays the panes in the order of their IDs.
+	Templates []BundleTemplate `json:"templates" yaml:"templates"`
+}
+
+// BundleTemplate is a template in a LinkBundle.
+type BundleTemplate struct {
+	// Template is the name of the GrafanaLink. It must be an Explore link.
+	Template string `json:"template" yaml:"template"`
+	// Pane is the ID of the pane in the bundle's link. Defaults to the name of the template. If the template has
+	// more than one pane the IDs of the panes are <Pane>-<ID of the pane in the template>.
+	Pane string `json:"pane,omitempty" yaml:"pane,omitempty"`
+	// Params are the default values of the template's parameters. Params in the patch take precedence.
+	Params map[string]interface{} `json:"params,omitempty" yaml:"params,omitempty"`
+}
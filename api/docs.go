@@ -0,0 +1,9 @@
+package api
+
+import "embed"
+
+// Sources are the Go sources of the API. The JSON schemas for the resources are documented using the doc comments
+// of the types and fields in the sources.
+//
+//go:embed bundle.go links.go meta.go patch.go types.go
+var Sources embed.FS
@@ -12,8 +12,108 @@ type GrafanaLink struct {
 	Kind       string   `json:"kind" yaml:"kind"`
 	Metadata   Metadata `json:"metadata" yaml:"metadata"`
 
+	// Description describes what the template shows; e.g. so that an agent can decide which template to use.
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+
 	// BaseURL is the base URL for links generated from this template
 	BaseURL string `json:"baseURL" yaml:"baseURL"`
-	// Panes is a map from the ID of the pane to the body of the pane
-	Panes Panes `json:"panes" yaml:"panes"`
+	// OrgID is the ID of the Grafana organization the link opens. Defaults to 1.
+	OrgID string `json:"orgId,omitempty" yaml:"orgId,omitempty"`
+	// Kiosk hides Grafana's navigation; "full" hides all of it and "tv" hides the side menu. Empty shows it.
+	Kiosk string `json:"kiosk,omitempty" yaml:"kiosk,omitempty"`
+	// Theme is the theme the link is displayed with; "light" or "dark". Empty uses the user's preference.
+	Theme string `json:"theme,omitempty" yaml:"theme,omitempty"`
+	// Refresh is the auto refresh interval of an Explore link e.g. 30s. Dashboard links use dashboard.refresh.
+	Refresh string `json:"refresh,omitempty" yaml:"refresh,omitempty"`
+	// SchemaVersion is the version of the format of the panes of an Explore link. Defaults to 1.
+	SchemaVersion string `json:"schemaVersion,omitempty" yaml:"schemaVersion,omitempty"`
+	// QueryParams are the other query parameters of the link e.g. parameters used by plugins. They are added to
+	// the link as is.
+	QueryParams map[string][]string `json:"queryParams,omitempty" yaml:"queryParams,omitempty"`
+	// Panes is a map from the ID of the pane to the body of the pane.
+	// Panes is set for Explore links.
+	Panes Panes `json:"panes,omitempty" yaml:"panes,omitempty"`
+	// Dashboard is set for dashboard links (i.e. /d/<uid>/<slug>).
+	// A link is either an Explore link or a dashboard link; Panes and Dashboard shouldn't both be set.
+	Dashboard *Dashboard `json:"dashboard,omitempty" yaml:"dashboard,omitempty"`
+
+	// Timezone is the timezone used to resolve relative times, e.g. to round now/d to the start of the day.
+	// It is an IANA timezone name (e.g. America/Los_Angeles), "utc" or "browser" to use the local timezone.
+	// If empty the timezone in the configuration is used.
+	Timezone string `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+	// WeekStart is the first day of the week used to round relative times to weeks e.g. "monday".
+	// If empty the week start in the configuration is used.
+	WeekStart string `json:"weekStart,omitempty" yaml:"weekStart,omitempty"`
+
+	// Parameters are the named parameters a patch can set using params. Parameters give each template a
+	// stable contract that doesn't depend on the shape of the underlying queries.
+	Parameters []Parameter `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+}
+
+const (
+	// KioskFull hides all of Grafana's navigation.
+	KioskFull = "full"
+	// KioskTV hides the side menu.
+	KioskTV = "tv"
+	// KioskOff is used in patches to turn off the kiosk mode of the template.
+	KioskOff = "off"
+
+	// ThemeLight is Grafana's light theme.
+	ThemeLight = "light"
+	// ThemeDark is Grafana's dark theme.
+	ThemeDark = "dark"
+)
+
+// ParameterType is the type of the value of a parameter.
+type ParameterType string
+
+const (
+	// ParameterTypeString is a string.
+	ParameterTypeString ParameterType = "string"
+	// ParameterTypeEnum is a string which must be one of the values of the parameter.
+	ParameterTypeEnum ParameterType = "enum"
+	// ParameterTypeInt is an integer.
+	ParameterTypeInt ParameterType = "int"
+	// ParameterTypeDuration is a duration using Grafana's units e.g. 5m, 1h or 7d.
+	ParameterTypeDuration ParameterType = "duration"
+)
+
+// Parameter is a named parameter of a GrafanaLink.
+type Parameter struct {
+	// Name is the name the patch uses to set the parameter.
+	Name string `json:"name" yaml:"name"`
+	// Type is the type of the parameter. Defaults to string.
+	Type ParameterType `json:"type,omitempty" yaml:"type,omitempty"`
+	// Description describes the parameter.
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// Default is the value used when the patch doesn't set the parameter. Parameters without a default are required.
+	Default interface{} `json:"default,omitempty" yaml:"default,omitempty"`
+	// Values are the allowed values of an enum.
+	Values []string `json:"values,omitempty" yaml:"values,omitempty"`
+
+	// Path is the dot separated path of the field in the query that is set to the value of the parameter
+	// e.g. builderOptions.table
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	// Pane is the ID of the pane containing the query Path refers to. It can be omitted if there is a single pane.
+	Pane string `json:"pane,omitempty" yaml:"pane,omitempty"`
+	// RefID is the refId of the query Path refers to. It can be omitted if the pane has a single query.
+	RefID string `json:"refId,omitempty" yaml:"refId,omitempty"`
+
+	// Label is the name of a Loki stream label or a Prometheus label. The parameter adds a label matcher for the
+	// label to the selectors of the expr of the query selected by Pane and RefID e.g. {service="<value>"}.
+	Label string `json:"label,omitempty" yaml:"label,omitempty"`
+	// LineFilter adds a line filter matching the value of the parameter after the stream selectors of the expr
+	// of the query selected by Pane and RefID e.g. |= "<value>". LineFilter only applies to Loki queries.
+	LineFilter bool `json:"lineFilter,omitempty" yaml:"lineFilter,omitempty"`
+	// Attribute is the name of a TraceQL attribute e.g. resource.service.name or duration. The parameter adds a
+	// condition on the attribute to the spanset filters of the query of the Tempo query selected by Pane and RefID
+	// e.g. { resource.service.name = "<value>" }.
+	Attribute string `json:"attribute,omitempty" yaml:"attribute,omitempty"`
+	// Operator is the operator of the label matcher (=, !=, =~ or !~; defaults to =), of the line filter
+	// (|=, !=, |~ or !~; defaults to |=) or of the TraceQL condition (=, !=, >, >=, <, <=, =~ or !~; defaults to =).
+	Operator string `json:"operator,omitempty" yaml:"operator,omitempty"`
+
+	// Variable is the name of the dashboard variable that is set to the value of the parameter.
+	// Variable only applies to dashboard links.
+	Variable string `json:"variable,omitempty" yaml:"variable,omitempty"`
 }
@@ -2,7 +2,7 @@ package api
 
 const (
 	Group   = "grafctl.foyle.io"
-	Version = "v1alpha1"
+	Version = "v1alpha2"
 )
 
 // N.B. We need to redefine Metadata and not reuse the version in the K8s libraries
@@ -10,8 +10,8 @@ const (
 
 // Metadata holds an optional name of the project.
 type Metadata struct {
-	Name        string            `yaml:"name,omitempty"`
-	Namespace   string            `yaml:"namespace,omitempty"`
-	Labels      map[string]string `yaml:"labels"`
-	Annotations map[string]string `yaml:"annotations,omitempty"`
+	Name        string            `json:"name,omitempty" yaml:"name,omitempty"`
+	Namespace   string            `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty" yaml:"labels"`
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
 }
@@ -1,5 +1,11 @@
 package api
 
+import "k8s.io/apimachinery/pkg/runtime/schema"
+
+var (
+	PatchGVK = schema.FromAPIVersionAndKind(Group+"/"+Version, "PanePatch")
+)
+
 // PanePatch represents the patch to be applied to one of your pane templates.
 // This corresponds to the YAML that is passed on the command line
 type PanePatch struct {
@@ -7,10 +13,39 @@ type PanePatch struct {
 	Kind       string   `json:"kind" yaml:"kind"`
 	Metadata   Metadata `json:"metadata" yaml:"metadata"`
 
+	// Bases are paths to patch files that are merged, in order, before this patch; e.g. a patch shared by every
+	// environment that this patch overlays. Relative paths are relative to the file containing the patch. Objects are
+	// merged, operations and targets are appended and other fields in this patch override the bases.
+	Bases []string `json:"bases,omitempty" yaml:"bases,omitempty"`
+
 	// Template is the name of the template to apply the patch to
 	Template string `json:"template" yaml:"template"`
-	// Query is a patch to be applied to the first query in the pane.
+	// Pane is the ID of the pane to apply Query to. It can be omitted if the template has a single pane.
+	Pane string `json:"pane,omitempty" yaml:"pane,omitempty"`
+	// RefID is the refId of the query to apply Query to. It can be omitted if the pane has a single query.
+	RefID string `json:"refId,omitempty" yaml:"refId,omitempty"`
+	// Query is a patch to be applied to the query selected by Pane and RefID.
+	// Query only applies to Explore links.
 	Query map[string]interface{} `json:"query,omitempty" yaml:"query,omitempty"`
+	// Targets are patches for additional queries. Use Targets to patch several panes or queries in a split view
+	// with a single patch. Targets are applied after Query.
+	Targets []QueryPatch `json:"targets,omitempty" yaml:"targets,omitempty"`
+	// Panes are patches for the bodies of the panes keyed by the ID of the pane. Use Panes to edit several queries
+	// at once or to add queries to a pane. Panes are applied before Query and Targets.
+	// Panes only applies to Explore links.
+	Panes map[string]map[string]interface{} `json:"panes,omitempty" yaml:"panes,omitempty"`
+	// PatchType is how Panes, Query and Targets are merged into the template; either "merge" (the default) or
+	// "strategic".
+	PatchType PatchType `json:"patchType,omitempty" yaml:"patchType,omitempty"`
+	// Operations are RFC 6902 JSON Patch operations applied to the GrafanaLink after the other patches e.g.
+	// {op: replace, path: /panes/eja/queries/0/rawSql, value: "SELECT 1"}
+	Operations []Operation `json:"operations,omitempty" yaml:"operations,omitempty"`
+	// Params are the values of the parameters declared by the template.
+	Params map[string]interface{} `json:"params,omitempty" yaml:"params,omitempty"`
+	// Variables are the values of the template variables to set on a dashboard link. The keys are the names of
+	// the variables without the "var-" prefix. Variables in the template that aren't in the patch are left unchanged.
+	// Variables only applies to dashboard links.
+	Variables map[string][]string `json:"variables,omitempty" yaml:"variables,omitempty"`
 	// Range is the time range for the query.
 	// Uses the syntax supported by grafana for relative times and units
 	// https://grafana.com/docs/grafana/latest/dashboards/use-dashboards/#time-units-and-relative-ranges
@@ -18,4 +53,63 @@ type PanePatch struct {
 	// FixTime is a flag to indicate whether to fix the time range to absolute time or use relative time
 	// in the link. Default is true.
 	FixTime *bool `json:"fixTime,omitempty" yaml:"fixTime,omitempty"`
+	// Timezone overrides the timezone of the template used to resolve relative times.
+	Timezone string `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+	// WeekStart overrides the first day of the week of the template used to round relative times to weeks.
+	WeekStart string `json:"weekStart,omitempty" yaml:"weekStart,omitempty"`
+
+	// OrgID overrides the Grafana organization the template opens.
+	OrgID string `json:"orgId,omitempty" yaml:"orgId,omitempty"`
+	// Kiosk overrides the kiosk mode of the template; "full", "tv" or "off".
+	Kiosk string `json:"kiosk,omitempty" yaml:"kiosk,omitempty"`
+	// Theme overrides the theme of the template; "light" or "dark".
+	Theme string `json:"theme,omitempty" yaml:"theme,omitempty"`
+	// Refresh overrides the auto refresh interval of the template e.g. 30s.
+	Refresh string `json:"refresh,omitempty" yaml:"refresh,omitempty"`
+	// QueryParams are merged into the query parameters of the template. A parameter with no values is removed.
+	QueryParams map[string][]string `json:"queryParams,omitempty" yaml:"queryParams,omitempty"`
+
+	// Context is the name of the context (Grafana instance) to build the link for. The template is rebased onto the
+	// context's baseURL, orgId and datasources before the patch is applied. Defaults to the current context.
+	Context string `json:"context,omitempty" yaml:"context,omitempty"`
+}
+
+// QueryPatch is a patch to be applied to a single query in a pane.
+type QueryPatch struct {
+	// Pane is the ID of the pane containing the query. It can be omitted if the template has a single pane.
+	Pane string `json:"pane,omitempty" yaml:"pane,omitempty"`
+	// RefID is the refId of the query to patch. It can be omitted if the pane has a single query.
+	RefID string `json:"refId,omitempty" yaml:"refId,omitempty"`
+	// Query is the patch to merge into the query.
+	Query map[string]interface{} `json:"query,omitempty" yaml:"query,omitempty"`
+	// PatchType overrides the PatchType of the PanePatch for this query.
+	PatchType PatchType `json:"patchType,omitempty" yaml:"patchType,omitempty"`
+}
+
+// PatchType is the algorithm used to merge a patch into a template.
+type PatchType string
+
+const (
+	// MergePatchType is an RFC 7386 JSON merge patch. Lists in the patch replace the lists in the template and
+	// null deletes a field.
+	MergePatchType PatchType = "merge"
+	// StrategicPatchType is a strategic merge patch similar to Kubernetes'. Lists of queries are merged by refId,
+	// columns by name and filters by key; other lists are replaced. Null values are ignored; use
+	// {"$patch": "delete"} to delete a field or an item of a list and {"$patch": "replace"} to replace an object
+	// rather than merging it.
+	StrategicPatchType PatchType = "strategic"
+)
+
+// Operation is an RFC 6902 JSON Patch operation.
+// https://datatracker.ietf.org/doc/html/rfc6902
+type Operation struct {
+	// Op is one of add, remove, replace, move, copy or test.
+	Op string `json:"op" yaml:"op"`
+	// Path is a JSON pointer to the location the operation applies to e.g. /panes/eja/queries/0/rawSql
+	Path string `json:"path" yaml:"path"`
+	// From is the location to move or copy from.
+	From string `json:"from,omitempty" yaml:"from,omitempty"`
+	// Value is the value to add, replace or test. Value isn't omitted when empty so that a field can be set to
+	// e.g. "" or 0.
+	Value interface{} `json:"value" yaml:"value,omitempty"`
 }
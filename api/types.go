@@ -2,13 +2,20 @@ package api
 
 import (
 	"encoding/json"
+	"reflect"
 
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
 )
 
+const (
+	builderOptionsField = "builderOptions"
+)
+
 var (
-	queryKnownFields = []string{"refId", "datasource", "editorType", "rawSql", "builderOptions", "pluginVersion", "format", "queryType"}
+	builderOptionsKnownFields = []string{"database", "table", "queryType", "mode", "columns", "meta", "limit", "simplelogQuery", "filters"}
+
+	queryKnownFields = []string{"refId", "datasource", "editorType", "rawSql", "pluginVersion", "format", "queryType", "expr", "editorMode", "maxLines", "legendFormat", "direction", "instant", "range", "interval", "exemplar", "query", "limit", "tableType"}
 )
 
 // N.B. Merging the datastructures requires omitempty tags to be added to the fields
@@ -35,23 +42,92 @@ type Query struct {
 	Datasource Datasource `json:"datasource,omitempty" yaml:"datasource,omitempty"`
 	EditorType string     `json:"editorType,omitempty" yaml:"editorType,omitempty"`
 	RawSQL     string     `json:"rawSql,omitempty" yaml:"rawSql,omitempty"`
-	// TODO(jeremy): BuilderOptions is not a standard field in Grafana. Should we treat it as an AdditionalField?
-	BuilderOptions   BuilderOptions         `json:"builderOptions,omitempty" yaml:"builderOptions,omitempty"`
-	PluginVersion    string                 `json:"pluginVersion,omitempty" yaml:"pluginVersion,omitempty"`
-	Format           int                    `json:"format,omitempty" yaml:"format,omitempty"`
-	QueryType        string                 `json:"queryType,omitempty" yaml:"queryType,omitempty"`
+	// N.B. builderOptions isn't a standard field in Grafana; it is specific to the ClickHouse datasource. It is
+	// stored in AdditionalFields so that fields we don't know about are preserved. Use GetBuilderOptions and
+	// SetBuilderOptions to access it.
+	PluginVersion string `json:"pluginVersion,omitempty" yaml:"pluginVersion,omitempty"`
+	Format        int    `json:"format,omitempty" yaml:"format,omitempty"`
+	QueryType     string `json:"queryType,omitempty" yaml:"queryType,omitempty"`
+
+	// Fields used by the Loki and Prometheus datasources.
+	// https://grafana.com/docs/grafana/latest/datasources/loki/query-editor/
+	// https://grafana.com/docs/grafana/latest/datasources/prometheus/query-editor/
+
+	// Expr is the LogQL or PromQL expression e.g. {service="app"} |= "error" or rate(http_requests_total[5m])
+	Expr string `json:"expr,omitempty" yaml:"expr,omitempty"`
+	// EditorMode is the mode of the query editor; "code" or "builder".
+	EditorMode string `json:"editorMode,omitempty" yaml:"editorMode,omitempty"`
+	// MaxLines is the maximum number of log lines to return.
+	MaxLines int `json:"maxLines,omitempty" yaml:"maxLines,omitempty"`
+	// LegendFormat is the template for the names of the series of metric queries e.g. {{pod}}
+	LegendFormat string `json:"legendFormat,omitempty" yaml:"legendFormat,omitempty"`
+	// Direction is the order log lines are returned in; "backward" (newest first) or "forward".
+	Direction string `json:"direction,omitempty" yaml:"direction,omitempty"`
+	// Instant is true if a Prometheus query is evaluated at a single point in time.
+	Instant bool `json:"instant,omitempty" yaml:"instant,omitempty"`
+	// Range is true if a Prometheus query is evaluated over the time range. A query can be both instant and range.
+	Range bool `json:"range,omitempty" yaml:"range,omitempty"`
+	// Interval is the minimum step of a Prometheus range query e.g. 1m
+	Interval string `json:"interval,omitempty" yaml:"interval,omitempty"`
+	// Exemplar is true to fetch exemplars along with a Prometheus query.
+	Exemplar bool `json:"exemplar,omitempty" yaml:"exemplar,omitempty"`
+
+	// Fields used by the Tempo datasource.
+	// https://grafana.com/docs/grafana/latest/datasources/tempo/query-editor/
+
+	// Query is the TraceQL query or the ID of the trace to look up e.g. { resource.service.name = "app" }
+	Query string `json:"query,omitempty" yaml:"query,omitempty"`
+	// Limit is the maximum number of traces to return.
+	Limit int `json:"limit,omitempty" yaml:"limit,omitempty"`
+	// TableType is how search results are displayed; "traces" or "spans".
+	TableType string `json:"tableType,omitempty" yaml:"tableType,omitempty"`
+
 	AdditionalFields map[string]interface{} `json:"-" yaml:"-"`
 }
 
+const (
+	// LokiDatasourceType is the type of the Loki datasource.
+	LokiDatasourceType = "loki"
+	// PrometheusDatasourceType is the type of the Prometheus datasource.
+	PrometheusDatasourceType = "prometheus"
+	// TempoDatasourceType is the type of the Tempo datasource.
+	TempoDatasourceType = "tempo"
+
+	// TraceQLQueryType is the queryType of a Tempo query using TraceQL. If the query is a trace ID, Grafana looks
+	// up the trace.
+	TraceQLQueryType = "traceql"
+
+	// LokiRangeQueryType is the queryType of a Loki query over a time range.
+	LokiRangeQueryType = "range"
+	// LokiInstantQueryType is the queryType of a Loki query at a single point in time.
+	LokiInstantQueryType = "instant"
+
+	// LokiBackward returns the newest log lines first.
+	LokiBackward = "backward"
+	// LokiForward returns the oldest log lines first.
+	LokiForward = "forward"
+)
+
 type QueryKnownFields struct {
-	RefID          string         `json:"refId,omitempty" yaml:"refId,omitempty"`
-	Datasource     Datasource     `json:"datasource,omitempty" yaml:"datasource,omitempty"`
-	EditorType     string         `json:"editorType,omitempty" yaml:"editorType,omitempty"`
-	RawSQL         string         `json:"rawSql,omitempty" yaml:"rawSql,omitempty"`
-	BuilderOptions BuilderOptions `json:"builderOptions,omitempty" yaml:"builderOptions,omitempty"`
-	PluginVersion  string         `json:"pluginVersion,omitempty" yaml:"pluginVersion,omitempty"`
-	Format         int            `json:"format,omitempty" yaml:"format,omitempty"`
-	QueryType      string         `json:"queryType,omitempty" yaml:"queryType,omitempty"`
+	RefID         string     `json:"refId,omitempty" yaml:"refId,omitempty"`
+	Datasource    Datasource `json:"datasource,omitempty" yaml:"datasource,omitempty"`
+	EditorType    string     `json:"editorType,omitempty" yaml:"editorType,omitempty"`
+	RawSQL        string     `json:"rawSql,omitempty" yaml:"rawSql,omitempty"`
+	PluginVersion string     `json:"pluginVersion,omitempty" yaml:"pluginVersion,omitempty"`
+	Format        int        `json:"format,omitempty" yaml:"format,omitempty"`
+	QueryType     string     `json:"queryType,omitempty" yaml:"queryType,omitempty"`
+	Expr          string     `json:"expr,omitempty" yaml:"expr,omitempty"`
+	EditorMode    string     `json:"editorMode,omitempty" yaml:"editorMode,omitempty"`
+	MaxLines      int        `json:"maxLines,omitempty" yaml:"maxLines,omitempty"`
+	LegendFormat  string     `json:"legendFormat,omitempty" yaml:"legendFormat,omitempty"`
+	Direction     string     `json:"direction,omitempty" yaml:"direction,omitempty"`
+	Instant       bool       `json:"instant,omitempty" yaml:"instant,omitempty"`
+	Range         bool       `json:"range,omitempty" yaml:"range,omitempty"`
+	Interval      string     `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Exemplar      bool       `json:"exemplar,omitempty" yaml:"exemplar,omitempty"`
+	Query         string     `json:"query,omitempty" yaml:"query,omitempty"`
+	Limit         int        `json:"limit,omitempty" yaml:"limit,omitempty"`
+	TableType     string     `json:"tableType,omitempty" yaml:"tableType,omitempty"`
 }
 
 // UnmarshalJSON method custom unmarshal function to deal with additional fields
@@ -96,29 +172,87 @@ func (q *Query) UnmarshalYAML(value *yaml.Node) error {
 }
 
 // MarshalYAML custom marshall function
-func (c *Query) MarshalYAML() ([]byte, error) {
+func (c Query) MarshalYAML() (interface{}, error) {
 	// Create a map to hold all fields
 	// Need to keep this in sync with the fields
-	data := map[string]interface{}{
-		"refId":          c.RefID,
-		"datasource":     c.Datasource,
-		"editorType":     c.EditorType,
-		"rawSql":         c.RawSQL,
-		"builderOptions": c.BuilderOptions,
-		"pluginVersion":  c.PluginVersion,
-		"format":         c.Format,
-		"queryType":      c.QueryType,
-	}
+	// Fields with zero values are omitted to match the omitempty tags.
+	data := map[string]interface{}{}
+	setIfNotZero(data, "refId", c.RefID)
+	setIfNotZero(data, "datasource", c.Datasource)
+	setIfNotZero(data, "editorType", c.EditorType)
+	setIfNotZero(data, "rawSql", c.RawSQL)
+	setIfNotZero(data, "pluginVersion", c.PluginVersion)
+	setIfNotZero(data, "format", c.Format)
+	setIfNotZero(data, "queryType", c.QueryType)
+	setIfNotZero(data, "expr", c.Expr)
+	setIfNotZero(data, "editorMode", c.EditorMode)
+	setIfNotZero(data, "maxLines", c.MaxLines)
+	setIfNotZero(data, "legendFormat", c.LegendFormat)
+	setIfNotZero(data, "direction", c.Direction)
+	setIfNotZero(data, "instant", c.Instant)
+	setIfNotZero(data, "range", c.Range)
+	setIfNotZero(data, "interval", c.Interval)
+	setIfNotZero(data, "exemplar", c.Exemplar)
+	setIfNotZero(data, "query", c.Query)
+	setIfNotZero(data, "limit", c.Limit)
+	setIfNotZero(data, "tableType", c.TableType)
 
 	// Add all additional fields to the map
 	for key, value := range c.AdditionalFields {
 		data[key] = value
 	}
 
-	// Marshal the combined map to JSON
-	return yaml.Marshal(data)
+	if opts, ok := c.AdditionalFields[builderOptionsField].(map[string]interface{}); ok {
+		omitted, err := omitZeroBuilderOptions(opts)
+		if err != nil {
+			return nil, err
+		}
+		data[builderOptionsField] = omitted
+	}
+
+	return data, nil
 }
 
+// omitZeroBuilderOptions returns a copy of the raw builderOptions without the fields of BuilderOptions that have
+// zero values e.g. meta: {otelEnabled: false}; this matches the omitempty tags of BuilderOptions. Fields that aren't
+// in BuilderOptions are kept as is.
+func omitZeroBuilderOptions(opts map[string]interface{}) (map[string]interface{}, error) {
+	b, err := yaml.Marshal(opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to marshal builderOptions")
+	}
+	typed := BuilderOptions{}
+	if err := yaml.Unmarshal(b, &typed); err != nil {
+		return nil, errors.Wrapf(err, "Failed to unmarshal builderOptions")
+	}
+	b, err = yaml.Marshal(typed)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to marshal builderOptions")
+	}
+	nonZero := map[string]interface{}{}
+	if err := yaml.Unmarshal(b, &nonZero); err != nil {
+		return nil, errors.Wrapf(err, "Failed to unmarshal builderOptions")
+	}
+
+	out := make(map[string]interface{}, len(opts))
+	for k, v := range opts {
+		if _, ok := nonZero[k]; !ok && isKnownField(builderOptionsKnownFields, k) {
+			continue
+		}
+		out[k] = v
+	}
+	return out, nil
+}
+
+// setIfNotZero sets the key in data if value isn't the zero value of its type.
+func setIfNotZero(data map[string]interface{}, key string, value interface{}) {
+	if reflect.ValueOf(value).IsZero() {
+		return
+	}
+	data[key] = value
+}
+
+// MarshalJSON custom marshal function so that AdditionalFields are included.
 func (c *Query) MarshalJSON() ([]byte, error) {
 	yData, err := yaml.Marshal(c)
 	if err != nil {
@@ -133,14 +267,71 @@ func (c *Query) MarshalJSON() ([]byte, error) {
 	return json.Marshal(m)
 }
 
+// GetBuilderOptions returns the builderOptions of a ClickHouse query. Fields of builderOptions that aren't in
+// BuilderOptions are ignored.
+func (c *Query) GetBuilderOptions() (BuilderOptions, error) {
+	opts := BuilderOptions{}
+	value, ok := c.AdditionalFields[builderOptionsField]
+	if !ok || value == nil {
+		return opts, nil
+	}
+	b, err := yaml.Marshal(value)
+	if err != nil {
+		return opts, errors.Wrapf(err, "Failed to marshal builderOptions")
+	}
+	if err := yaml.Unmarshal(b, &opts); err != nil {
+		return opts, errors.Wrapf(err, "Failed to unmarshal builderOptions")
+	}
+	return opts, nil
+}
+
+// SetBuilderOptions sets the builderOptions of a ClickHouse query. Fields of the query's builderOptions that
+// aren't in BuilderOptions are preserved.
+func (c *Query) SetBuilderOptions(opts BuilderOptions) error {
+	b, err := yaml.Marshal(opts)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to marshal builderOptions")
+	}
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal(b, &values); err != nil {
+		return errors.Wrapf(err, "Failed to unmarshal builderOptions")
+	}
+
+	if existing, ok := c.AdditionalFields[builderOptionsField].(map[string]interface{}); ok {
+		for k, v := range existing {
+			if !isKnownField(builderOptionsKnownFields, k) {
+				values[k] = v
+			}
+		}
+	}
+
+	if c.AdditionalFields == nil {
+		c.AdditionalFields = map[string]interface{}{}
+	}
+	if len(values) == 0 {
+		delete(c.AdditionalFields, builderOptionsField)
+		return nil
+	}
+	c.AdditionalFields[builderOptionsField] = values
+	return nil
+}
+
+func isKnownField(fields []string, name string) bool {
+	for _, f := range fields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
 type Datasource struct {
 	Type string `json:"type,omitempty" yaml:"type,omitempty"`
 	UID  string `json:"uid,omitempty" yaml:"uid,omitempty"`
 }
 
-// BuilderOptions is the options for the builderOptions panel.
-// TODO(jeremy): Should we add support for additionalFields as in Query with custom unmarshal and marshal functions
-// So that we properly handle additional fields that could be added later?
+// BuilderOptions are the options of the query builder of the ClickHouse datasource. They are stored in the
+// builderOptions field of the AdditionalFields of a Query.
 type BuilderOptions struct {
 	Database       string   `json:"database,omitempty" yaml:"database,omitempty"`
 	Table          string   `json:"table,omitempty" yaml:"table,omitempty"`
@@ -150,6 +341,18 @@ type BuilderOptions struct {
 	Meta           Meta     `json:"meta,omitempty" yaml:"meta,omitempty"`
 	Limit          int      `json:"limit,omitempty" yaml:"limit,omitempty"`
 	SimplelogQuery string   `json:"simplelogQuery,omitempty" yaml:"simplelogQuery,omitempty"`
+	Filters        []Filter `json:"filters,omitempty" yaml:"filters,omitempty"`
+}
+
+// Filter is a filter in the query builder e.g. service = 'app'.
+type Filter struct {
+	Key        string      `json:"key,omitempty" yaml:"key,omitempty"`
+	Type       string      `json:"type,omitempty" yaml:"type,omitempty"`
+	FilterType string      `json:"filterType,omitempty" yaml:"filterType,omitempty"`
+	Condition  string      `json:"condition,omitempty" yaml:"condition,omitempty"`
+	Operator   string      `json:"operator,omitempty" yaml:"operator,omitempty"`
+	Value      interface{} `json:"value,omitempty" yaml:"value,omitempty"`
+	Label      string      `json:"label,omitempty" yaml:"label,omitempty"`
 }
 
 type Column struct {
@@ -166,6 +369,25 @@ type TimeRange struct {
 	To   string `json:"to,omitempty" yaml:"to,omitempty"`
 }
 
+// Dashboard represents the state encoded in a link to a dashboard.
+// https://grafana.com/docs/grafana/latest/dashboards/build-dashboards/create-dashboard-url-variables/
+type Dashboard struct {
+	// UID is the UID of the dashboard.
+	UID string `json:"uid" yaml:"uid"`
+	// Slug is the human-readable part of the dashboard path. Grafana ignores it when resolving the dashboard.
+	Slug string `json:"slug,omitempty" yaml:"slug,omitempty"`
+	// Variables maps the names of template variables (without the "var-" prefix) to their values.
+	// A variable can have multiple values if it is a multi-value variable.
+	Variables map[string][]string `json:"variables,omitempty" yaml:"variables,omitempty"`
+	// ViewPanel is the ID of a panel to view in isolation.
+	ViewPanel string    `json:"viewPanel,omitempty" yaml:"viewPanel,omitempty"`
+	Range     TimeRange `json:"range,omitempty" yaml:"range,omitempty"`
+	// Refresh is the auto refresh interval, e.g. "30s".
+	Refresh string `json:"refresh,omitempty" yaml:"refresh,omitempty"`
+	// Timezone is the timezone the dashboard displays times in.
+	Timezone string `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+}
+
 type PanelsState struct {
 	Logs LogsState `json:"logs,omitempty" yaml:"logs,omitempty"`
 }
@@ -22,24 +22,25 @@ var expected = Panes{
 				},
 				EditorType: "simplelog",
 				RawSQL:     "SELECT Timestamp as \"timestamp\", Body as \"body\", SeverityText as \"level\" FROM \"views\".\"logs\" LIMIT 1000 --- cluster:prod AND service:foyle",
-				BuilderOptions: BuilderOptions{
-					Database:  "views",
-					Table:     "logs",
-					QueryType: "logs",
-					Mode:      "list",
-					Columns: []Column{
-						{Name: "Timestamp", Hint: "time"},
-						{Name: "SeverityText", Hint: "log_level"},
-						{Name: "Body", Hint: "log_message"},
+				AdditionalFields: map[string]any{
+					"builderOptions": map[string]any{
+						"database":  "views",
+						"table":     "logs",
+						"queryType": "logs",
+						"mode":      "list",
+						"columns": []any{
+							map[string]any{"name": "Timestamp", "hint": "time"},
+							map[string]any{"name": "SeverityText", "hint": "log_level"},
+							map[string]any{"name": "Body", "hint": "log_message"},
+						},
+						"meta":           map[string]any{"otelEnabled": false},
+						"simplelogQuery": "cluster:prod AND service:foyle",
+						"limit":          1000,
 					},
-					Meta:           Meta{OtelEnabled: false},
-					SimplelogQuery: "cluster:prod AND service:foyle",
-					Limit:          1000,
 				},
-				AdditionalFields: map[string]any{},
-				PluginVersion:    "4.5.0",
-				Format:           2,
-				QueryType:        "logs",
+				PluginVersion: "4.5.0",
+				Format:        2,
+				QueryType:     "logs",
 			},
 		},
 		Range: TimeRange{
@@ -138,3 +139,195 @@ func Test_QueryUnmarshalYaml(t *testing.T) {
 		})
 	}
 }
+
+func Test_QueryMarshalJSON(t *testing.T) {
+	type testCase struct {
+		Name     string
+		Input    Query
+		Expected string
+	}
+
+	cases := []testCase{
+		{
+			Name: "additionalfields",
+			Input: Query{
+				RefID: "A",
+				AdditionalFields: map[string]interface{}{
+					"customarg": "customvalue",
+				},
+			},
+			Expected: `{"customarg":"customvalue","refId":"A"}`,
+		},
+		{
+			Name: "loki",
+			Input: Query{
+				RefID: "A",
+				Datasource: Datasource{
+					Type: "loki",
+					UID:  "lokiuid",
+				},
+				EditorMode:   "code",
+				Expr:         `{service="app"} |= "error"`,
+				QueryType:    LokiRangeQueryType,
+				MaxLines:     500,
+				LegendFormat: "{{pod}}",
+				Direction:    LokiBackward,
+				AdditionalFields: map[string]interface{}{
+					"customarg": "customvalue",
+				},
+			},
+			Expected: `{"customarg":"customvalue","datasource":{"type":"loki","uid":"lokiuid"},"direction":"backward","editorMode":"code","expr":"{service=\"app\"} |= \"error\"","legendFormat":"{{pod}}","maxLines":500,"queryType":"range","refId":"A"}`,
+		},
+		{
+			Name: "prometheus",
+			Input: Query{
+				RefID: "A",
+				Datasource: Datasource{
+					Type: PrometheusDatasourceType,
+					UID:  "promuid",
+				},
+				Expr:             `sum(rate(http_requests_total{job="api"}[5m])) by (code)`,
+				Range:            true,
+				Interval:         "1m",
+				Exemplar:         true,
+				LegendFormat:     "{{code}}",
+				AdditionalFields: map[string]interface{}{},
+			},
+			Expected: `{"datasource":{"type":"prometheus","uid":"promuid"},"exemplar":true,"expr":"sum(rate(http_requests_total{job=\"api\"}[5m])) by (code)","interval":"1m","legendFormat":"{{code}}","range":true,"refId":"A"}`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			actual, err := json.Marshal([]Query{c.Input})
+			if err != nil {
+				t.Fatalf("Failed to marshal: %v", err)
+			}
+			if string(actual) != "["+c.Expected+"]" {
+				t.Errorf("Got %v;\n Want %v", string(actual), "["+c.Expected+"]")
+			}
+
+			y, err := yaml.Marshal(c.Input)
+			if err != nil {
+				t.Fatalf("Failed to marshal: %v", err)
+			}
+			roundTrip := &Query{}
+			if err := yaml.Unmarshal(y, roundTrip); err != nil {
+				t.Fatalf("Failed to unmarshal: %v", err)
+			}
+			if d := cmp.Diff(c.Input, *roundTrip); d != "" {
+				t.Errorf("Unexpected diff after round trip:\n%+v", d)
+			}
+		})
+	}
+}
+
+func Test_QueryMarshalJSONBuilderOptions(t *testing.T) {
+	// Fields of BuilderOptions with zero values are omitted just like the omitempty tags of BuilderOptions; fields
+	// BuilderOptions doesn't know about are kept even if they are zero.
+	q := Query{
+		RefID: "A",
+		AdditionalFields: map[string]interface{}{
+			"builderOptions": map[string]interface{}{
+				"table":   "logs",
+				"limit":   0,
+				"meta":    map[string]interface{}{"otelEnabled": false},
+				"orderBy": []interface{}{},
+			},
+		},
+	}
+
+	actual, err := json.Marshal(&q)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	expected := `{"builderOptions":{"orderBy":[],"table":"logs"},"refId":"A"}`
+	if string(actual) != expected {
+		t.Errorf("Got %v;\n Want %v", string(actual), expected)
+	}
+
+	if _, ok := q.AdditionalFields["builderOptions"].(map[string]interface{})["meta"]; !ok {
+		t.Errorf("Marshaling the query modified its builderOptions")
+	}
+}
+
+func Test_LokiQueryRoundTrip(t *testing.T) {
+	// This is the JSON of a query in a link to Explore with the Loki datasource.
+	input := `{"refId":"A","datasource":{"type":"loki","uid":"lokiuid"},"editorMode":"builder","expr":"{service=\"app\"} |= \"error\"","queryType":"range","maxLines":1000,"direction":"forward","hide":false}`
+
+	expected := Query{
+		RefID: "A",
+		Datasource: Datasource{
+			Type: "loki",
+			UID:  "lokiuid",
+		},
+		EditorMode: "builder",
+		Expr:       `{service="app"} |= "error"`,
+		QueryType:  LokiRangeQueryType,
+		MaxLines:   1000,
+		Direction:  LokiForward,
+		AdditionalFields: map[string]interface{}{
+			"hide": false,
+		},
+	}
+
+	actual := Query{}
+	if err := json.Unmarshal([]byte(input), &actual); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if d := cmp.Diff(expected, actual); d != "" {
+		t.Fatalf("Unexpected diff:\n%+v", d)
+	}
+
+	y, err := yaml.Marshal(actual)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	roundTrip := Query{}
+	if err := yaml.Unmarshal(y, &roundTrip); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if d := cmp.Diff(expected, roundTrip); d != "" {
+		t.Errorf("Unexpected diff after round trip:\n%+v", d)
+	}
+}
+
+func Test_BuilderOptions(t *testing.T) {
+	q := &Query{
+		RefID: "A",
+		AdditionalFields: map[string]any{
+			"builderOptions": map[string]any{
+				"database": "views",
+				"table":    "logs",
+				"orderBy":  []any{map[string]any{"name": "Timestamp", "dir": "DESC"}},
+			},
+		},
+	}
+
+	opts, err := q.GetBuilderOptions()
+	if err != nil {
+		t.Fatalf("Failed to get builderOptions: %v", err)
+	}
+	if d := cmp.Diff(BuilderOptions{Database: "views", Table: "logs"}, opts); d != "" {
+		t.Fatalf("Unexpected diff:\n%v", d)
+	}
+
+	opts.Table = "events"
+	opts.Database = ""
+	opts.Limit = 100
+	if err := q.SetBuilderOptions(opts); err != nil {
+		t.Fatalf("Failed to set builderOptions: %v", err)
+	}
+
+	// Fields that aren't in BuilderOptions are preserved.
+	expected := map[string]any{
+		"builderOptions": map[string]any{
+			"table":   "events",
+			"limit":   100,
+			"orderBy": []any{map[string]any{"name": "Timestamp", "dir": "DESC"}},
+		},
+	}
+	if d := cmp.Diff(expected, q.AdditionalFields); d != "" {
+		t.Fatalf("Unexpected diff:\n%v", d)
+	}
+}
@@ -0,0 +1,116 @@
+package v1alpha1
+
+import (
+	"reflect"
+
+	"github.com/jlewi/grafctl/api"
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultOrgID is the organization v1alpha1 links open.
+	defaultOrgID = "1"
+)
+
+// Upgrade converts a v1alpha1 GrafanaLink to the current version.
+func Upgrade(in *GrafanaLink) (*api.GrafanaLink, error) {
+	out := &api.GrafanaLink{
+		APIVersion:  api.LinkGVK.GroupVersion().String(),
+		Kind:        api.LinkGVK.Kind,
+		Metadata:    in.Metadata,
+		Description: in.Description,
+		BaseURL:     in.BaseURL,
+		Dashboard:   in.Dashboard,
+		Timezone:    in.Timezone,
+		WeekStart:   in.WeekStart,
+		Parameters:  in.Parameters,
+	}
+
+	if in.Panes != nil {
+		out.Panes = make(api.Panes, len(in.Panes))
+		for id, pane := range in.Panes {
+			p := api.PaneBody{
+				Datasource:  pane.Datasource,
+				Range:       pane.Range,
+				PanelsState: pane.PanelsState,
+			}
+			for _, q := range pane.Queries {
+				upgraded, err := upgradeQuery(q)
+				if err != nil {
+					return nil, errors.Wrapf(err, "Failed to convert query %v of pane %v", q.Fields.RefID, id)
+				}
+				p.Queries = append(p.Queries, upgraded)
+			}
+			out.Panes[id] = p
+		}
+	}
+	return out, nil
+}
+
+// Downgrade converts a GrafanaLink to v1alpha1. Links to organizations other than 1 and links that set kiosk, theme,
+// refresh or queryParams can't be downgraded.
+func Downgrade(in *api.GrafanaLink) (*GrafanaLink, error) {
+	if in.OrgID != "" && in.OrgID != defaultOrgID {
+		return nil, errors.Errorf("GrafanaLink %v opens organization %v; %v links can only open organization %v", in.Metadata.Name, in.OrgID, Version, defaultOrgID)
+	}
+	if in.Kiosk != "" || in.Theme != "" || in.Refresh != "" || len(in.QueryParams) > 0 {
+		return nil, errors.Errorf("GrafanaLink %v sets kiosk, theme, refresh or queryParams which %v links don't support", in.Metadata.Name, Version)
+	}
+
+	out := &GrafanaLink{
+		APIVersion:  LinkGVK.GroupVersion().String(),
+		Kind:        LinkGVK.Kind,
+		Metadata:    in.Metadata,
+		Description: in.Description,
+		BaseURL:     in.BaseURL,
+		Dashboard:   in.Dashboard,
+		Timezone:    in.Timezone,
+		WeekStart:   in.WeekStart,
+		Parameters:  in.Parameters,
+	}
+
+	if in.Panes != nil {
+		out.Panes = make(Panes, len(in.Panes))
+		for id, pane := range in.Panes {
+			p := PaneBody{
+				Datasource:  pane.Datasource,
+				Range:       pane.Range,
+				PanelsState: pane.PanelsState,
+			}
+			for _, q := range pane.Queries {
+				opts, err := q.GetBuilderOptions()
+				if err != nil {
+					return nil, errors.Wrapf(err, "Failed to convert query %v of pane %v", q.RefID, id)
+				}
+				fields := q
+				fields.AdditionalFields = copyFields(q.AdditionalFields)
+				p.Queries = append(p.Queries, Query{BuilderOptions: opts, Fields: fields})
+			}
+			out.Panes[id] = p
+		}
+	}
+	return out, nil
+}
+
+// upgradeQuery converts a v1alpha1 query to the current version. The raw builderOptions in the fields of the query
+// are kept as is so that fields api.BuilderOptions doesn't know about aren't lost; BuilderOptions is only used if
+// the query doesn't have raw builderOptions.
+func upgradeQuery(q Query) (api.Query, error) {
+	out := q.Fields
+	out.AdditionalFields = copyFields(q.Fields.AdditionalFields)
+	if _, ok := out.AdditionalFields["builderOptions"]; ok || reflect.ValueOf(q.BuilderOptions).IsZero() {
+		return out, nil
+	}
+	if err := out.SetBuilderOptions(q.BuilderOptions); err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+func copyFields(fields map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,103 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/grafctl/api"
+	"gopkg.in/yaml.v3"
+)
+
+const testLink = `apiVersion: grafctl.foyle.io/v1alpha1
+kind: GrafanaLink
+metadata:
+  name: logs
+baseURL: https://grafana.acme.com
+panes:
+  eja:
+    datasource: someuid
+    queries:
+      - refId: A
+        rawSql: SELECT * FROM logs
+        customarg: somevalue
+        builderOptions:
+          table: logs
+          limit: 100
+          orderBy: timestamp
+`
+
+func Test_Upgrade(t *testing.T) {
+	old := &GrafanaLink{}
+	if err := yaml.Unmarshal([]byte(testLink), old); err != nil {
+		t.Fatalf("Failed to unmarshal link: %v", err)
+	}
+
+	actual, err := Upgrade(old)
+	if err != nil {
+		t.Fatalf("Failed to upgrade link: %v", err)
+	}
+
+	// orderBy isn't a field of api.BuilderOptions but it is preserved.
+	expected := &api.GrafanaLink{
+		APIVersion: "grafctl.foyle.io/v1alpha2",
+		Kind:       "GrafanaLink",
+		Metadata:   api.Metadata{Name: "logs"},
+		BaseURL:    "https://grafana.acme.com",
+		Panes: api.Panes{
+			"eja": api.PaneBody{
+				Datasource: "someuid",
+				Queries: []api.Query{
+					{
+						RefID:  "A",
+						RawSQL: "SELECT * FROM logs",
+						AdditionalFields: map[string]interface{}{
+							"customarg": "somevalue",
+							"builderOptions": map[string]interface{}{
+								"table":   "logs",
+								"limit":   100,
+								"orderBy": "timestamp",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if d := cmp.Diff(expected, actual); d != "" {
+		t.Fatalf("Unexpected diff:\n%v", d)
+	}
+
+	// Downgrading the upgraded link returns the original link.
+	downgraded, err := Downgrade(actual)
+	if err != nil {
+		t.Fatalf("Failed to downgrade link: %v", err)
+	}
+	if d := cmp.Diff(old, downgraded); d != "" {
+		t.Fatalf("Unexpected diff after round trip:\n%v", d)
+	}
+}
+
+func Test_DowngradeUnsupported(t *testing.T) {
+	type testCase struct {
+		name      string
+		link      api.GrafanaLink
+		expectErr bool
+	}
+
+	cases := []testCase{
+		{name: "default", link: api.GrafanaLink{}},
+		{name: "org-1", link: api.GrafanaLink{OrgID: "1"}},
+		{name: "org-2", link: api.GrafanaLink{OrgID: "2"}, expectErr: true},
+		{name: "kiosk", link: api.GrafanaLink{Kiosk: api.KioskTV}, expectErr: true},
+		{name: "query-params", link: api.GrafanaLink{QueryParams: map[string][]string{"foo": {"bar"}}}, expectErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := Downgrade(&c.link)
+			if c.expectErr != (err != nil) {
+				t.Fatalf("Expected error %v but got %v", c.expectErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// Package v1alpha1 contains the v1alpha1 version of the grafctl.foyle.io API and the functions to convert
+// resources between v1alpha1 and the current version in the api package.
+//
+// Only GrafanaLink changed between the versions. LinkBundle and PanePatch have the same shape in both versions.
+package v1alpha1
+
+import (
+	"github.com/jlewi/grafctl/api"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	Version = "v1alpha1"
+)
+
+var (
+	LinkGVK = schema.FromAPIVersionAndKind(api.Group+"/"+Version, "GrafanaLink")
+)
+
+// GrafanaLink is the v1alpha1 version of api.GrafanaLink. Links always open organization 1 and the builderOptions
+// of queries are typed.
+type GrafanaLink struct {
+	APIVersion string       `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string       `json:"kind" yaml:"kind"`
+	Metadata   api.Metadata `json:"metadata" yaml:"metadata"`
+
+	Description string         `json:"description,omitempty" yaml:"description,omitempty"`
+	BaseURL     string         `json:"baseURL" yaml:"baseURL"`
+	Panes       Panes          `json:"panes,omitempty" yaml:"panes,omitempty"`
+	Dashboard   *api.Dashboard `json:"dashboard,omitempty" yaml:"dashboard,omitempty"`
+	Timezone    string         `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+	WeekStart   string         `json:"weekStart,omitempty" yaml:"weekStart,omitempty"`
+
+	Parameters []api.Parameter `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+}
+
+// Panes is a map from the ID of the pane to the body of the pane.
+type Panes map[string]PaneBody
+
+// PaneBody is the v1alpha1 version of api.PaneBody.
+type PaneBody struct {
+	Datasource  string          `json:"datasource,omitempty" yaml:"datasource,omitempty"`
+	Queries     []Query         `json:"queries,omitempty" yaml:"queries,omitempty"`
+	Range       api.TimeRange   `json:"range,omitempty" yaml:"range,omitempty"`
+	PanelsState api.PanelsState `json:"panelsState,omitempty" yaml:"panelsState,omitempty"`
+}
+
+// Query is the v1alpha1 version of api.Query. BuilderOptions is a typed field; the raw builderOptions are also kept
+// in Fields.AdditionalFields so that fields of builderOptions that aren't in api.BuilderOptions are preserved when the
+// query is upgraded.
+type Query struct {
+	BuilderOptions api.BuilderOptions
+	// Fields are the other fields of the query.
+	Fields api.Query
+}
+
+// UnmarshalYAML decodes the query. builderOptions is decoded into BuilderOptions and all the fields, including the
+// raw builderOptions, into Fields.
+func (q *Query) UnmarshalYAML(value *yaml.Node) error {
+	if err := value.Decode(&q.Fields); err != nil {
+		return err
+	}
+	opts, err := q.Fields.GetBuilderOptions()
+	if err != nil {
+		return err
+	}
+	q.BuilderOptions = opts
+	return nil
+}
+
+// MarshalYAML encodes the query as a single object.
+func (q Query) MarshalYAML() (interface{}, error) {
+	fields, err := upgradeQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	return fields.MarshalYAML()
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"text/tabwriter"
 
 	"github.com/jlewi/grafctl/pkg/config"
 	"github.com/pkg/errors"
@@ -19,6 +20,9 @@ func NewConfigCmd() *cobra.Command {
 
 	cmd.AddCommand(NewGetConfigCmd())
 	cmd.AddCommand(NewSetConfigCmd())
+	cmd.AddCommand(NewGetContextsCmd())
+	cmd.AddCommand(NewUseContextCmd())
+	cmd.AddCommand(NewSetContextCmd())
 	return cmd
 }
 
@@ -88,3 +92,139 @@ func NewGetConfigCmd() *cobra.Command {
 
 	return cmd
 }
+
+// NewGetContextsCmd lists the contexts in the configuration
+func NewGetContextsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get-contexts",
+		Short: "List the contexts (Grafana instances) in the configuration",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				if err := config.InitViper(cmd); err != nil {
+					return err
+				}
+				fConfig := config.GetConfig()
+
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "CURRENT\tNAME\tBASEURL\tORGID")
+				for _, c := range fConfig.Contexts {
+					current := ""
+					if c.Name == fConfig.CurrentContext {
+						current = "*"
+					}
+					fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", current, c.Name, c.Grafana.BaseURL, c.OrgID)
+				}
+				return w.Flush()
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to get contexts;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	return cmd
+}
+
+// NewUseContextCmd sets the current context
+func NewUseContextCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "use-context <name>",
+		Short: "Set the current context",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				v := viper.GetViper()
+
+				if err := config.InitViperInstance(v, cmd); err != nil {
+					return err
+				}
+
+				fConfig, err := config.UpdateViperConfig(v, "currentContext="+args[0])
+				if err != nil {
+					return errors.Wrap(err, "Failed to update configuration")
+				}
+
+				file := fConfig.GetConfigFile()
+				if file == "" {
+					return errors.New("Failed to get configuration file")
+				}
+				if err := fConfig.Write(file); err != nil {
+					return err
+				}
+				fmt.Printf("Switched to context %v\n", args[0])
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to set context;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	return cmd
+}
+
+// NewSetContextCmd adds a context to the configuration or updates an existing one
+func NewSetContextCmd() *cobra.Command {
+	var baseURL string
+	var orgID string
+	var token string
+	var username string
+	var datasources map[string]string
+	cmd := &cobra.Command{
+		Use:   "set-context <name>",
+		Short: "Add a context (Grafana instance) to the configuration or update an existing one",
+		Long: `Add a context (Grafana instance) to the configuration or update an existing one.
+
+Only the flags that are set are changed when updating a context. --datasource maps a datasource type to the UID of
+the default datasource of that type in the instance e.g. --datasource loki=P8E80F9AEF21F6940. Links built with the
+context use its base URL and organization and queries of that type are switched to the default datasource.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				v := viper.GetViper()
+
+				if err := config.InitViperInstance(v, cmd); err != nil {
+					return err
+				}
+
+				fConfig, err := config.UpdateViperContext(v, config.Context{
+					Name: args[0],
+					Grafana: config.Grafana{
+						BaseURL: baseURL,
+						Auth: config.GrafanaAuth{
+							Token:    token,
+							Username: username,
+						},
+					},
+					OrgID:       orgID,
+					Datasources: datasources,
+				})
+				if err != nil {
+					return errors.Wrap(err, "Failed to update configuration")
+				}
+
+				file := fConfig.GetConfigFile()
+				if file == "" {
+					return errors.New("Failed to get configuration file")
+				}
+				return fConfig.Write(file)
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to set context;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&baseURL, config.BaseURLFlagName, "", "", "The URL of the Grafana instance e.g. https://grafana.acme.com")
+	cmd.Flags().StringVarP(&orgID, "org-id", "", "", "The organization links open")
+	cmd.Flags().StringVarP(&token, "token", "", "", "A service account token for the Grafana API. To keep it out of the config file use the environment variable GRAFCTL_CONTEXT_<NAME>_AUTH_TOKEN instead")
+	cmd.Flags().StringVarP(&username, "username", "", "", "The username for basic auth")
+	cmd.Flags().StringToStringVarP(&datasources, "datasource", "", nil, "The default datasource of a type; <TYPE>=<UID>. Can be repeated")
+	return cmd
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-logr/zapr"
+	"github.com/jlewi/grafctl/pkg/application"
+	"github.com/jlewi/grafctl/pkg/grafana"
+	"github.com/jlewi/grafctl/pkg/version"
+	"github.com/jlewi/monogo/helpers"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// NewImportCmd creates a command to import GrafanaLink templates from the panels of a dashboard.
+func NewImportCmd() *cobra.Command {
+	var dashboardUID string
+	var panelID int
+	var linkFile string
+	var name string
+	var outDir string
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Create GrafanaLink templates from the panels of a dashboard",
+		Long: `Create GrafanaLink templates from the panels of a dashboard. The templates are Explore links that run the
+queries of the panels. If --panel isn't specified a template is created for every panel in the dashboard.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := application.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+
+				version.LogVersion()
+				log := zapr.NewLogger(zap.L())
+
+				client, err := app.GrafanaClient()
+				if err != nil {
+					return err
+				}
+
+				d, err := client.GetDashboard(cmd.Context(), dashboardUID)
+				if err != nil {
+					return err
+				}
+
+				panels := grafana.QueryPanels(d.Dashboard.Panels)
+				if panelID != 0 {
+					panel, ok := grafana.FindPanel(d.Dashboard.Panels, panelID)
+					if !ok {
+						return errors.Errorf("Dashboard %v doesn't have a panel with ID %v", dashboardUID, panelID)
+					}
+					panels = []grafana.Panel{*panel}
+				} else if linkFile != "" || name != "" {
+					return errors.New("--link-file and --name can only be used when importing a single panel with --panel")
+				}
+
+				if outDir == "" {
+					outDir = app.Config.GetConfigDir()
+				}
+
+				for _, panel := range panels {
+					link, err := grafana.PanelToLink(client.BaseURL, d.Dashboard, panel)
+					if err != nil {
+						return err
+					}
+
+					file := linkFile
+					if file == "" {
+						file = filepath.Join(outDir, grafana.PanelLinkName(d.Dashboard, panel)+".yaml")
+					}
+
+					// Use the same naming rules as links parse; the name defaults to the name of the file.
+					link.Metadata.Name = name
+					if link.Metadata.Name == "" {
+						link.Metadata.Name = nameFromFile(file)
+					}
+
+					f, err := os.Create(file)
+					if err != nil {
+						return errors.Wrapf(err, "Error creating file %v", file)
+					}
+					if err := writeLink(f, link); err != nil {
+						helpers.DeferIgnoreError(f.Close)
+						return err
+					}
+					if err := f.Close(); err != nil {
+						return errors.Wrapf(err, "Error closing file %v", file)
+					}
+					log.Info("Imported panel", "panel", panel.ID, "title", panel.Title, "name", link.Metadata.Name, "file", file)
+				}
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Error running request;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&dashboardUID, "dashboard", "d", "", "The UID of the dashboard to import")
+	cmd.Flags().IntVarP(&panelID, "panel", "", 0, "The ID of the panel to import. If not specified all panels with queries are imported.")
+	cmd.Flags().StringVarP(&linkFile, "link-file", "o", "", "File to write the link to when importing a single panel. Defaults to a file in --dir named after the dashboard and panel.")
+	cmd.Flags().StringVarP(&name, "name", "n", "", "Name to give the resource when importing a single panel. Defaults to the name of the file.")
+	cmd.Flags().StringVarP(&outDir, "dir", "", "", "Directory to write the links to. Defaults to the configuration directory.")
+	helpers.IgnoreError(cmd.MarkFlagRequired("dashboard"))
+	return cmd
+}
@@ -25,16 +25,42 @@ func NewExploreCmd() *cobra.Command {
 	}
 	cmd.AddCommand(NewExploreToURL())
 	cmd.AddCommand(NewParseURL())
+	cmd.AddCommand(NewImportCmd())
+	cmd.AddCommand(NewTraceCmd())
 	return cmd
 }
 
 // NewExploreToURL creates a command to turn queries into URLs
 func NewExploreToURL() *cobra.Command {
-	var patchFile string
+	var patchFiles []string
 	var baseURL string
 	var open bool
+	var short bool
+	var output string
+	var concurrency int
+	var fixTime bool
+	var provenance bool
+	overrides := grafana.PatchOverrides{}
 	cmd := &cobra.Command{
-		Use: "build",
+		Use:   "build",
+		Short: "Build links by applying patches to templates",
+		Long: `Build links by applying patches to templates.
+
+The patch file can contain a single patch, several YAML documents or JSONL (one JSON patch per line). Use - to read
+the patches from stdin. When there is more than one patch, or --output is set, the links are built concurrently and
+the name, URL and error of every patch are printed as a Markdown table, JSON or YAML. A patch that fails doesn't stop
+the rest of the batch.
+
+The patch can also be built from flags; e.g.
+
+  grafctl links build --template=logs --param app=foyle --set builderOptions.limit=100 --from=now-1h --to=now
+
+When used with --patch-file the flags override the values in the file; for a batch they override the values of
+every patch. --set takes a dot separated path to a field of the query selected by the patch.
+
+Repeat --patch-file to layer patches; e.g. a patch shared by every environment followed by an overlay for prod.
+Patches can also list the files they overlay in bases. Objects are merged, operations and targets are appended and
+other fields in later patches override earlier ones. Use --provenance to see which file set each field.`,
 		Run: func(cmd *cobra.Command, args []string) {
 			err := func() error {
 				app := application.NewApp()
@@ -47,40 +73,43 @@ func NewExploreToURL() *cobra.Command {
 
 				version.LogVersion()
 
-				configDir := app.Config.GetConfigDir()
-
-				bases, err := grafana.LoadGrafanaLinksInDir(configDir)
-				if err != nil {
-					return errors.Wrapf(err, "Error loading Grafana links from %v", configDir)
+				if cmd.Flags().Changed("fix-time") {
+					overrides.FixTime = &fixTime
 				}
-
-				patch := &api.PanePatch{}
-
-				patchData, err := os.ReadFile(patchFile)
+				entries, err := readPatchesWithOverrides(patchFiles, overrides)
 				if err != nil {
-					return errors.Wrapf(err, "Error reading patch file %v", patchFile)
+					return err
 				}
 
-				if err := yaml.Unmarshal(patchData, patch); err != nil {
-					return errors.Wrapf(err, "Couldn't unmarshal the patch in file %v", patchFile)
+				if len(entries) == 1 && output == "" {
+					if entries[0].Err != nil {
+						return entries[0].Err
+					}
+					if provenance {
+						if err := grafana.WriteProvenance(cmd.ErrOrStderr(), entries[0].Provenance); err != nil {
+							return err
+						}
+					}
+					link, err := applyPatch(app, *entries[0].Patch)
+					if err != nil {
+						return err
+					}
+					if baseURL != "" {
+						link.BaseURL = baseURL
+					}
+					return printLink(cmd, app, link, short, open)
 				}
 
-				patcher := grafana.NewPatcher(grafana.RealClock{})
-				link, err := patcher.ApplyPatch(bases, *patch)
-				if err != nil {
-					return errors.Wrapf(err, "Error applying patch")
+				if open {
+					return errors.New("--open can only be used when building a single link")
 				}
-				u, err := grafana.LinkToURL(*link)
-				if err != nil {
-					return err
+				if provenance {
+					return errors.New("--provenance can only be used when building a single link")
 				}
-				fmt.Printf("Grafana URL:\n%v\n", u)
-				if open {
-					if err := browser.OpenURL(u); err != nil {
-						return errors.Wrapf(err, "Error opening URL %v", u)
-					}
+				if output == "" {
+					output = grafana.OutputMarkdown
 				}
-				return nil
+				return buildBatch(cmd, app, entries, baseURL, short, output, concurrency)
 			}()
 
 			if err != nil {
@@ -90,12 +119,77 @@ func NewExploreToURL() *cobra.Command {
 		},
 	}
 
-	cmd.Flags().StringVarP(&patchFile, "patch-file", "p", "", "A file containing the JSON object containing a map of pane IDs to panes")
-	cmd.Flags().StringVarP(&baseURL, config.BaseURLFlagName, "", "", "The base URL for your grafana URLs.")
+	cmd.Flags().StringArrayVarP(&patchFiles, "patch-file", "p", nil, "A file containing the patches to apply; YAML, multi-document YAML or JSONL. Use - to read from stdin. Can be repeated to merge several patches, in order, into one")
+	cmd.Flags().StringVarP(&overrides.Template, "template", "t", "", "The name of the template to apply the patch to; overrides the template in the patch file")
+	cmd.Flags().StringArrayVarP(&overrides.Set, "set", "", nil, "Set a field of the query; <PATH>=<VALUE> e.g. builderOptions.table=logs. Can be repeated")
+	cmd.Flags().StringArrayVarP(&overrides.Params, "param", "", nil, "Set a parameter of the template; <NAME>=<VALUE>. Can be repeated")
+	cmd.Flags().StringVarP(&overrides.From, "from", "", "", "The start of the time range e.g. now-1h")
+	cmd.Flags().StringVarP(&overrides.To, "to", "", "", "The end of the time range e.g. now")
+	cmd.Flags().BoolVarP(&fixTime, "fix-time", "", true, "Convert relative times to absolute times in the link. Defaults to the fixTime of the patch")
+	cmd.Flags().StringVarP(&baseURL, config.BaseURLFlagName, "", "", "The base URL for your grafana URLs; overrides the baseURL of the template and the context.")
 	cmd.Flags().BoolVarP(&open, "open", "", false, "Open the URL in a browser")
+	cmd.Flags().BoolVarP(&short, "short", "", false, "Create a short link using the Grafana API and print it instead of the full URL")
+	cmd.Flags().StringVarP(&output, "output", "o", "", fmt.Sprintf("The format to print the results of a batch in; one of %v, %v or %v. Defaults to %v when there is more than one patch", grafana.OutputMarkdown, grafana.OutputJSON, grafana.OutputYAML, grafana.OutputMarkdown))
+	cmd.Flags().BoolVarP(&provenance, "provenance", "", false, "Print the file (or flags) that set each field of the patch to stderr")
+	cmd.Flags().IntVarP(&concurrency, "concurrency", "", 8, "The maximum number of links to build at once")
 	return cmd
 }
 
+// buildBatch builds the links for the patches concurrently and prints the results. It returns an error if any of the
+// links couldn't be built but only after all of them have been attempted.
+func buildBatch(cmd *cobra.Command, app *application.App, entries []grafana.PatchEntry, baseURL string, short bool, output string, concurrency int) error {
+	links, bundles, err := loadTemplates(app)
+	if err != nil {
+		return err
+	}
+
+	var client *grafana.Client
+	if short {
+		client, err = app.GrafanaClient()
+		if err != nil {
+			return err
+		}
+	}
+
+	patcher := newPatcher(app)
+	results := grafana.BuildLinks(entries, concurrency, func(patch api.PanePatch) (string, error) {
+		link, err := patcher.ApplyTemplatePatch(links, bundles, patch)
+		if err != nil {
+			return "", err
+		}
+		if baseURL != "" {
+			link.BaseURL = baseURL
+		}
+		u, err := grafana.LinkToURL(*link)
+		if err != nil {
+			return "", err
+		}
+		if client == nil {
+			return u, nil
+		}
+		shortURL, err := client.CreateShortURL(cmd.Context(), u)
+		if err != nil {
+			return "", err
+		}
+		return shortURL.URL, nil
+	})
+
+	if err := grafana.WriteBuildResults(cmd.OutOrStdout(), results, output); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return errors.Errorf("Failed to build %v of %v links", failed, len(results))
+	}
+	return nil
+}
+
 // NewParseURL creates a command to parse URLs
 func NewParseURL() *cobra.Command {
 	var panesFile string
@@ -125,11 +219,7 @@ func NewParseURL() *cobra.Command {
 					defer f.Close()
 
 					if name == "" {
-						// Default to the name of the file
-						filename := filepath.Base(panesFile)
-
-						// Strip the suffix (file extension)
-						name = filename[:len(filename)-len(filepath.Ext(filename))]
+						name = nameFromFile(panesFile)
 					}
 
 					o = f
@@ -137,19 +227,25 @@ func NewParseURL() *cobra.Command {
 					o = os.Stdout
 				}
 
+				if grafana.IsShortURL(logUrl) {
+					client, err := app.GrafanaClient()
+					if err != nil {
+						return errors.Wrapf(err, "Resolving the short link %v requires access to the Grafana API", logUrl)
+					}
+					resolved, err := client.ResolveShortURL(cmd.Context(), logUrl)
+					if err != nil {
+						return err
+					}
+					logUrl = resolved
+				}
+
 				link, err := grafana.URLToLink(logUrl)
 				if err != nil {
 					return errors.Wrapf(err, "Error parsing URL")
 				}
 				link.Metadata.Name = name
 
-				// Pretty print the json of the panes to the file
-				encoder := yaml.NewEncoder(o)
-				encoder.SetIndent(2)
-				if err := encoder.Encode(link); err != nil {
-					return errors.Wrapf(err, "Error writing panes to file")
-				}
-				return nil
+				return writeLink(o, link)
 			}()
 
 			if err != nil {
@@ -161,7 +257,216 @@ func NewParseURL() *cobra.Command {
 
 	cmd.Flags().StringVarP(&panesFile, "link-file", "o", "", "File to write the panes to. If not specified the panes will be written to stdout.")
 	cmd.Flags().StringVarP(&name, "name", "n", "", "Name to give the resource when saving to a file")
-	cmd.Flags().StringVarP(&logUrl, "url", "u", "", "The URL to parse")
+	cmd.Flags().StringVarP(&logUrl, "url", "u", "", "The URL to parse. Short links (/goto/<uid>) are resolved using the Grafana API.")
 	helpers.IgnoreError(cmd.MarkFlagRequired("url"))
 	return cmd
 }
+
+// printLink prints the URL of the link. If short is true a short link is created using the Grafana API.
+// If open is true the URL is opened in a browser.
+func printLink(cmd *cobra.Command, app *application.App, link *api.GrafanaLink, short bool, open bool) error {
+	u, err := grafana.LinkToURL(*link)
+	if err != nil {
+		return err
+	}
+
+	if short {
+		client, err := app.GrafanaClient()
+		if err != nil {
+			return err
+		}
+		shortURL, err := client.CreateShortURL(cmd.Context(), u)
+		if err != nil {
+			return err
+		}
+		u = shortURL.URL
+	}
+	fmt.Printf("Grafana URL:\n%v\n", u)
+	if open {
+		if err := browser.OpenURL(u); err != nil {
+			return errors.Wrapf(err, "Error opening URL %v", u)
+		}
+	}
+	return nil
+}
+
+// nameFromFile returns the default name of a resource saved to the file; the name of the file without the extension.
+func nameFromFile(path string) string {
+	filename := filepath.Base(path)
+
+	// Strip the suffix (file extension)
+	return filename[:len(filename)-len(filepath.Ext(filename))]
+}
+
+// writeLink writes the link to w as YAML.
+func writeLink(w io.Writer, link *api.GrafanaLink) error {
+	// Pretty print the json of the panes to the file
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(link); err != nil {
+		return errors.Wrapf(err, "Error writing panes to file")
+	}
+	return nil
+}
+
+// readPatches reads the patches in the file. If patchFile is - the patches are read from stdin.
+func readPatches(patchFile string) ([]grafana.PatchEntry, error) {
+	if patchFile == "-" {
+		return grafana.ReadPatches(os.Stdin)
+	}
+	f, err := os.Open(patchFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error reading patch file %v", patchFile)
+	}
+	defer f.Close()
+	entries, err := grafana.ReadPatches(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error reading patch file %v", patchFile)
+	}
+	return entries, nil
+}
+
+// readPatchesWithOverrides reads the patches to build and merges their bases and the overrides into them.
+//
+// If there is a single patch file it can contain a batch of patches. If there are several patch files each must
+// contain a single patch and they are merged, in order, into one patch; e.g. a shared patch followed by an overlay
+// for an environment. If there are no patch files a single patch is built from the overrides. The overrides are
+// merged last so they take precedence over the files.
+func readPatchesWithOverrides(patchFiles []string, overrides grafana.PatchOverrides) ([]grafana.PatchEntry, error) {
+	flags := &api.PanePatch{}
+	if err := overrides.Apply(flags); err != nil {
+		return nil, err
+	}
+	flagsLayer := grafana.PatchLayer{Source: "flags", Patch: flags}
+
+	var entries []grafana.PatchEntry
+	var layers [][]grafana.PatchLayer
+	switch len(patchFiles) {
+	case 0:
+		if overrides.Template == "" {
+			return nil, errors.New("Either --patch-file or --template must be specified")
+		}
+		entries = []grafana.PatchEntry{{Index: 0}}
+		layers = [][]grafana.PatchLayer{{}}
+	case 1:
+		var err error
+		entries, err = readPatches(patchFiles[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			return nil, errors.Errorf("There are no patches in %v", patchFiles[0])
+		}
+		layers = make([][]grafana.PatchLayer, len(entries))
+		for i, e := range entries {
+			if e.Err != nil {
+				continue
+			}
+			source := patchSource(patchFiles[0])
+			if len(entries) > 1 {
+				source = fmt.Sprintf("%v (patch %v)", source, i+1)
+			}
+			layers[i], entries[i].Err = grafana.ExpandBases(e.Patch, source, patchDir(patchFiles[0]), nil)
+		}
+	default:
+		// The files share seen so that a base of several of the files, or a base that is also passed with
+		// --patch-file, is only layered once.
+		overlays := []grafana.PatchLayer{}
+		seen := map[string]bool{}
+		for _, f := range patchFiles {
+			fileEntries, err := readPatches(f)
+			if err != nil {
+				return nil, err
+			}
+			if len(fileEntries) != 1 {
+				return nil, errors.Errorf("Patch file %v contains %v patches; when there are several patch files each must contain exactly one patch", f, len(fileEntries))
+			}
+			if fileEntries[0].Err != nil {
+				return nil, errors.Wrapf(fileEntries[0].Err, "Invalid patch in file %v", f)
+			}
+			fileLayers, err := grafana.ExpandBases(fileEntries[0].Patch, patchSource(f), patchDir(f), seen)
+			if err != nil {
+				return nil, err
+			}
+			overlays = append(overlays, fileLayers...)
+		}
+		entries = []grafana.PatchEntry{{Index: 0}}
+		layers = [][]grafana.PatchLayer{overlays}
+	}
+
+	for i := range entries {
+		if entries[i].Err != nil {
+			continue
+		}
+		patch, provenance, err := grafana.MergePatches(append(layers[i], flagsLayer))
+		if err != nil {
+			entries[i].Err = err
+			continue
+		}
+		entries[i].Patch = patch
+		entries[i].Provenance = provenance
+	}
+	return entries, nil
+}
+
+// patchSource is the name of the patch file in the provenance of the fields it sets.
+func patchSource(patchFile string) string {
+	if patchFile == "-" {
+		return "stdin"
+	}
+	return patchFile
+}
+
+// patchDir is the directory the relative paths in the bases of the patches in patchFile are relative to.
+func patchDir(patchFile string) string {
+	if patchFile == "-" {
+		return "."
+	}
+	return filepath.Dir(patchFile)
+}
+
+// readPatchFile reads the PanePatch in the file and merges its bases into it.
+func readPatchFile(patchFile string) (*api.PanePatch, error) {
+	entries, err := readPatchesWithOverrides([]string{patchFile}, grafana.PatchOverrides{})
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) != 1 {
+		return nil, errors.Errorf("Patch file %v contains %v patches; it must contain exactly one patch", patchFile, len(entries))
+	}
+	if entries[0].Err != nil {
+		return nil, errors.Wrapf(entries[0].Err, "Invalid patch in file %v", patchFile)
+	}
+	return entries[0].Patch, nil
+}
+
+// applyPatch applies the patch to the GrafanaLink or LinkBundle in the configuration directory named by the
+// patch's template.
+func applyPatch(app *application.App, patch api.PanePatch) (*api.GrafanaLink, error) {
+	configDir := app.Config.GetConfigDir()
+
+	bases, err := grafana.LoadGrafanaLinksInDir(configDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error loading Grafana links from %v", configDir)
+	}
+	bundles, err := grafana.LoadLinkBundlesInDir(configDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error loading link bundles from %v", configDir)
+	}
+
+	link, err := newPatcher(app).ApplyTemplatePatch(bases, bundles, patch)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error applying patch")
+	}
+	return link, nil
+}
+
+// newPatcher creates a patcher configured with the time settings in the configuration.
+func newPatcher(app *application.App) *grafana.Patcher {
+	patcher := grafana.NewPatcher(grafana.RealClock{})
+	patcher.Timezone = app.Config.Time.Timezone
+	patcher.WeekStart = app.Config.Time.WeekStart
+	patcher.Contexts = app.GrafanaContexts()
+	patcher.Context = app.Config.CurrentContext
+	return patcher
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/go-logr/zapr"
+	"github.com/jlewi/grafctl/pkg/application"
+	"github.com/jlewi/grafctl/pkg/mcp"
+	"github.com/jlewi/grafctl/pkg/version"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// NewMCPCmd creates a command to run a Model Context Protocol server.
+func NewMCPCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "mcp",
+		Short: "Run a Model Context Protocol server on stdin/stdout exposing the templates as tools",
+		Long: `Run a Model Context Protocol (MCP) server using the stdio transport.
+
+Each GrafanaLink and LinkBundle in the config directory is advertised as a tool whose arguments are the template's
+parameters and the time range. Calling a tool builds the link and returns its URL. If the Grafana API is configured
+the tool can also run the queries of the link and return the results.
+
+Logs are written to stderr so they don't interfere with the protocol.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := application.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+				log := zapr.NewLogger(zap.L())
+
+				version.LogVersion()
+
+				var client mcp.QueryClient
+				if c, err := app.GrafanaClient(); err != nil {
+					log.Info("The Grafana API isn't configured; tools won't be able to run queries", "reason", err.Error())
+				} else {
+					client = c
+				}
+
+				s, err := mcp.NewServer(app.Config.GetConfigDir(), newPatcher(app), client)
+				if err != nil {
+					return err
+				}
+				s.Version = version.Version
+
+				ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+				defer stop()
+				return s.Serve(ctx, os.Stdin, os.Stdout)
+			}()
+
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error running request;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	return cmd
+}
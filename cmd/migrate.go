@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jlewi/grafctl/api"
+	"github.com/jlewi/grafctl/pkg/application"
+	"github.com/jlewi/grafctl/pkg/grafana"
+	"github.com/jlewi/monogo/yamlfiles"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// NewMigrateCmd creates a command to convert the resources in the config directory to the current version.
+func NewMigrateCmd() *cobra.Command {
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: fmt.Sprintf("Rewrite the GrafanaLinks and LinkBundles in the config directory using apiVersion %v", api.LinkGVK.GroupVersion().String()),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := application.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+
+				configDir := app.Config.GetConfigDir()
+				files, err := yamlfiles.Find(configDir)
+				if err != nil {
+					return errors.Wrapf(err, "Error finding files in %v", configDir)
+				}
+
+				migrated := 0
+				for _, f := range files {
+					data, err := os.ReadFile(f)
+					if err != nil {
+						return errors.Wrapf(err, "Failed to read file %v", f)
+					}
+					converted, changed, err := grafana.MigrateYAML(data)
+					if err != nil {
+						return errors.Wrapf(err, "Failed to migrate file %v", f)
+					}
+					if !changed {
+						continue
+					}
+					migrated++
+					if dryRun {
+						fmt.Fprintf(cmd.OutOrStdout(), "Would migrate %v\n", f)
+						continue
+					}
+					info, err := os.Stat(f)
+					if err != nil {
+						return errors.Wrapf(err, "Failed to stat file %v", f)
+					}
+					if err := os.WriteFile(f, converted, info.Mode()); err != nil {
+						return errors.Wrapf(err, "Failed to write file %v", f)
+					}
+					fmt.Fprintf(cmd.OutOrStdout(), "Migrated %v\n", f)
+				}
+
+				if migrated == 0 {
+					fmt.Fprintf(cmd.OutOrStdout(), "All resources in %v are already %v\n", configDir, api.LinkGVK.GroupVersion().String())
+				}
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Error running request;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVarP(&dryRun, "dry-run", "", false, "Print the files that would be migrated without changing them")
+	return cmd
+}
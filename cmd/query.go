@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jlewi/grafctl/pkg/application"
+	"github.com/jlewi/grafctl/pkg/grafana"
+	"github.com/jlewi/grafctl/pkg/version"
+	"github.com/jlewi/monogo/helpers"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// NewQueryCmd creates a command to run the queries of a template and print the results.
+func NewQueryCmd() *cobra.Command {
+	var patchFile string
+	var output string
+	cmd := &cobra.Command{
+		Use:   "query",
+		Short: "Apply a patch to a template and run its queries using the Grafana API",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := application.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+
+				version.LogVersion()
+
+				patch, err := readPatchFile(patchFile)
+				if err != nil {
+					return err
+				}
+
+				link, err := applyPatch(app, *patch)
+				if err != nil {
+					return err
+				}
+
+				requests, err := grafana.LinkToQueryRequests(*link)
+				if err != nil {
+					return err
+				}
+
+				client, err := app.GrafanaClient()
+				if err != nil {
+					return err
+				}
+
+				responses := make(map[string]*grafana.QueryResponse, len(requests))
+				for _, request := range requests {
+					resp, err := client.Query(cmd.Context(), request)
+					if err != nil {
+						return err
+					}
+					responses[request.Pane] = resp
+				}
+				if err := grafana.WriteQueryResponses(os.Stdout, responses, output); err != nil {
+					return errors.Wrapf(err, "Error writing query results")
+				}
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Error running request;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&patchFile, "patch-file", "p", "", "A file containing the PanePatch to apply to the template before running its queries")
+	cmd.Flags().StringVarP(&output, "output", "o", grafana.OutputTable, fmt.Sprintf("The format to print the results in; one of %v, %v or %v", grafana.OutputTable, grafana.OutputJSON, grafana.OutputCSV))
+	helpers.IgnoreError(cmd.MarkFlagRequired("patch-file"))
+	return cmd
+}
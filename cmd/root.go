@@ -12,6 +12,7 @@ func NewRootCmd() *cobra.Command {
 	var cfgFile string
 	var level string
 	var jsonLog bool
+	var context string
 	rootCmd := &cobra.Command{
 		Short: config.AppName,
 	}
@@ -19,10 +20,17 @@ func NewRootCmd() *cobra.Command {
 	rootCmd.PersistentFlags().StringVar(&cfgFile, config.ConfigFlagName, "", fmt.Sprintf("config file (default is $HOME/.%s/config.yaml)", config.AppName))
 	rootCmd.PersistentFlags().StringVarP(&level, config.LevelFlagName, "", "info", "The logging level.")
 	rootCmd.PersistentFlags().BoolVarP(&jsonLog, "json-logs", "", false, "Enable json logging.")
+	rootCmd.PersistentFlags().StringVarP(&context, config.ContextFlagName, "", "", "The name of the context (Grafana instance) to use; overrides currentContext in the configuration.")
 
 	rootCmd.AddCommand(NewVersionCmd(os.Stdout))
 	rootCmd.AddCommand(NewConfigCmd())
 	rootCmd.AddCommand(NewExploreCmd())
+	rootCmd.AddCommand(NewQueryCmd())
+	rootCmd.AddCommand(NewValidateCmd())
+	rootCmd.AddCommand(NewSchemaCmd())
+	rootCmd.AddCommand(NewMigrateCmd())
+	rootCmd.AddCommand(NewServeCmd())
+	rootCmd.AddCommand(NewMCPCmd())
 
 	return rootCmd
 }
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jlewi/grafctl/api"
+	"github.com/jlewi/grafctl/pkg/application"
+	"github.com/jlewi/grafctl/pkg/grafana"
+	"github.com/jlewi/grafctl/pkg/schema"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// NewSchemaCmd creates a command to print the JSON schemas of the resources.
+func NewSchemaCmd() *cobra.Command {
+	var template string
+	var outDir string
+	cmd := &cobra.Command{
+		Use:   "schema [KIND]",
+		Short: fmt.Sprintf("Print the JSON schema of a kind of resource (one of %v) or of the patches of a template", schema.Kinds()),
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := application.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+
+				switch {
+				case outDir != "":
+					return writeSchemas(app, outDir)
+				case template != "":
+					s, err := templateSchema(app, template)
+					if err != nil {
+						return err
+					}
+					return printSchema(cmd, s)
+				case len(args) == 1:
+					s, err := schema.ForKind(args[0])
+					if err != nil {
+						return err
+					}
+					return printSchema(cmd, s)
+				}
+				return errors.Errorf("Specify a kind (one of %v), --template or --output-dir", schema.Kinds())
+			}()
+
+			if err != nil {
+				fmt.Printf("Error running request;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&template, "template", "t", "", "Print the schema for patches of the GrafanaLink or LinkBundle with this name")
+	cmd.Flags().StringVarP(&outDir, "output-dir", "o", "", "Write the schemas of all kinds and of the patches of every template to this directory")
+	return cmd
+}
+
+// templateSchema returns the schema for patches of the named template or bundle in the config directory.
+func templateSchema(app *application.App, name string) (*schema.Schema, error) {
+	links, bundles, err := loadTemplates(app)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range bundles {
+		if b.Metadata.Name == name {
+			return schema.ForBundle(b, bundleLinks(b, links))
+		}
+	}
+	for _, l := range links {
+		if l.Metadata.Name == name {
+			return schema.ForTemplate(l)
+		}
+	}
+	return nil, errors.Errorf("There is no template or bundle named %v in %v", name, app.Config.GetConfigDir())
+}
+
+// writeSchemas writes the schemas of the kinds to <kind>.schema.json and the schemas for the patches of each template
+// to patch.<template>.schema.json in dir.
+func writeSchemas(app *application.App, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "Failed to create directory %v", dir)
+	}
+
+	schemas := map[string]*schema.Schema{}
+	for _, kind := range schema.Kinds() {
+		s, err := schema.ForKind(kind)
+		if err != nil {
+			return err
+		}
+		schemas[kind+".schema.json"] = s
+	}
+
+	links, bundles, err := loadTemplates(app)
+	if err != nil {
+		return err
+	}
+	for _, l := range links {
+		s, err := schema.ForTemplate(l)
+		if err != nil {
+			return err
+		}
+		schemas["patch."+l.Metadata.Name+".schema.json"] = s
+	}
+	for _, b := range bundles {
+		s, err := schema.ForBundle(b, bundleLinks(b, links))
+		if err != nil {
+			return err
+		}
+		schemas["patch."+b.Metadata.Name+".schema.json"] = s
+	}
+
+	for name, s := range schemas {
+		b, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return errors.Wrapf(err, "Failed to marshal schema %v", name)
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, append(b, '\n'), 0644); err != nil {
+			return errors.Wrapf(err, "Failed to write schema %v", path)
+		}
+	}
+	fmt.Printf("Wrote %v schemas to %v\n", len(schemas), dir)
+	return nil
+}
+
+func loadTemplates(app *application.App) ([]*api.GrafanaLink, []*api.LinkBundle, error) {
+	configDir := app.Config.GetConfigDir()
+	links, err := grafana.LoadGrafanaLinksInDir(configDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	bundles, err := grafana.LoadLinkBundlesInDir(configDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	return links, bundles, nil
+}
+
+// bundleLinks returns the templates of the bundle.
+func bundleLinks(bundle *api.LinkBundle, links []*api.GrafanaLink) []*api.GrafanaLink {
+	result := make([]*api.GrafanaLink, 0, len(bundle.Templates))
+	for _, t := range bundle.Templates {
+		for _, l := range links {
+			if l.Metadata.Name == t.Template {
+				result = append(result, l)
+			}
+		}
+	}
+	return result
+}
+
+func printSchema(cmd *cobra.Command, s *schema.Schema) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "Failed to marshal schema")
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), string(b))
+	return nil
+}
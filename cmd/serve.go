@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/jlewi/grafctl/pkg/application"
+	"github.com/jlewi/grafctl/pkg/server"
+	"github.com/jlewi/grafctl/pkg/version"
+	"github.com/spf13/cobra"
+)
+
+// NewServeCmd creates a command to serve the API for building and parsing links over HTTP.
+func NewServeCmd() *cobra.Command {
+	var address string
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve an HTTP/JSON API to build, parse and validate links",
+		Long: `Serve an HTTP/JSON API to build, parse and validate links using the templates in the config directory.
+The templates are reloaded when they change.
+
+  GET  /api/v1/templates     List the GrafanaLinks and LinkBundles
+  POST /api/v1/links/build   Apply the PanePatch in the body and return the URL and the GrafanaLink
+  POST /api/v1/links/parse   Convert {"url": "..."} to a GrafanaLink
+  POST /api/v1/validate      Validate the YAML or JSON resources in the body
+  GET  /healthz              Health check`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := application.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+
+				version.LogVersion()
+
+				s, err := server.NewServer(app.Config.GetConfigDir(), newPatcher(app))
+				if err != nil {
+					return err
+				}
+
+				ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+				defer stop()
+				return s.Run(ctx, address)
+			}()
+
+			if err != nil {
+				fmt.Printf("Error running request;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&address, "address", "", "localhost:8080", "The address to listen on")
+	return cmd
+}
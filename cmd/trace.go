@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jlewi/grafctl/api"
+	"github.com/jlewi/grafctl/pkg/application"
+	"github.com/jlewi/grafctl/pkg/config"
+	"github.com/jlewi/grafctl/pkg/grafana"
+	"github.com/jlewi/grafctl/pkg/version"
+	"github.com/jlewi/monogo/helpers"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// NewTraceCmd creates a command to build links to traces.
+func NewTraceCmd() *cobra.Command {
+	var traceID string
+	var template string
+	var datasource string
+	var open bool
+	var short bool
+	cmd := &cobra.Command{
+		Use:   "trace",
+		Short: "Build a link to a trace in Tempo",
+		Long: `Build a link to an Explore view of the trace with the ID.
+
+Use --template to name a GrafanaLink with a query for a Tempo datasource; e.g. a split view of logs and traces.
+Otherwise use --datasource to specify the UID of the Tempo datasource and the link is built from scratch
+using grafana.baseURL in your configuration. If a context is selected its baseURL is used and --datasource
+defaults to the context's tempo datasource.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := application.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+
+				version.LogVersion()
+
+				var bases []*api.GrafanaLink
+				var base *api.GrafanaLink
+				if template != "" {
+					configDir := app.Config.GetConfigDir()
+					links, err := grafana.LoadGrafanaLinksInDir(configDir)
+					if err != nil {
+						return errors.Wrapf(err, "Error loading Grafana links from %v", configDir)
+					}
+					for _, l := range links {
+						if l.Metadata.Name == template {
+							base = l
+							break
+						}
+					}
+					if base == nil {
+						return errors.Errorf("There is no template named %v in %v", template, configDir)
+					}
+					bases = links
+				} else {
+					g, err := app.Config.GetGrafana()
+					if err != nil {
+						return err
+					}
+					ctx, err := app.Config.GetContext(app.Config.CurrentContext)
+					if err != nil {
+						return err
+					}
+					if datasource == "" && ctx != nil {
+						datasource = ctx.Datasources[api.TempoDatasourceType]
+					}
+					if datasource == "" {
+						return errors.New("Either --template or --datasource must be specified")
+					}
+					if g.BaseURL == "" {
+						return errors.Errorf("The base URL of Grafana isn't configured; run %s config set grafana.baseURL=<URL>", config.AppName)
+					}
+					base = grafana.NewTraceLink(g.BaseURL, datasource)
+					bases = []*api.GrafanaLink{base}
+				}
+
+				patch, err := grafana.TracePatch(base, traceID)
+				if err != nil {
+					return err
+				}
+
+				link, err := newPatcher(app).ApplyPatch(bases, *patch)
+				if err != nil {
+					return errors.Wrapf(err, "Error applying patch")
+				}
+				return printLink(cmd, app, link, short, open)
+			}()
+
+			if err != nil {
+				fmt.Printf("Error running request;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&traceID, "id", "", "", "The ID of the trace")
+	cmd.Flags().StringVarP(&template, "template", "t", "", "The name of a GrafanaLink with a query for a Tempo datasource")
+	cmd.Flags().StringVarP(&datasource, "datasource", "", "", "The UID of the Tempo datasource; used if --template isn't specified. Defaults to the tempo datasource of the context")
+	cmd.Flags().BoolVarP(&open, "open", "", false, "Open the URL in a browser")
+	cmd.Flags().BoolVarP(&short, "short", "", false, "Create a short link using the Grafana API and print it instead of the full URL")
+	helpers.IgnoreError(cmd.MarkFlagRequired("id"))
+	return cmd
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jlewi/grafctl/pkg/application"
+	"github.com/jlewi/grafctl/pkg/grafana"
+	"github.com/jlewi/grafctl/pkg/validate"
+	"github.com/jlewi/monogo/yamlfiles"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// NewValidateCmd creates a command to validate links, bundles and patches.
+func NewValidateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate [FILE|DIR...]",
+		Short: "Validate GrafanaLinks, LinkBundles and patches. Defaults to the templates in the config directory.",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := application.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+
+				configDir := app.Config.GetConfigDir()
+				templates, err := grafana.LoadGrafanaLinksInDir(configDir)
+				if err != nil {
+					return err
+				}
+				bundles, err := grafana.LoadLinkBundlesInDir(configDir)
+				if err != nil {
+					return err
+				}
+				v := &validate.Validator{Templates: templates, Bundles: bundles}
+
+				paths := args
+				if len(paths) == 0 {
+					// The config directory contains the config file which isn't a resource.
+					paths = []string{configDir}
+					v.SkipUnknownKinds = true
+				}
+
+				files := make([]string, 0, len(paths))
+				for _, p := range paths {
+					info, err := os.Stat(p)
+					if err != nil {
+						return errors.Wrapf(err, "Failed to stat %v", p)
+					}
+					if !info.IsDir() {
+						files = append(files, p)
+						continue
+					}
+					found, err := yamlfiles.Find(p)
+					if err != nil {
+						return errors.Wrapf(err, "Error finding files in %v", p)
+					}
+					files = append(files, found...)
+				}
+
+				// Validate patches against the templates being validated as well as the installed ones.
+				if len(args) > 0 {
+					for _, f := range files {
+						if err := v.AddTemplates(f); err != nil {
+							return err
+						}
+					}
+				}
+
+				numErrs := 0
+				for _, f := range files {
+					errs, err := v.ValidateFile(f)
+					if err != nil {
+						return err
+					}
+					for _, e := range errs {
+						fmt.Fprintln(cmd.OutOrStdout(), e.Error())
+					}
+					numErrs += len(errs)
+				}
+
+				if numErrs > 0 {
+					return errors.Errorf("Found %v errors in %v files", numErrs, len(files))
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Validated %v files\n", len(files))
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Error running request;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	return cmd
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"os"
+	// Embed the timezone database so IANA timezones can be used on machines without one.
+	_ "time/tzdata"
 
 	"github.com/jlewi/grafctl/cmd"
 )
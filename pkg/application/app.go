@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/jlewi/grafctl/pkg/config"
+	"github.com/jlewi/grafctl/pkg/grafana"
 	"github.com/jlewi/monogo/gcp/logging"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
@@ -72,6 +73,41 @@ func (a *App) SetupLogging() error {
 	return nil
 }
 
+// GrafanaClient creates a client for the Grafana API using the configuration.
+// The client uses the Grafana instance of the current context.
+func (a *App) GrafanaClient() (*grafana.Client, error) {
+	g, err := a.Config.GetGrafana()
+	if err != nil {
+		return nil, err
+	}
+	if g.BaseURL == "" {
+		if a.Config.CurrentContext != "" {
+			return nil, errors.Errorf("The base URL of context %v isn't configured; run %s config set-context %v --%s=<URL>", a.Config.CurrentContext, config.AppName, a.Config.CurrentContext, config.BaseURLFlagName)
+		}
+		return nil, errors.Errorf("The base URL of the Grafana API isn't configured; run %s config set grafana.baseURL=<URL>", config.AppName)
+	}
+	auth := grafana.Auth{
+		Token:    g.Auth.Token,
+		Username: g.Auth.Username,
+		Password: g.Auth.Password,
+	}
+	return grafana.NewClient(g.BaseURL, auth)
+}
+
+// GrafanaContexts returns the contexts in the configuration as contexts links can be rebased onto.
+func (a *App) GrafanaContexts() []grafana.Context {
+	contexts := make([]grafana.Context, 0, len(a.Config.Contexts))
+	for _, c := range a.Config.Contexts {
+		contexts = append(contexts, grafana.Context{
+			Name:        c.Name,
+			BaseURL:     c.Grafana.BaseURL,
+			OrgID:       c.OrgID,
+			Datasources: c.Datasources,
+		})
+	}
+	return contexts
+}
+
 func (a *App) Shutdown() error {
 	// Any shutdown code goes here.
 	return nil
@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/go-logr/zapr"
@@ -26,11 +27,15 @@ const (
 	AppName         = "grafctl"
 	ConfigDir       = "." + AppName
 	BaseURLFlagName = "base-url"
+	ContextFlagName = "context"
 )
 
 var (
 	// globalV is the global instance of viper
 	globalV *viper.Viper
+
+	// nonEnvVarRe matches the characters that can't be used in the names of environment variables.
+	nonEnvVarRe = regexp.MustCompile(`[^A-Z0-9]+`)
 )
 
 // TODO(jeremy): It might be better to put the datastructures defining the configuration into the API package.
@@ -50,6 +55,19 @@ type Config struct {
 
 	Logging Logging `json:"logging" yaml:"logging"`
 
+	// Time configures how relative times are resolved when links are built.
+	Time Time `json:"time,omitempty" yaml:"time,omitempty"`
+
+	// Grafana configures access to the Grafana API.
+	// It is used when no context is selected.
+	Grafana Grafana `json:"grafana,omitempty" yaml:"grafana,omitempty"`
+
+	// Contexts are the Grafana instances links can be built for e.g. prod and staging.
+	Contexts []Context `json:"contexts,omitempty" yaml:"contexts,omitempty"`
+
+	// CurrentContext is the name of the context to use. It can be overridden with the --context flag.
+	CurrentContext string `json:"currentContext,omitempty" yaml:"currentContext,omitempty"`
+
 	// configFile is the configuration file used
 	configFile string
 }
@@ -67,6 +85,52 @@ type Logging struct {
 	JSON bool `json:"json,omitempty" yaml:"json,omitempty"`
 }
 
+// Time configures how relative times are converted to absolute times.
+// Use the same settings as your teammates so that links cover the same window regardless of where they were built.
+type Time struct {
+	// Timezone is the default timezone used to resolve relative times e.g. to round now/d to the start of the day.
+	// It is an IANA timezone name (e.g. America/Los_Angeles), "utc" or "browser" to use the local timezone.
+	// Defaults to the local timezone.
+	Timezone string `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+	// WeekStart is the first day of the week used to round relative times to weeks e.g. "monday".
+	// Defaults to sunday.
+	WeekStart string `json:"weekStart,omitempty" yaml:"weekStart,omitempty"`
+}
+
+// Grafana configures access to the Grafana API.
+type Grafana struct {
+	// BaseURL is the URL of the Grafana instance e.g. https://grafana.acme.com
+	BaseURL string `json:"baseURL,omitempty" yaml:"baseURL,omitempty"`
+	// Auth are the credentials for the API.
+	Auth GrafanaAuth `json:"auth,omitempty" yaml:"auth,omitempty"`
+}
+
+// Context is a named Grafana instance. Links built with a context are rebased onto its instance so that the same
+// templates can be used for every environment.
+type Context struct {
+	// Name is the name of the context e.g. prod.
+	Name string `json:"name" yaml:"name"`
+	// Grafana configures access to the instance.
+	Grafana Grafana `json:"grafana,omitempty" yaml:"grafana,omitempty"`
+	// OrgID is the organization links open. Leave it unset to use the organization of the template.
+	OrgID string `json:"orgId,omitempty" yaml:"orgId,omitempty"`
+	// Datasources maps datasource types (e.g. loki) to the UID of the default datasource of that type in the
+	// instance. Queries using a datasource of one of the types are switched to the default datasource.
+	Datasources map[string]string `json:"datasources,omitempty" yaml:"datasources,omitempty"`
+}
+
+// GrafanaAuth are the credentials used to authenticate to the Grafana API.
+// Use either a service account token or basic auth. To keep secrets out of the config file set them with the
+// environment variables GRAFCTL_GRAFANA_AUTH_TOKEN and GRAFCTL_GRAFANA_AUTH_PASSWORD (see GetGrafanaAuth) or, for a
+// context, GRAFCTL_CONTEXT_<NAME>_AUTH_TOKEN and GRAFCTL_CONTEXT_<NAME>_AUTH_PASSWORD (see ContextEnvVarName).
+type GrafanaAuth struct {
+	// Token is a service account token.
+	Token string `json:"token,omitempty" yaml:"token,omitempty"`
+	// Username and Password are used for basic auth.
+	Username string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+}
+
 type LogSink struct {
 	// Set to true to write logs in JSON format
 	JSON bool `json:"json,omitempty" yaml:"json,omitempty"`
@@ -75,6 +139,94 @@ type LogSink struct {
 	Path string `json:"path,omitempty" yaml:"path,omitempty"`
 }
 
+// GetGrafanaAuth returns the credentials for the Grafana API. Credentials that aren't in the configuration are read
+// from the environment variables GRAFCTL_GRAFANA_AUTH_TOKEN and GRAFCTL_GRAFANA_AUTH_PASSWORD. We don't bind
+// these variables in viper because then they would be persisted whenever the configuration is written.
+func (c *Config) GetGrafanaAuth() GrafanaAuth {
+	return authFromEnv(c.Grafana.Auth)
+}
+
+// GetGrafana returns the configuration of the Grafana instance of the current context. If no context is selected it
+// returns the grafana section of the configuration. Credentials that aren't set are read from the environment; see
+// GetGrafanaAuth and ContextEnvVarName. A context never uses the credentials for the grafana section so that a
+// token for one instance isn't sent to another.
+func (c *Config) GetGrafana() (Grafana, error) {
+	ctx, err := c.GetContext(c.CurrentContext)
+	if err != nil {
+		return Grafana{}, err
+	}
+	if ctx == nil {
+		g := c.Grafana
+		g.Auth = authFromEnv(g.Auth)
+		return g, nil
+	}
+	g := ctx.Grafana
+	if g.Auth.Token == "" {
+		g.Auth.Token = os.Getenv(ContextEnvVarName(ctx.Name, "token"))
+	}
+	if g.Auth.Password == "" {
+		g.Auth.Password = os.Getenv(ContextEnvVarName(ctx.Name, "password"))
+	}
+	return g, nil
+}
+
+// GetContext returns the context with the name. It returns nil if name is empty.
+func (c *Config) GetContext(name string) (*Context, error) {
+	if name == "" {
+		return nil, nil
+	}
+	for i := range c.Contexts {
+		if c.Contexts[i].Name == name {
+			return &c.Contexts[i], nil
+		}
+	}
+	return nil, errors.Errorf("There is no context named %v; the contexts are %v", name, c.ContextNames())
+}
+
+// ContextNames returns the names of the contexts.
+func (c *Config) ContextNames() []string {
+	names := make([]string, 0, len(c.Contexts))
+	for _, ctx := range c.Contexts {
+		names = append(names, ctx.Name)
+	}
+	return names
+}
+
+// SetContext adds the context to the configuration or replaces the context with the same name.
+func (c *Config) SetContext(ctx Context) {
+	for i := range c.Contexts {
+		if c.Contexts[i].Name == ctx.Name {
+			c.Contexts[i] = ctx
+			return
+		}
+	}
+	c.Contexts = append(c.Contexts, ctx)
+}
+
+// authFromEnv fills in the credentials that aren't set from the environment variables.
+func authFromEnv(auth GrafanaAuth) GrafanaAuth {
+	if auth.Token == "" {
+		auth.Token = os.Getenv(envVarName("grafana.auth.token"))
+	}
+	if auth.Password == "" {
+		auth.Password = os.Getenv(envVarName("grafana.auth.password"))
+	}
+	return auth
+}
+
+// ContextEnvVarName returns the name of the environment variable for the credential (token or password) of the
+// context e.g. GRAFCTL_CONTEXT_PROD_AUTH_TOKEN. Characters other than letters and digits in the name of the context
+// are replaced with underscores.
+func ContextEnvVarName(context string, credential string) string {
+	name := nonEnvVarRe.ReplaceAllString(strings.ToUpper(context), "_")
+	return strings.ToUpper(AppName + "_CONTEXT_" + name + "_AUTH_" + credential)
+}
+
+// envVarName returns the name of the environment variable viper uses for the key.
+func envVarName(key string) string {
+	return strings.ToUpper(AppName + "_" + strings.ReplaceAll(key, ".", "_"))
+}
+
 func (c *Config) GetLogLevel() string {
 	if c.Logging.Level == "" {
 		return "info"
@@ -104,6 +256,20 @@ func (c *Config) GetConfigDir() string {
 // IsValid validates the configuration and returns any errors.
 func (c *Config) IsValid() []string {
 	problems := make([]string, 0, 1)
+	seen := map[string]bool{}
+	for _, ctx := range c.Contexts {
+		if ctx.Name == "" {
+			problems = append(problems, "contexts must have a name")
+			continue
+		}
+		if seen[ctx.Name] {
+			problems = append(problems, fmt.Sprintf("there is more than one context named %v", ctx.Name))
+		}
+		seen[ctx.Name] = true
+	}
+	if _, err := c.GetContext(c.CurrentContext); err != nil {
+		problems = append(problems, err.Error())
+	}
 	return problems
 }
 
@@ -162,6 +328,7 @@ func InitViperInstance(v *viper.Viper, cmd *cobra.Command) error {
 	keyToflagName := map[string]string{
 		ConfigFlagName:             ConfigFlagName,
 		"logging." + LevelFlagName: LevelFlagName,
+		"currentContext":           ContextFlagName,
 	}
 
 	if cmd != nil {
@@ -47,3 +47,79 @@ func Test_ConfigDefaultConfig(t *testing.T) {
 		})
 	}
 }
+
+func Test_GetGrafanaAuth(t *testing.T) {
+	t.Setenv("GRAFCTL_GRAFANA_AUTH_TOKEN", "envtoken")
+
+	cfg := &Config{}
+	if auth := cfg.GetGrafanaAuth(); auth.Token != "envtoken" {
+		t.Errorf("Got token %v; want envtoken", auth.Token)
+	}
+
+	cfg.Grafana.Auth.Token = "filetoken"
+	if auth := cfg.GetGrafanaAuth(); auth.Token != "filetoken" {
+		t.Errorf("Got token %v; want filetoken", auth.Token)
+	}
+}
+
+func Test_GetGrafana(t *testing.T) {
+	t.Setenv("GRAFCTL_GRAFANA_AUTH_TOKEN", "envtoken")
+	t.Setenv("GRAFCTL_CONTEXT_CUSTOMER_ONPREM_AUTH_TOKEN", "onpremtoken")
+	t.Setenv("GRAFCTL_CONTEXT_STAGING_AUTH_TOKEN", "stagingenvtoken")
+
+	cfg := &Config{
+		Grafana: Grafana{BaseURL: "https://grafana.acme.com"},
+		Contexts: []Context{
+			{
+				Name:    "staging",
+				Grafana: Grafana{BaseURL: "https://grafana.staging.acme.com", Auth: GrafanaAuth{Token: "stagingtoken"}},
+			},
+			{
+				Name:    "customer-onprem",
+				Grafana: Grafana{BaseURL: "https://grafana.customer.com"},
+			},
+			{
+				Name:    "dev",
+				Grafana: Grafana{BaseURL: "http://localhost:3000"},
+			},
+		},
+	}
+
+	type testCase struct {
+		context   string
+		baseURL   string
+		token     string
+		expectErr bool
+	}
+
+	cases := []testCase{
+		{context: "", baseURL: "https://grafana.acme.com", token: "envtoken"},
+		{context: "staging", baseURL: "https://grafana.staging.acme.com", token: "stagingtoken"},
+		{context: "customer-onprem", baseURL: "https://grafana.customer.com", token: "onpremtoken"},
+		// A context never uses the credentials of the grafana section.
+		{context: "dev", baseURL: "http://localhost:3000", token: ""},
+		{context: "unknown", expectErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.context, func(t *testing.T) {
+			cfg.CurrentContext = c.context
+			g, err := cfg.GetGrafana()
+			if c.expectErr {
+				if err == nil {
+					t.Fatalf("Expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to get grafana configuration; %+v", err)
+			}
+			if g.BaseURL != c.baseURL {
+				t.Errorf("Got baseURL %v; want %v", g.BaseURL, c.baseURL)
+			}
+			if g.Auth.Token != c.token {
+				t.Errorf("Got token %v; want %v", g.Auth.Token, c.token)
+			}
+		})
+	}
+}
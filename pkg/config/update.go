@@ -18,6 +18,18 @@ func UpdateViperConfig(v *viper.Viper, expression string) (*Config, error) {
 	var fConfig *Config
 
 	switch cfgName {
+	case "currentContext":
+		if len(pieces) < 2 {
+			return fConfig, errors.New("Invalid usage; set expects an argument in the form <NAME>=<VALUE>")
+		}
+		cfg, err := getConfigFromViper(v)
+		if err != nil {
+			return fConfig, err
+		}
+		if _, err := cfg.GetContext(pieces[1]); err != nil {
+			return fConfig, err
+		}
+		v.Set(cfgName, pieces[1])
 	default:
 		if len(pieces) < 2 {
 			return fConfig, errors.New("Invalid usage; set expects an argument in the form <NAME>=<VALUE>")
@@ -28,3 +40,44 @@ func UpdateViperConfig(v *viper.Viper, expression string) (*Config, error) {
 
 	return getConfigFromViper(v)
 }
+
+// UpdateViperContext adds the context to the configuration or, if there is already a context with the same name,
+// sets the fields of that context that are set in update. Datasources are merged into the existing datasources.
+func UpdateViperContext(v *viper.Viper, update Context) (*Config, error) {
+	if update.Name == "" {
+		return nil, errors.New("Invalid usage; the context must have a name")
+	}
+	cfg, err := getConfigFromViper(v)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, err := cfg.GetContext(update.Name)
+	if err != nil {
+		cfg.SetContext(update)
+		return cfg, nil
+	}
+
+	if update.Grafana.BaseURL != "" {
+		ctx.Grafana.BaseURL = update.Grafana.BaseURL
+	}
+	if update.Grafana.Auth.Token != "" {
+		ctx.Grafana.Auth.Token = update.Grafana.Auth.Token
+	}
+	if update.Grafana.Auth.Username != "" {
+		ctx.Grafana.Auth.Username = update.Grafana.Auth.Username
+	}
+	if update.Grafana.Auth.Password != "" {
+		ctx.Grafana.Auth.Password = update.Grafana.Auth.Password
+	}
+	if update.OrgID != "" {
+		ctx.OrgID = update.OrgID
+	}
+	for dsType, uid := range update.Datasources {
+		if ctx.Datasources == nil {
+			ctx.Datasources = map[string]string{}
+		}
+		ctx.Datasources[dsType] = uid
+	}
+	return cfg, nil
+}
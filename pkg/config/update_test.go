@@ -16,6 +16,7 @@ func Test_UpdateViperConfig(t *testing.T) {
 		configFile string
 		expression string
 		expected   *Config
+		expectErr  bool
 	}
 
 	cases := []testCase{
@@ -29,6 +30,33 @@ func Test_UpdateViperConfig(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:       "use-context",
+			configFile: "contexts.yaml",
+			expression: "currentContext=staging",
+			expected: &Config{
+				Grafana: Grafana{BaseURL: "https://grafana.acme.com"},
+				Contexts: []Context{
+					{
+						Name:        "prod",
+						Grafana:     Grafana{BaseURL: "https://grafana.acme.com"},
+						Datasources: map[string]string{"loki": "prodloki"},
+					},
+					{
+						Name:    "staging",
+						Grafana: Grafana{BaseURL: "https://grafana.staging.acme.com"},
+						OrgID:   "2",
+					},
+				},
+				CurrentContext: "staging",
+			},
+		},
+		{
+			name:       "unknown-context",
+			configFile: "contexts.yaml",
+			expression: "currentContext=dev",
+			expectErr:  true,
+		},
 	}
 
 	cwd, err := os.Getwd()
@@ -48,6 +76,12 @@ func Test_UpdateViperConfig(t *testing.T) {
 			}
 
 			cfg, err := UpdateViperConfig(v, c.expression)
+			if c.expectErr {
+				if err == nil {
+					t.Fatalf("Expected an error but got none")
+				}
+				return
+			}
 			if err != nil {
 				t.Fatalf("Failed to update config; %+v", err)
 			}
@@ -59,3 +93,84 @@ func Test_UpdateViperConfig(t *testing.T) {
 		})
 	}
 }
+
+func Test_UpdateViperContext(t *testing.T) {
+	type testCase struct {
+		name     string
+		update   Context
+		expected []Context
+	}
+
+	cases := []testCase{
+		{
+			name: "new",
+			update: Context{
+				Name:    "dev",
+				Grafana: Grafana{BaseURL: "http://localhost:3000"},
+			},
+			expected: []Context{
+				{
+					Name:        "prod",
+					Grafana:     Grafana{BaseURL: "https://grafana.acme.com"},
+					Datasources: map[string]string{"loki": "prodloki"},
+				},
+				{
+					Name:    "staging",
+					Grafana: Grafana{BaseURL: "https://grafana.staging.acme.com"},
+					OrgID:   "2",
+				},
+				{
+					Name:    "dev",
+					Grafana: Grafana{BaseURL: "http://localhost:3000"},
+				},
+			},
+		},
+		{
+			name: "merge",
+			update: Context{
+				Name:        "prod",
+				OrgID:       "3",
+				Datasources: map[string]string{"tempo": "prodtempo"},
+			},
+			expected: []Context{
+				{
+					Name:        "prod",
+					Grafana:     Grafana{BaseURL: "https://grafana.acme.com"},
+					OrgID:       "3",
+					Datasources: map[string]string{"loki": "prodloki", "tempo": "prodtempo"},
+				},
+				{
+					Name:    "staging",
+					Grafana: Grafana{BaseURL: "https://grafana.staging.acme.com"},
+					OrgID:   "2",
+				},
+			},
+		},
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory")
+	}
+	tDir := filepath.Join(cwd, "test_data")
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			v := viper.New()
+			v.SetConfigFile(filepath.Join(tDir, "contexts.yaml"))
+
+			if err := InitViperInstance(v, nil); err != nil {
+				t.Fatalf("Failed to initialize the configuration.")
+			}
+
+			cfg, err := UpdateViperContext(v, c.update)
+			if err != nil {
+				t.Fatalf("Failed to update context; %+v", err)
+			}
+
+			if d := cmp.Diff(c.expected, cfg.Contexts); d != "" {
+				t.Fatalf("Unexpected diff:\n%+v", d)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package grafana
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/jlewi/grafctl/api"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// OutputYAML and OutputMarkdown are additional formats for printing the results of building links.
+	OutputYAML     = "yaml"
+	OutputMarkdown = "markdown"
+)
+
+// PatchEntry is a patch read from a batch of patches. Err is set if the entry couldn't be decoded.
+type PatchEntry struct {
+	// Index is the 0-based position of the entry in the batch.
+	Index int
+	Patch *api.PanePatch
+	Err   error
+	// Provenance is the source of each field of Patch when it was merged from several layers.
+	Provenance Provenance
+}
+
+// BuildResult is the outcome of building the link for one entry of a batch.
+type BuildResult struct {
+	// Name is the name of the patch or, if the patch isn't named, its template.
+	Name     string `json:"name" yaml:"name"`
+	Template string `json:"template,omitempty" yaml:"template,omitempty"`
+	URL      string `json:"url,omitempty" yaml:"url,omitempty"`
+	Error    string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// ReadPatches reads a batch of patches from r. r contains either multi-document YAML or JSONL (one JSON patch per
+// line). Entries that can't be decoded are returned with Err set so that the rest of the batch can still be built.
+// A YAML syntax error is reported as the last entry since the documents after it can't be located.
+func ReadPatches(r io.Reader) ([]PatchEntry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read patches")
+	}
+	if isJSONL(data) {
+		return readJSONLPatches(data)
+	}
+	return readYAMLPatches(data)
+}
+
+// isJSONL returns true if data looks like JSONL i.e. the first line is a JSON object.
+func isJSONL(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return false
+	}
+	line, _, _ := bytes.Cut(trimmed, []byte("\n"))
+	return json.Valid(bytes.TrimSpace(line))
+}
+
+func readJSONLPatches(data []byte) ([]PatchEntry, error) {
+	entries := []PatchEntry{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 10<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		entry := PatchEntry{Index: len(entries)}
+		patch := &api.PanePatch{}
+		if err := json.Unmarshal(text, patch); err != nil {
+			entry.Err = errors.Wrapf(err, "Invalid JSON on line %v", line)
+		} else if err := UpgradePatch(patch); err != nil {
+			entry.Err = errors.Wrapf(err, "Invalid patch on line %v", line)
+		} else {
+			entry.Patch = patch
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return entries, errors.Wrapf(err, "Failed to read patches")
+	}
+	return entries, nil
+}
+
+func readYAMLPatches(data []byte) ([]PatchEntry, error) {
+	entries := []PatchEntry{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		doc := &yaml.Node{}
+		err := decoder.Decode(doc)
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			entries = append(entries, PatchEntry{
+				Index: len(entries),
+				Err:   errors.Wrapf(err, "Failed to decode YAML document %v; the documents after it were skipped", len(entries)+1),
+			})
+			return entries, nil
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		entry := PatchEntry{Index: len(entries)}
+		patch := &api.PanePatch{}
+		if err := doc.Decode(patch); err != nil {
+			entry.Err = errors.Wrapf(err, "Invalid patch in document %v", entry.Index+1)
+		} else if err := UpgradePatch(patch); err != nil {
+			entry.Err = errors.Wrapf(err, "Invalid patch in document %v", entry.Index+1)
+		} else {
+			entry.Patch = patch
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// BuildLinks builds the link for every entry by calling build with at most concurrency builds running at once.
+// The results are in the order of the entries. A failure to build one link doesn't stop the others; the error is
+// recorded in the result instead.
+func BuildLinks(entries []PatchEntry, concurrency int, build func(api.PanePatch) (string, error)) []BuildResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([]BuildResult, len(entries))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, entry := range entries {
+		results[i].Name = fmt.Sprintf("#%v", entry.Index+1)
+		if entry.Err != nil {
+			results[i].Error = entry.Err.Error()
+			continue
+		}
+		results[i].Template = entry.Patch.Template
+		results[i].Name = entryName(entry)
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, patch api.PanePatch) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			u, err := build(patch)
+			if err != nil {
+				results[i].Error = err.Error()
+				return
+			}
+			results[i].URL = u
+		}(i, *entry.Patch)
+	}
+	wg.Wait()
+	return results
+}
+
+// entryName returns the name of the entry in the results; the name of the patch or else its template.
+func entryName(entry PatchEntry) string {
+	if entry.Patch.Metadata.Name != "" {
+		return entry.Patch.Metadata.Name
+	}
+	if entry.Patch.Template != "" {
+		return entry.Patch.Template
+	}
+	return fmt.Sprintf("#%v", entry.Index+1)
+}
+
+// WriteBuildResults writes the results in the format; one of json, yaml or markdown.
+func WriteBuildResults(w io.Writer, results []BuildResult, format string) error {
+	switch format {
+	case OutputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	case OutputYAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(results); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case OutputMarkdown:
+		if _, err := fmt.Fprintln(w, "| Name | Link | Error |\n|------|------|-------|"); err != nil {
+			return err
+		}
+		for _, r := range results {
+			link := ""
+			if r.URL != "" {
+				link = fmt.Sprintf("[link](%v)", r.URL)
+			}
+			if _, err := fmt.Fprintf(w, "| %v | %v | %v |\n", markdownCell(r.Name), link, markdownCell(r.Error)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return errors.Errorf("Unknown output format %v; format should be one of %v", format, []string{OutputJSON, OutputYAML, OutputMarkdown})
+}
+
+// markdownCell escapes the value so it can be used in a cell of a Markdown table.
+func markdownCell(v string) string {
+	v = strings.ReplaceAll(v, "|", "\\|")
+	return strings.ReplaceAll(v, "\n", " ")
+}
@@ -0,0 +1,200 @@
+package grafana
+
+import (
+	"bytes"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/grafctl/api"
+	"github.com/pkg/errors"
+)
+
+func Test_ReadPatches(t *testing.T) {
+	type testCase struct {
+		name      string
+		input     string
+		templates []string
+		errs      []string
+	}
+
+	cases := []testCase{
+		{
+			name: "single",
+			input: `template: logs
+params:
+  app: foyle
+`,
+			templates: []string{"logs"},
+			errs:      []string{""},
+		},
+		{
+			name: "multi-document",
+			input: `template: logs
+---
+template: metrics
+---
+template: [bad]
+---
+apiVersion: grafctl.foyle.io/v1beta9
+template: traces
+`,
+			templates: []string{"logs", "metrics", "", ""},
+			errs:      []string{"", "", "Invalid patch in document 3", "Unsupported apiVersion"},
+		},
+		{
+			name: "jsonl",
+			input: `{"template": "logs", "params": {"app": "foyle"}}
+{"template": "metrics"
+
+{"template": "traces"}
+`,
+			templates: []string{"logs", "", "traces"},
+			errs:      []string{"", "Invalid JSON on line 2", ""},
+		},
+		{
+			name: "pretty-json",
+			input: `{
+  "template": "logs"
+}
+`,
+			templates: []string{"logs"},
+			errs:      []string{""},
+		},
+		{
+			name: "yaml-syntax-error",
+			input: `template: logs
+---
+template: "metrics
+`,
+			templates: []string{"logs", ""},
+			errs:      []string{"", "Failed to decode YAML document 2"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			entries, err := ReadPatches(strings.NewReader(c.input))
+			if err != nil {
+				t.Fatalf("Failed to read patches: %+v", err)
+			}
+			templates := []string{}
+			errs := []string{}
+			for i, e := range entries {
+				if e.Index != i {
+					t.Errorf("Entry %v has index %v", i, e.Index)
+				}
+				template := ""
+				if e.Patch != nil {
+					template = e.Patch.Template
+				}
+				templates = append(templates, template)
+				msg := ""
+				if e.Err != nil {
+					msg = e.Err.Error()
+				}
+				errs = append(errs, msg)
+			}
+			if d := cmp.Diff(c.templates, templates); d != "" {
+				t.Errorf("Unexpected templates:\n%v", d)
+			}
+			if len(errs) != len(c.errs) {
+				t.Fatalf("Got errors %v; want %v", errs, c.errs)
+			}
+			for i := range errs {
+				if (c.errs[i] == "") != (errs[i] == "") || !strings.Contains(errs[i], c.errs[i]) {
+					t.Errorf("Entry %v has error %q; want %q", i, errs[i], c.errs[i])
+				}
+			}
+		})
+	}
+}
+
+func Test_BuildLinks(t *testing.T) {
+	entries := []PatchEntry{
+		{Index: 0, Patch: &api.PanePatch{Metadata: api.Metadata{Name: "first"}, Template: "logs"}},
+		{Index: 1, Err: errors.New("Invalid JSON on line 2")},
+		{Index: 2, Patch: &api.PanePatch{Template: "missing"}},
+		{Index: 3, Patch: &api.PanePatch{Template: "metrics"}},
+	}
+
+	var running, maxRunning int32
+	results := BuildLinks(entries, 2, func(patch api.PanePatch) (string, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		if patch.Template == "missing" {
+			return "", errors.New("There is no template missing")
+		}
+		return "https://grafana.acme.com/" + patch.Template, nil
+	})
+
+	expected := []BuildResult{
+		{Name: "first", Template: "logs", URL: "https://grafana.acme.com/logs"},
+		{Name: "#2", Error: "Invalid JSON on line 2"},
+		{Name: "missing", Template: "missing", Error: "There is no template missing"},
+		{Name: "metrics", Template: "metrics", URL: "https://grafana.acme.com/metrics"},
+	}
+	if d := cmp.Diff(expected, results); d != "" {
+		t.Errorf("Unexpected diff:\n%v", d)
+	}
+	if maxRunning > 2 {
+		t.Errorf("Got %v concurrent builds; want at most 2", maxRunning)
+	}
+}
+
+func Test_WriteBuildResults(t *testing.T) {
+	results := []BuildResult{
+		{Name: "logs", Template: "logs", URL: "https://grafana.acme.com/explore?panes=%7B%7D"},
+		{Name: "#2", Error: "Invalid | patch\nbad"},
+	}
+
+	type testCase struct {
+		format   string
+		expected string
+	}
+
+	cases := []testCase{
+		{
+			format: OutputMarkdown,
+			expected: `| Name | Link | Error |
+|------|------|-------|
+| logs | [link](https://grafana.acme.com/explore?panes=%7B%7D) |  |
+| #2 |  | Invalid \| patch bad |
+`,
+		},
+		{
+			format: OutputYAML,
+			expected: `- name: logs
+  template: logs
+  url: https://grafana.acme.com/explore?panes=%7B%7D
+- name: '#2'
+  error: |-
+    Invalid | patch
+    bad
+`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.format, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := WriteBuildResults(&b, results, c.format); err != nil {
+				t.Fatalf("Failed to write results: %+v", err)
+			}
+			if d := cmp.Diff(c.expected, b.String()); d != "" {
+				t.Errorf("Unexpected diff:\n%v", d)
+			}
+		})
+	}
+
+	if err := WriteBuildResults(&bytes.Buffer{}, results, OutputCSV); err == nil {
+		t.Errorf("Expected an error for an unsupported format")
+	}
+}
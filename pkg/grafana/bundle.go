@@ -0,0 +1,253 @@
+package grafana
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/jlewi/grafctl/api"
+	"github.com/pkg/errors"
+)
+
+// bundlePane identifies a pane of a template in a bundle.
+type bundlePane struct {
+	// member is the index of the template in the bundle.
+	member int
+	// paneID is the ID of the pane in the template.
+	paneID string
+}
+
+// ApplyBundlePatch applies the patch to every template in the bundle and combines the panes of the resulting links
+// into a single Explore link.
+//
+// The params in the patch are passed to the templates that declare them and the time range is resolved once so that
+// all the panes cover exactly the same window. Pane in Query, Targets and Panes refers to the IDs of the panes in
+// the combined link. The bases aren't modified.
+func (a *Patcher) ApplyBundlePatch(bundle *api.LinkBundle, bases []*api.GrafanaLink, patch api.PanePatch) (*api.GrafanaLink, error) {
+	if len(bundle.Templates) == 0 {
+		return nil, errors.Errorf("LinkBundle %v doesn't have any templates", bundle.Metadata.Name)
+	}
+	if len(patch.Variables) > 0 {
+		return nil, errors.Errorf("Unable to apply patch to bundle %v; variables can only be set on dashboard links", bundle.Metadata.Name)
+	}
+
+	members := make([]*api.GrafanaLink, 0, len(bundle.Templates))
+	panes := map[string]bundlePane{}
+	declared := map[string]bool{}
+	for i, t := range bundle.Templates {
+		var base *api.GrafanaLink
+		for _, b := range bases {
+			if b.Metadata.Name == t.Template {
+				base = b
+				break
+			}
+		}
+		if base == nil {
+			return nil, errors.Errorf("LinkBundle %v uses template %v but there is no template with that name", bundle.Metadata.Name, t.Template)
+		}
+		if base.Dashboard != nil {
+			return nil, errors.Errorf("LinkBundle %v uses template %v which is a dashboard link; bundles can only combine Explore links", bundle.Metadata.Name, t.Template)
+		}
+
+		member, err := copyLink(base)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to copy template %v", t.Template)
+		}
+		// Rebase the templates before comparing them so that templates for different instances can be combined
+		// once they are rebased onto the same context.
+		if err := a.rebase(member, patch); err != nil {
+			return nil, errors.Wrapf(err, "Failed to apply patch to bundle %v", bundle.Metadata.Name)
+		}
+		if len(members) > 0 && member.BaseURL != members[0].BaseURL {
+			return nil, errors.Errorf("The templates in LinkBundle %v must have the same baseURL but %v has %v and %v has %v", bundle.Metadata.Name, members[0].Metadata.Name, members[0].BaseURL, member.Metadata.Name, member.BaseURL)
+		}
+		if len(members) > 0 && member.OrgID != members[0].OrgID {
+			return nil, errors.Errorf("The templates in LinkBundle %v must open the same organization but %v has orgId %v and %v has orgId %v", bundle.Metadata.Name, members[0].Metadata.Name, members[0].OrgID, member.Metadata.Name, member.OrgID)
+		}
+		members = append(members, member)
+
+		for _, paneID := range paneIDs(member.Panes) {
+			id := bundlePaneID(t, paneID, len(member.Panes))
+			if _, ok := panes[id]; ok {
+				return nil, errors.Errorf("LinkBundle %v has more than one pane with ID %v; set pane to give the templates different IDs", bundle.Metadata.Name, id)
+			}
+			panes[id] = bundlePane{member: i, paneID: paneID}
+		}
+		for _, p := range member.Parameters {
+			declared[p.Name] = true
+		}
+	}
+
+	for name := range patch.Params {
+		if !declared[name] {
+			return nil, errors.Errorf("Unknown parameter %v; none of the templates in LinkBundle %v declare it", name, bundle.Metadata.Name)
+		}
+	}
+
+	patches := make([]api.PanePatch, len(members))
+	for i, t := range bundle.Templates {
+		params := map[string]interface{}{}
+		for k, v := range t.Params {
+			params[k] = v
+		}
+		for _, p := range members[i].Parameters {
+			if v, ok := patch.Params[p.Name]; ok {
+				params[p.Name] = v
+			}
+		}
+		patches[i] = api.PanePatch{
+			Template:  t.Template,
+			Params:    params,
+			PatchType: patch.PatchType,
+			Range:     patch.Range,
+			FixTime:   patch.FixTime,
+			Timezone:  patch.Timezone,
+			WeekStart: patch.WeekStart,
+			Context:   patch.Context,
+		}
+	}
+
+	// Resolve the time range once so that all the panes share the same absolute range.
+	if patch.FixTime == nil || *patch.FixTime {
+		timeParser, err := a.timeParser(members[0], patch)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to apply patch to bundle %v", bundle.Metadata.Name)
+		}
+		// When the patch doesn't set a range the range of the first template is used for all of them.
+		r, err := resolveRange(templateRange(members[0]), patch, timeParser)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to apply patch to bundle %v", bundle.Metadata.Name)
+		}
+		for i := range patches {
+			patches[i].Range = r
+		}
+	}
+
+	ids := sortedKeys(panes)
+	for _, q := range queryPatches(patch) {
+		paneID := q.Pane
+		if paneID == "" {
+			if len(panes) != 1 {
+				return nil, errors.Errorf("LinkBundle %v has %v panes; set pane in the patch to select one of %v", bundle.Metadata.Name, len(panes), ids)
+			}
+			paneID = ids[0]
+		}
+		bp, ok := panes[paneID]
+		if !ok {
+			return nil, errors.Errorf("LinkBundle %v doesn't have a pane with ID %v; the panes are %v", bundle.Metadata.Name, paneID, ids)
+		}
+		q.Pane = bp.paneID
+		patches[bp.member].Targets = append(patches[bp.member].Targets, q)
+	}
+	for paneID, p := range patch.Panes {
+		bp, ok := panes[paneID]
+		if !ok {
+			return nil, errors.Errorf("LinkBundle %v doesn't have a pane with ID %v; the panes are %v", bundle.Metadata.Name, paneID, ids)
+		}
+		if patches[bp.member].Panes == nil {
+			patches[bp.member].Panes = map[string]map[string]interface{}{}
+		}
+		patches[bp.member].Panes[bp.paneID] = p
+	}
+
+	link := &api.GrafanaLink{
+		APIVersion:  api.LinkGVK.GroupVersion().String(),
+		Kind:        api.LinkGVK.Kind,
+		Metadata:    api.Metadata{Name: bundle.Metadata.Name},
+		Description: bundle.Description,
+		BaseURL:     members[0].BaseURL,
+		Panes:       api.Panes{},
+		// The query parameters of the link are those of the first template.
+		OrgID:         members[0].OrgID,
+		Kiosk:         members[0].Kiosk,
+		Theme:         members[0].Theme,
+		Refresh:       members[0].Refresh,
+		SchemaVersion: members[0].SchemaVersion,
+		QueryParams:   members[0].QueryParams,
+	}
+	if err := applyURLOptions(link, patch); err != nil {
+		return nil, errors.Wrapf(err, "Failed to apply patch to bundle %v", bundle.Metadata.Name)
+	}
+	for i, member := range members {
+		patched, err := a.patchLink(member, patches[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to apply patch to template %v of bundle %v", member.Metadata.Name, bundle.Metadata.Name)
+		}
+		for paneID, body := range patched.Panes {
+			link.Panes[bundlePaneID(bundle.Templates[i], paneID, len(patched.Panes))] = body
+		}
+	}
+
+	if len(patch.Operations) > 0 {
+		if err := applyOperations(link, patch.Operations); err != nil {
+			return nil, errors.Wrapf(err, "Failed to apply operations to bundle %v", bundle.Metadata.Name)
+		}
+	}
+	return link, nil
+}
+
+// ApplyTemplatePatch applies the patch to the LinkBundle or GrafanaLink named by the patch's template. Bundles take
+// precedence over links with the same name. Unlike ApplyPatch the bases aren't modified so the same templates can be
+// used to build many links. The bases of the patch must already have been merged into it; see MergePatches.
+func (a *Patcher) ApplyTemplatePatch(bases []*api.GrafanaLink, bundles []*api.LinkBundle, patch api.PanePatch) (*api.GrafanaLink, error) {
+	if len(patch.Bases) > 0 {
+		return nil, errors.Errorf("The patch has bases %v; bases are only supported in patch files and must be merged before the patch is applied", patch.Bases)
+	}
+	for _, b := range bundles {
+		if b.Metadata.Name == patch.Template {
+			return a.ApplyBundlePatch(b, bases, patch)
+		}
+	}
+
+	copies := make([]*api.GrafanaLink, 0, len(bases))
+	for _, b := range bases {
+		if b.Metadata.Name != patch.Template {
+			copies = append(copies, b)
+			continue
+		}
+		c, err := copyLink(b)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to copy template %v", b.Metadata.Name)
+		}
+		copies = append(copies, c)
+	}
+	return a.ApplyPatch(copies, patch)
+}
+
+// templateRange returns the time range in the template; the range of the dashboard or, for explore links, of the
+// first pane that has one.
+func templateRange(link *api.GrafanaLink) api.TimeRange {
+	if link.Dashboard != nil {
+		return link.Dashboard.Range
+	}
+	for _, id := range paneIDs(link.Panes) {
+		if r := link.Panes[id].Range; r.From != "" || r.To != "" {
+			return r
+		}
+	}
+	return api.TimeRange{}
+}
+
+// bundlePaneID returns the ID in the bundle's link of the pane of the template.
+func bundlePaneID(t api.BundleTemplate, paneID string, numPanes int) string {
+	prefix := t.Pane
+	if prefix == "" {
+		prefix = t.Template
+	}
+	if numPanes == 1 {
+		return prefix
+	}
+	return fmt.Sprintf("%v-%v", prefix, paneID)
+}
+
+// copyLink returns a deep copy of the link.
+func copyLink(link *api.GrafanaLink) (*api.GrafanaLink, error) {
+	b, err := json.Marshal(link)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to marshal link")
+	}
+	c := &api.GrafanaLink{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, errors.Wrapf(err, "Failed to unmarshal link")
+	}
+	return c, nil
+}
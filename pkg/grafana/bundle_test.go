@@ -0,0 +1,199 @@
+package grafana
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/grafctl/api"
+)
+
+func bundleBases() []*api.GrafanaLink {
+	return []*api.GrafanaLink{
+		{
+			Metadata: api.Metadata{Name: "logs"},
+			BaseURL:  "https://grafana.acme.com",
+			Parameters: []api.Parameter{
+				{Name: "service", Label: "service"},
+			},
+			Panes: api.Panes{
+				"eja": api.PaneBody{
+					Datasource: "lokiuid",
+					Queries: []api.Query{
+						{
+							RefID:      "A",
+							Datasource: api.Datasource{Type: "loki", UID: "lokiuid"},
+							Expr:       `{cluster="prod"}`,
+						},
+					},
+				},
+			},
+		},
+		{
+			Metadata: api.Metadata{Name: "metrics"},
+			BaseURL:  "https://grafana.acme.com",
+			Parameters: []api.Parameter{
+				{Name: "service", Label: "job"},
+				{Name: "quantile", Default: "0.99", Path: "legendFormat"},
+			},
+			Panes: api.Panes{
+				"abc": api.PaneBody{
+					Datasource: "promuid",
+					Queries: []api.Query{
+						{
+							RefID:      "A",
+							Datasource: api.Datasource{Type: "prometheus", UID: "promuid"},
+							Expr:       `rate(http_requests_total[5m])`,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func Test_ApplyBundlePatch(t *testing.T) {
+	bundle := &api.LinkBundle{
+		Metadata: api.Metadata{Name: "service"},
+		Templates: []api.BundleTemplate{
+			{Template: "logs", Pane: "a-logs"},
+			{Template: "metrics", Pane: "b-metrics", Params: map[string]interface{}{"quantile": "0.5"}},
+		},
+	}
+
+	patch := api.PanePatch{
+		Template: "service",
+		Params:   map[string]interface{}{"service": "app"},
+		Targets: []api.QueryPatch{
+			{Pane: "b-metrics", Query: map[string]interface{}{"interval": "1m"}},
+		},
+		Range: api.TimeRange{From: "now-1h", To: "now"},
+	}
+
+	bases := bundleBases()
+	link, err := NewPatcher(FakeClock{}).ApplyBundlePatch(bundle, bases, patch)
+	if err != nil {
+		t.Fatalf("Error applying patch: %v", err)
+	}
+
+	r := api.TimeRange{From: "1708863900000", To: "1708867500000"}
+	expected := &api.GrafanaLink{
+		APIVersion: api.LinkGVK.GroupVersion().String(),
+		Kind:       api.LinkGVK.Kind,
+		Metadata:   api.Metadata{Name: "service"},
+		BaseURL:    "https://grafana.acme.com",
+		Panes: api.Panes{
+			"a-logs": api.PaneBody{
+				Datasource: "lokiuid",
+				Queries: []api.Query{
+					{
+						RefID:            "A",
+						Datasource:       api.Datasource{Type: "loki", UID: "lokiuid"},
+						Expr:             `{cluster="prod", service="app"}`,
+						AdditionalFields: map[string]interface{}{},
+					},
+				},
+				Range: r,
+			},
+			"b-metrics": api.PaneBody{
+				Datasource: "promuid",
+				Queries: []api.Query{
+					{
+						RefID:            "A",
+						Datasource:       api.Datasource{Type: "prometheus", UID: "promuid"},
+						Expr:             `rate(http_requests_total{job="app"}[5m])`,
+						LegendFormat:     "0.5",
+						Interval:         "1m",
+						AdditionalFields: map[string]interface{}{},
+					},
+				},
+				Range: r,
+			},
+		},
+	}
+	if d := cmp.Diff(expected, link); d != "" {
+		t.Errorf("Unexpected diff:\n%v", d)
+	}
+
+	if d := cmp.Diff(bundleBases(), bases); d != "" {
+		t.Errorf("The bases were modified:\n%v", d)
+	}
+}
+
+func Test_ApplyBundlePatchWithoutRange(t *testing.T) {
+	bundle := &api.LinkBundle{
+		Metadata: api.Metadata{Name: "service"},
+		Templates: []api.BundleTemplate{
+			{Template: "logs"},
+			{Template: "metrics"},
+		},
+	}
+
+	// When the patch doesn't set a range the range of the first template is used for all the panes.
+	bases := bundleBases()
+	logs := bases[0].Panes["eja"]
+	logs.Range = api.TimeRange{From: "now-1h", To: "now"}
+	bases[0].Panes["eja"] = logs
+	metrics := bases[1].Panes["abc"]
+	metrics.Range = api.TimeRange{From: "now-6h", To: "now"}
+	bases[1].Panes["abc"] = metrics
+
+	patch := api.PanePatch{
+		Template: "service",
+		Params:   map[string]interface{}{"service": "app"},
+	}
+
+	link, err := NewPatcher(FakeClock{}).ApplyBundlePatch(bundle, bases, patch)
+	if err != nil {
+		t.Fatalf("Error applying patch: %v", err)
+	}
+
+	expected := api.TimeRange{From: "1708863900000", To: "1708867500000"}
+	for id, pane := range link.Panes {
+		if d := cmp.Diff(expected, pane.Range); d != "" {
+			t.Errorf("Unexpected range for pane %v:\n%v", id, d)
+		}
+	}
+}
+
+func Test_ApplyBundlePatchErrors(t *testing.T) {
+	type testCase struct {
+		name      string
+		templates []api.BundleTemplate
+		patch     api.PanePatch
+	}
+
+	cases := []testCase{
+		{
+			name:      "unknown-template",
+			templates: []api.BundleTemplate{{Template: "traces"}},
+			patch:     api.PanePatch{Template: "bundle", Range: api.TimeRange{From: "now-1h", To: "now"}},
+		},
+		{
+			name:      "unknown-param",
+			templates: []api.BundleTemplate{{Template: "logs"}, {Template: "metrics"}},
+			patch:     api.PanePatch{Template: "bundle", Params: map[string]interface{}{"service": "app", "cluster": "prod"}, Range: api.TimeRange{From: "now-1h", To: "now"}},
+		},
+		{
+			name:      "duplicate-pane",
+			templates: []api.BundleTemplate{{Template: "logs", Pane: "a"}, {Template: "metrics", Pane: "a"}},
+			patch:     api.PanePatch{Template: "bundle", Params: map[string]interface{}{"service": "app"}, Range: api.TimeRange{From: "now-1h", To: "now"}},
+		},
+		{
+			name:      "ambiguous-query",
+			templates: []api.BundleTemplate{{Template: "logs"}, {Template: "metrics"}},
+			patch:     api.PanePatch{Template: "bundle", Params: map[string]interface{}{"service": "app"}, Query: map[string]interface{}{"expr": "up"}, Range: api.TimeRange{From: "now-1h", To: "now"}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			bundle := &api.LinkBundle{
+				Metadata:  api.Metadata{Name: "bundle"},
+				Templates: c.templates,
+			}
+			if _, err := NewPatcher(FakeClock{}).ApplyBundlePatch(bundle, bundleBases(), c.patch); err == nil {
+				t.Fatalf("Expected an error but got none")
+			}
+		})
+	}
+}
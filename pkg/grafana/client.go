@@ -0,0 +1,439 @@
+package grafana
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/zapr"
+	"github.com/jlewi/grafctl/api"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Auth holds the credentials used to authenticate to the Grafana API.
+// Token takes precedence over Username and Password.
+type Auth struct {
+	// Token is a service account token.
+	Token string
+	// Username and Password are used for basic auth.
+	Username string
+	Password string
+}
+
+// Client is a client for the Grafana HTTP API.
+// https://grafana.com/docs/grafana/latest/developers/http_api/
+type Client struct {
+	// BaseURL is the URL of the Grafana instance e.g. https://grafana.acme.com
+	BaseURL    string
+	Auth       Auth
+	HTTPClient *http.Client
+}
+
+// NewClient creates a new client for the Grafana instance at baseURL.
+func NewClient(baseURL string, auth Auth) (*Client, error) {
+	if baseURL == "" {
+		return nil, errors.New("The base URL of the Grafana instance must be set to create a client")
+	}
+	if _, err := url.Parse(baseURL); err != nil {
+		return nil, errors.Wrapf(err, "Invalid base URL %v", baseURL)
+	}
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Auth:       auth,
+		HTTPClient: http.DefaultClient,
+	}, nil
+}
+
+// APIError is returned when the Grafana API returns a non 2xx status code.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("Grafana API returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound returns true if the error is an APIError with status 404.
+func IsNotFound(err error) bool {
+	apiErr := &APIError{}
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusNotFound
+	}
+	return false
+}
+
+// SearchOptions are the options for searching dashboards and folders.
+// https://grafana.com/docs/grafana/latest/developers/http_api/folder_dashboard_search/
+type SearchOptions struct {
+	// Query is a search string matched against the titles.
+	Query string
+	// Tags restricts the results to dashboards with all the tags.
+	Tags []string
+	// Type is either "dash-db" or "dash-folder".
+	Type string
+	// FolderUIDs restricts the results to the folders.
+	FolderUIDs []string
+	Limit      int
+}
+
+// SearchHit is a dashboard or folder returned by a search.
+type SearchHit struct {
+	ID          int64    `json:"id"`
+	UID         string   `json:"uid"`
+	Title       string   `json:"title"`
+	URI         string   `json:"uri,omitempty"`
+	URL         string   `json:"url"`
+	Slug        string   `json:"slug,omitempty"`
+	Type        string   `json:"type"`
+	Tags        []string `json:"tags,omitempty"`
+	FolderUID   string   `json:"folderUid,omitempty"`
+	FolderTitle string   `json:"folderTitle,omitempty"`
+}
+
+// DashboardWithMeta is the response of the get dashboard API.
+type DashboardWithMeta struct {
+	Dashboard DashboardModel `json:"dashboard"`
+	Meta      DashboardMeta  `json:"meta"`
+}
+
+// DashboardModel is the JSON model of a dashboard. Only the fields used by grafctl are decoded.
+// https://grafana.com/docs/grafana/latest/dashboards/build-dashboards/view-dashboard-json-model/
+type DashboardModel struct {
+	UID      string        `json:"uid"`
+	Title    string        `json:"title"`
+	Tags     []string      `json:"tags,omitempty"`
+	Timezone string        `json:"timezone,omitempty"`
+	Time     api.TimeRange `json:"time,omitempty"`
+	Panels   []Panel       `json:"panels,omitempty"`
+	// Templating holds the dashboard's template variables.
+	Templating Templating `json:"templating,omitempty"`
+}
+
+type Templating struct {
+	List []TemplateVariable `json:"list,omitempty"`
+}
+
+// TemplateVariable is a dashboard template variable.
+type TemplateVariable struct {
+	Name string `json:"name"`
+	// Type is the type of the variable e.g. "datasource", "query" or "custom".
+	Type string `json:"type"`
+	// Current is the currently selected value.
+	Current TemplateVariableValue `json:"current,omitempty"`
+}
+
+type TemplateVariableValue struct {
+	// Value is a string or, for multi-value variables, a list of strings.
+	Value any `json:"value,omitempty"`
+}
+
+// Panel is a panel in a dashboard.
+type Panel struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+	Type  string `json:"type"`
+	// Datasource is either a reference to a datasource ({"type": ..., "uid": ...}) or, in older dashboards,
+	// the name of the datasource. Use DatasourceRef to decode it.
+	Datasource json.RawMessage `json:"datasource,omitempty"`
+	Targets    []api.Query     `json:"targets,omitempty"`
+	// Panels are the panels nested in a collapsed row.
+	Panels []Panel `json:"panels,omitempty"`
+}
+
+// DatasourceRef returns the reference to the datasource of the panel. For older dashboards which refer to datasources
+// by name the name is returned as the UID.
+func (p Panel) DatasourceRef() (api.Datasource, error) {
+	ref := api.Datasource{}
+	if len(p.Datasource) == 0 || string(p.Datasource) == "null" {
+		return ref, nil
+	}
+	if err := json.Unmarshal(p.Datasource, &ref); err == nil {
+		return ref, nil
+	}
+	name := ""
+	if err := json.Unmarshal(p.Datasource, &name); err != nil {
+		return ref, errors.Wrapf(err, "Failed to decode the datasource of panel %v", p.ID)
+	}
+	ref.UID = name
+	return ref, nil
+}
+
+// DashboardMeta is the metadata about a dashboard.
+type DashboardMeta struct {
+	Slug      string `json:"slug"`
+	URL       string `json:"url"`
+	FolderUID string `json:"folderUid,omitempty"`
+	Version   int    `json:"version,omitempty"`
+}
+
+// DataSource is a datasource configured in Grafana.
+type DataSource struct {
+	ID        int64  `json:"id"`
+	UID       string `json:"uid"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	URL       string `json:"url,omitempty"`
+	Access    string `json:"access,omitempty"`
+	IsDefault bool   `json:"isDefault"`
+}
+
+// Folder is a folder of dashboards.
+type Folder struct {
+	ID        int64  `json:"id"`
+	UID       string `json:"uid"`
+	Title     string `json:"title"`
+	URL       string `json:"url,omitempty"`
+	ParentUID string `json:"parentUid,omitempty"`
+}
+
+// ShortURL is a short link created by Grafana.
+type ShortURL struct {
+	UID string `json:"uid"`
+	// URL is the short link e.g. https://grafana.acme.com/goto/abcdef?orgId=1
+	URL string `json:"url"`
+}
+
+// Search searches for dashboards and folders.
+func (c *Client) Search(ctx context.Context, opts SearchOptions) ([]SearchHit, error) {
+	query := url.Values{}
+	if opts.Query != "" {
+		query.Set("query", opts.Query)
+	}
+	for _, t := range opts.Tags {
+		query.Add("tag", t)
+	}
+	if opts.Type != "" {
+		query.Set("type", opts.Type)
+	}
+	for _, f := range opts.FolderUIDs {
+		query.Add("folderUIDs", f)
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+
+	hits := make([]SearchHit, 0)
+	if err := c.do(ctx, http.MethodGet, "/api/search", query, nil, &hits); err != nil {
+		return nil, errors.Wrapf(err, "Failed to search Grafana")
+	}
+	return hits, nil
+}
+
+// GetDashboard returns the dashboard with the given UID.
+func (c *Client) GetDashboard(ctx context.Context, uid string) (*DashboardWithMeta, error) {
+	d := &DashboardWithMeta{}
+	if err := c.do(ctx, http.MethodGet, "/api/dashboards/uid/"+url.PathEscape(uid), nil, nil, d); err != nil {
+		return nil, errors.Wrapf(err, "Failed to get dashboard %v", uid)
+	}
+	return d, nil
+}
+
+// ListDatasources returns all the datasources.
+func (c *Client) ListDatasources(ctx context.Context) ([]DataSource, error) {
+	datasources := make([]DataSource, 0)
+	if err := c.do(ctx, http.MethodGet, "/api/datasources", nil, nil, &datasources); err != nil {
+		return nil, errors.Wrapf(err, "Failed to list datasources")
+	}
+	return datasources, nil
+}
+
+// GetDatasource returns the datasource with the given UID.
+func (c *Client) GetDatasource(ctx context.Context, uid string) (*DataSource, error) {
+	ds := &DataSource{}
+	if err := c.do(ctx, http.MethodGet, "/api/datasources/uid/"+url.PathEscape(uid), nil, nil, ds); err != nil {
+		return nil, errors.Wrapf(err, "Failed to get datasource %v", uid)
+	}
+	return ds, nil
+}
+
+// ListFolders returns the folders.
+func (c *Client) ListFolders(ctx context.Context) ([]Folder, error) {
+	folders := make([]Folder, 0)
+	if err := c.do(ctx, http.MethodGet, "/api/folders", nil, nil, &folders); err != nil {
+		return nil, errors.Wrapf(err, "Failed to list folders")
+	}
+	return folders, nil
+}
+
+// GetFolder returns the folder with the given UID.
+func (c *Client) GetFolder(ctx context.Context, uid string) (*Folder, error) {
+	f := &Folder{}
+	if err := c.do(ctx, http.MethodGet, "/api/folders/"+url.PathEscape(uid), nil, nil, f); err != nil {
+		return nil, errors.Wrapf(err, "Failed to get folder %v", uid)
+	}
+	return f, nil
+}
+
+// CreateShortURL creates a short link for the given URL. The URL must be a URL on this Grafana instance.
+func (c *Client) CreateShortURL(ctx context.Context, longURL string) (*ShortURL, error) {
+	// The API expects the path relative to the Grafana instance e.g. "explore?orgId=1&panes=..."
+	relPath := strings.TrimPrefix(longURL, c.BaseURL)
+	if relPath == longURL && strings.Contains(longURL, "://") {
+		return nil, errors.Errorf("Can't shorten URL %v because it isn't on the Grafana instance %v", longURL, c.BaseURL)
+	}
+	relPath = strings.TrimPrefix(relPath, "/")
+
+	request := map[string]string{"path": relPath}
+	s := &ShortURL{}
+	if err := c.do(ctx, http.MethodPost, "/api/short-urls", nil, request, s); err != nil {
+		return nil, errors.Wrapf(err, "Failed to create short URL")
+	}
+	return s, nil
+}
+
+// IsShortURL returns true if the URL is a Grafana short link i.e. /goto/<uid>
+func IsShortURL(inputURL string) bool {
+	parsedURL, err := url.Parse(inputURL)
+	if err != nil {
+		return false
+	}
+	pieces := strings.Split(strings.Trim(parsedURL.Path, "/"), "/")
+	return len(pieces) >= 2 && pieces[len(pieces)-2] == "goto"
+}
+
+// shortURLUID returns the UID of the short link. It is an error if the short link isn't on this Grafana instance.
+func (c *Client) shortURLUID(shortURL string) (string, error) {
+	notShort := errors.Errorf("%v isn't a short link on %v; short links have the form %v/goto/<uid>", shortURL, c.BaseURL, c.BaseURL)
+	if !IsShortURL(shortURL) {
+		return "", notShort
+	}
+	u, err := url.Parse(shortURL)
+	if err != nil {
+		return "", notShort
+	}
+	base, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return "", errors.Wrapf(err, "Invalid base URL %v", c.BaseURL)
+	}
+	if !strings.EqualFold(u.Scheme, base.Scheme) || !strings.EqualFold(u.Host, base.Host) {
+		return "", notShort
+	}
+	uid, ok := strings.CutPrefix(u.Path, strings.TrimSuffix(base.Path, "/")+"/goto/")
+	uid = strings.TrimSuffix(uid, "/")
+	if !ok || uid == "" || strings.Contains(uid, "/") {
+		return "", notShort
+	}
+	return uid, nil
+}
+
+// ResolveShortURL returns the URL the short link redirects to.
+func (c *Client) ResolveShortURL(ctx context.Context, shortURL string) (string, error) {
+	uid, err := c.shortURLUID(shortURL)
+	if err != nil {
+		return "", err
+	}
+
+	// Build the request from BaseURL rather than using shortURL so that the credentials are only ever sent to the
+	// Grafana instance.
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(c.BaseURL, "/")+"/goto/"+url.PathEscape(uid), nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to create request for %v", shortURL)
+	}
+	c.setAuth(req)
+
+	// Don't follow the redirect; the location of the redirect is the URL we want.
+	httpClient := *c.HTTPClient
+	httpClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to resolve short URL %v", shortURL)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 300 || resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(resp.Body)
+		return "", errors.Wrapf(newAPIError(resp.StatusCode, body), "Grafana didn't redirect the short URL %v", shortURL)
+	}
+
+	location, err := resp.Location()
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to get the location that short URL %v redirects to", shortURL)
+	}
+	return location.String(), nil
+}
+
+// do sends a request to the API and decodes the JSON response into out.
+func (c *Client) do(ctx context.Context, method string, apiPath string, query url.Values, body any, out any) error {
+	log := zapr.NewLogger(zap.L())
+	u := c.BaseURL + apiPath
+	if len(query) > 0 {
+		u = u + "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to marshal the request body")
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to create request for %v", u)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	c.setAuth(req)
+
+	log.V(Debug).Info("Sending request to Grafana", "method", method, "url", u)
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to send %v request to %v", method, u)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read response body from %v", u)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return newAPIError(resp.StatusCode, respBody)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return errors.Wrapf(err, "Failed to decode response from %v", u)
+	}
+	return nil
+}
+
+func (c *Client) setAuth(req *http.Request) {
+	if c.Auth.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Auth.Token)
+		return
+	}
+	if c.Auth.Username != "" {
+		req.SetBasicAuth(c.Auth.Username, c.Auth.Password)
+	}
+}
+
+func newAPIError(statusCode int, body []byte) *APIError {
+	apiErr := &APIError{StatusCode: statusCode}
+	msg := struct {
+		Message string `json:"message"`
+	}{}
+	if err := json.Unmarshal(body, &msg); err == nil && msg.Message != "" {
+		apiErr.Message = msg.Message
+	} else {
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+	return apiErr
+}
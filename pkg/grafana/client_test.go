@@ -0,0 +1,255 @@
+package grafana
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/grafctl/api"
+)
+
+const (
+	testDashboard = `{
+  "uid": "abc123",
+  "title": "Service Overview",
+  "time": {"from": "now-6h", "to": "now"},
+  "panels": [
+    {
+      "id": 1,
+      "title": "Logs",
+      "type": "logs",
+      "datasource": {"type": "grafana-clickhouse-datasource", "uid": "someuid"},
+      "targets": [
+        {
+          "refId": "A",
+          "datasource": {"type": "grafana-clickhouse-datasource", "uid": "someuid"},
+          "editorType": "sql",
+          "rawSql": "SELECT * FROM logs",
+          "customarg": "customvalue"
+        }
+      ]
+    },
+    {
+      "id": 2,
+      "title": "Details",
+      "type": "row",
+      "collapsed": true,
+      "panels": [
+        {
+          "id": 3,
+          "title": "Legacy",
+          "type": "timeseries",
+          "datasource": "Prometheus",
+          "targets": [{"refId": "A"}]
+        }
+      ]
+    }
+  ]
+}`
+)
+
+func Test_ClientDashboards(t *testing.T) {
+	f := newFakeGrafana(t)
+	f.addDashboard(t, testDashboard)
+	c := f.client(t)
+	ctx := context.Background()
+
+	hits, err := c.Search(ctx, SearchOptions{Query: "service"})
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if len(hits) != 1 || hits[0].UID != "abc123" {
+		t.Fatalf("Unexpected search results: %+v", hits)
+	}
+
+	d, err := c.GetDashboard(ctx, "abc123")
+	if err != nil {
+		t.Fatalf("Failed to get dashboard: %v", err)
+	}
+
+	if d.Dashboard.Title != "Service Overview" {
+		t.Errorf("Got title %v; want Service Overview", d.Dashboard.Title)
+	}
+	if d.Meta.Slug != "some-slug" {
+		t.Errorf("Got slug %v; want some-slug", d.Meta.Slug)
+	}
+
+	if len(d.Dashboard.Panels) != 2 {
+		t.Fatalf("Got %v panels; want 2", len(d.Dashboard.Panels))
+	}
+
+	expectedTargets := []api.Query{
+		{
+			RefID: "A",
+			Datasource: api.Datasource{
+				Type: "grafana-clickhouse-datasource",
+				UID:  "someuid",
+			},
+			EditorType: "sql",
+			RawSQL:     "SELECT * FROM logs",
+			AdditionalFields: map[string]any{
+				"customarg": "customvalue",
+			},
+		},
+	}
+	if d := cmp.Diff(expectedTargets, d.Dashboard.Panels[0].Targets); d != "" {
+		t.Errorf("Unexpected diff in targets:\n%v", d)
+	}
+
+	ref, err := d.Dashboard.Panels[0].DatasourceRef()
+	if err != nil {
+		t.Fatalf("Failed to get datasource ref: %v", err)
+	}
+	if ref.UID != "someuid" {
+		t.Errorf("Got datasource %v; want someuid", ref.UID)
+	}
+
+	legacy, err := d.Dashboard.Panels[1].Panels[0].DatasourceRef()
+	if err != nil {
+		t.Fatalf("Failed to get datasource ref: %v", err)
+	}
+	if legacy.UID != "Prometheus" {
+		t.Errorf("Got datasource %v; want Prometheus", legacy.UID)
+	}
+
+	if _, err := c.GetDashboard(ctx, "missing"); !IsNotFound(err) {
+		t.Errorf("Expected a not found error; got %v", err)
+	}
+}
+
+func Test_ClientDatasourcesAndFolders(t *testing.T) {
+	f := newFakeGrafana(t)
+	f.datasources = []DataSource{
+		{ID: 1, UID: "someuid", Name: "ClickHouse", Type: "grafana-clickhouse-datasource"},
+		{ID: 2, UID: "prom", Name: "Prometheus", Type: "prometheus", IsDefault: true},
+	}
+	f.folders = []Folder{
+		{ID: 1, UID: "folder1", Title: "Services"},
+	}
+	c := f.client(t)
+	ctx := context.Background()
+
+	datasources, err := c.ListDatasources(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list datasources: %v", err)
+	}
+	if d := cmp.Diff(f.datasources, datasources); d != "" {
+		t.Errorf("Unexpected diff in datasources:\n%v", d)
+	}
+
+	ds, err := c.GetDatasource(ctx, "prom")
+	if err != nil {
+		t.Fatalf("Failed to get datasource: %v", err)
+	}
+	if ds.Name != "Prometheus" {
+		t.Errorf("Got datasource %v; want Prometheus", ds.Name)
+	}
+
+	folders, err := c.ListFolders(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list folders: %v", err)
+	}
+	if d := cmp.Diff(f.folders, folders); d != "" {
+		t.Errorf("Unexpected diff in folders:\n%v", d)
+	}
+
+	if _, err := c.GetFolder(ctx, "missing"); !IsNotFound(err) {
+		t.Errorf("Expected a not found error; got %v", err)
+	}
+}
+
+func Test_ClientShortURL(t *testing.T) {
+	f := newFakeGrafana(t)
+	c := f.client(t)
+
+	s, err := c.CreateShortURL(context.Background(), f.server.URL+"/explore?orgId=1")
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+	if f.shortURLs[s.UID] != "explore?orgId=1" {
+		t.Errorf("Got path %v; want explore?orgId=1", f.shortURLs[s.UID])
+	}
+
+	if _, err := c.CreateShortURL(context.Background(), "https://other.acme.com/explore"); err == nil {
+		t.Errorf("Expected an error shortening a URL on a different instance")
+	}
+
+	if !IsShortURL(s.URL) {
+		t.Fatalf("IsShortURL(%v) = false; want true", s.URL)
+	}
+
+	resolved, err := c.ResolveShortURL(context.Background(), s.URL)
+	if err != nil {
+		t.Fatalf("Failed to resolve short URL: %v", err)
+	}
+	if expected := f.server.URL + "/explore?orgId=1"; resolved != expected {
+		t.Errorf("Got %v; want %v", resolved, expected)
+	}
+
+	if _, err := c.ResolveShortURL(context.Background(), f.server.URL+"/goto/missing"); err == nil {
+		t.Errorf("Expected an error resolving a short URL that doesn't exist")
+	}
+}
+
+func Test_ResolveShortURLOtherHost(t *testing.T) {
+	f := newFakeGrafana(t)
+	c := f.client(t)
+
+	requests := 0
+	authHeaders := []string{}
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if h := r.Header.Get("Authorization"); h != "" {
+			authHeaders = append(authHeaders, h)
+		}
+		http.Redirect(w, r, "/explore", http.StatusFound)
+	}))
+	defer other.Close()
+
+	cases := []string{
+		other.URL + "/goto/abc",
+		strings.Replace(f.server.URL, "http://", "https://", 1) + "/goto/abc",
+		f.server.URL + "/other/goto/abc",
+	}
+	for _, u := range cases {
+		if _, err := c.ResolveShortURL(context.Background(), u); err == nil {
+			t.Errorf("Expected an error resolving %v which isn't on %v", u, c.BaseURL)
+		}
+	}
+	if requests != 0 || len(authHeaders) != 0 {
+		t.Errorf("Got %v requests with Authorization headers %v to the other host; want none", requests, authHeaders)
+	}
+}
+
+func Test_ClientAuth(t *testing.T) {
+	f := newFakeGrafana(t)
+
+	type testCase struct {
+		name      string
+		auth      Auth
+		expectErr bool
+	}
+
+	cases := []testCase{
+		{name: "token", auth: Auth{Token: fakeToken}},
+		{name: "basic", auth: Auth{Username: "admin", Password: "admin"}},
+		{name: "bad-token", auth: Auth{Token: "wrong"}, expectErr: true},
+		{name: "none", auth: Auth{}, expectErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := NewClient(f.server.URL, tc.auth)
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+			_, err = c.ListFolders(context.Background())
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("Got error %v; expected error %v", err, tc.expectErr)
+			}
+		})
+	}
+}
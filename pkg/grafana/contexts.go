@@ -0,0 +1,77 @@
+package grafana
+
+import (
+	"github.com/jlewi/grafctl/api"
+	"github.com/pkg/errors"
+)
+
+// Context is a Grafana instance links can be rebased onto so that the same templates can be used for every
+// environment e.g. prod and staging.
+type Context struct {
+	// Name is the name of the context.
+	Name string
+	// BaseURL is the URL of the instance. If it is empty the baseURL of the link is kept.
+	BaseURL string
+	// OrgID is the organization links open. If it is empty the orgId of the link is kept.
+	OrgID string
+	// Datasources maps datasource types (e.g. loki) to the UID of the default datasource of that type.
+	Datasources map[string]string
+}
+
+// Rebase rebases the link onto the context; it sets the baseURL and orgId of the link and switches the queries
+// whose datasource has one of the types in the context's datasources to the default datasource of that type.
+// Panes that use the datasource of a switched query are switched too.
+func Rebase(link *api.GrafanaLink, ctx Context) {
+	if ctx.BaseURL != "" {
+		link.BaseURL = ctx.BaseURL
+	}
+	if ctx.OrgID != "" {
+		link.OrgID = ctx.OrgID
+		if link.OrgID == defaultOrgID {
+			link.OrgID = ""
+		}
+	}
+	if len(ctx.Datasources) == 0 {
+		return
+	}
+
+	for paneID, pane := range link.Panes {
+		// uids maps the UIDs of the datasources in the pane to the UIDs of the datasources they are switched to.
+		uids := map[string]string{}
+		for i, q := range pane.Queries {
+			uid, ok := ctx.Datasources[q.Datasource.Type]
+			if !ok || uid == "" {
+				continue
+			}
+			if q.Datasource.UID != "" {
+				uids[q.Datasource.UID] = uid
+			}
+			pane.Queries[i].Datasource.UID = uid
+		}
+		if uid, ok := uids[pane.Datasource]; ok {
+			pane.Datasource = uid
+		}
+		link.Panes[paneID] = pane
+	}
+}
+
+// rebase rebases the link onto the context selected by the patch. The patch's context defaults to the patcher's
+// context. The link is unchanged if no context is selected.
+func (a *Patcher) rebase(link *api.GrafanaLink, patch api.PanePatch) error {
+	name := patch.Context
+	if name == "" {
+		name = a.Context
+	}
+	if name == "" {
+		return nil
+	}
+	names := make([]string, 0, len(a.Contexts))
+	for _, ctx := range a.Contexts {
+		if ctx.Name == name {
+			Rebase(link, ctx)
+			return nil
+		}
+		names = append(names, ctx.Name)
+	}
+	return errors.Errorf("There is no context named %v; the contexts are %v", name, names)
+}
@@ -0,0 +1,171 @@
+package grafana
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/grafctl/api"
+)
+
+func Test_Rebase(t *testing.T) {
+	newLink := func() *api.GrafanaLink {
+		return &api.GrafanaLink{
+			BaseURL: "https://grafana.acme.com",
+			OrgID:   "3",
+			Panes: api.Panes{
+				"a": {
+					Datasource: "prodloki",
+					Queries: []api.Query{
+						{RefID: "A", Datasource: api.Datasource{Type: api.LokiDatasourceType, UID: "prodloki"}},
+						{RefID: "B", Datasource: api.Datasource{Type: api.PrometheusDatasourceType, UID: "prodprom"}},
+					},
+				},
+			},
+		}
+	}
+
+	type testCase struct {
+		name     string
+		ctx      Context
+		expected *api.GrafanaLink
+	}
+
+	cases := []testCase{
+		{
+			name: "all",
+			ctx: Context{
+				BaseURL:     "https://grafana.staging.acme.com",
+				OrgID:       "2",
+				Datasources: map[string]string{api.LokiDatasourceType: "stagingloki"},
+			},
+			expected: &api.GrafanaLink{
+				BaseURL: "https://grafana.staging.acme.com",
+				OrgID:   "2",
+				Panes: api.Panes{
+					"a": {
+						Datasource: "stagingloki",
+						Queries: []api.Query{
+							{RefID: "A", Datasource: api.Datasource{Type: api.LokiDatasourceType, UID: "stagingloki"}},
+							{RefID: "B", Datasource: api.Datasource{Type: api.PrometheusDatasourceType, UID: "prodprom"}},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "default-org",
+			ctx: Context{
+				OrgID: "1",
+			},
+			expected: func() *api.GrafanaLink {
+				l := newLink()
+				l.OrgID = ""
+				return l
+			}(),
+		},
+		{
+			name:     "empty",
+			ctx:      Context{},
+			expected: newLink(),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			link := newLink()
+			Rebase(link, c.ctx)
+			if d := cmp.Diff(c.expected, link); d != "" {
+				t.Errorf("Unexpected diff:\n%v", d)
+			}
+		})
+	}
+}
+
+func Test_ApplyPatchWithContext(t *testing.T) {
+	base := func() []*api.GrafanaLink {
+		return []*api.GrafanaLink{
+			{
+				Metadata: api.Metadata{Name: "logs"},
+				BaseURL:  "https://grafana.acme.com",
+				Panes: api.Panes{
+					"a": {
+						Queries: []api.Query{
+							{RefID: "A", Datasource: api.Datasource{Type: api.LokiDatasourceType, UID: "prodloki"}},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	type testCase struct {
+		name      string
+		context   string
+		patch     api.PanePatch
+		baseURL   string
+		orgID     string
+		expectErr bool
+	}
+
+	cases := []testCase{
+		{
+			name:    "no-context",
+			patch:   api.PanePatch{Template: "logs", Query: map[string]interface{}{"expr": "{}"}},
+			baseURL: "https://grafana.acme.com",
+		},
+		{
+			name:    "current-context",
+			context: "staging",
+			patch:   api.PanePatch{Template: "logs", Query: map[string]interface{}{"expr": "{}"}},
+			baseURL: "https://grafana.staging.acme.com",
+			orgID:   "2",
+		},
+		{
+			name:    "patch-context",
+			context: "staging",
+			patch:   api.PanePatch{Template: "logs", Context: "onprem", Query: map[string]interface{}{"expr": "{}"}},
+			baseURL: "https://grafana.customer.com",
+		},
+		{
+			name:    "patch-overrides-context",
+			context: "staging",
+			patch:   api.PanePatch{Template: "logs", OrgID: "5", Query: map[string]interface{}{"expr": "{}"}},
+			baseURL: "https://grafana.staging.acme.com",
+			orgID:   "5",
+		},
+		{
+			name:      "unknown-context",
+			patch:     api.PanePatch{Template: "logs", Context: "dev", Query: map[string]interface{}{"expr": "{}"}},
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			patcher := NewPatcher(FakeClock{})
+			patcher.Contexts = []Context{
+				{Name: "staging", BaseURL: "https://grafana.staging.acme.com", OrgID: "2"},
+				{Name: "onprem", BaseURL: "https://grafana.customer.com"},
+			}
+			patcher.Context = c.context
+
+			c.patch.Range = api.TimeRange{From: "now-1h", To: "now"}
+			link, err := patcher.ApplyPatch(base(), c.patch)
+			if c.expectErr {
+				if err == nil {
+					t.Fatalf("Expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to apply patch: %+v", err)
+			}
+			if link.BaseURL != c.baseURL {
+				t.Errorf("Got baseURL %v; want %v", link.BaseURL, c.baseURL)
+			}
+			if link.OrgID != c.orgID {
+				t.Errorf("Got orgId %v; want %v", link.OrgID, c.orgID)
+			}
+		})
+	}
+}
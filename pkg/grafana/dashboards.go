@@ -0,0 +1,138 @@
+package grafana
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/jlewi/grafctl/api"
+	"github.com/pkg/errors"
+)
+
+const (
+	// varPrefix is the prefix of query parameters holding the values of dashboard template variables.
+	varPrefix = "var-"
+)
+
+// GetDashboardLink returns a link to the dashboard.
+func GetDashboardLink(baseUrl string, orgId string, dashboard api.Dashboard) (string, error) {
+	queryParams := url.Values{}
+	queryParams.Add("orgId", orgId)
+	return dashboardURL(baseUrl, queryParams, dashboard)
+}
+
+// dashboardURL returns a link to the dashboard. queryParams are the other query parameters of the link.
+func dashboardURL(baseUrl string, queryParams url.Values, dashboard api.Dashboard) (string, error) {
+	if dashboard.UID == "" {
+		return "", errors.New("Dashboard UID must be set to generate a dashboard link")
+	}
+
+	for name, values := range dashboard.Variables {
+		for _, v := range values {
+			queryParams.Add(varPrefix+name, v)
+		}
+	}
+
+	if dashboard.ViewPanel != "" {
+		queryParams.Add("viewPanel", dashboard.ViewPanel)
+	}
+	if dashboard.Range.From != "" {
+		queryParams.Add("from", dashboard.Range.From)
+	}
+	if dashboard.Range.To != "" {
+		queryParams.Add("to", dashboard.Range.To)
+	}
+	if dashboard.Refresh != "" {
+		queryParams.Add("refresh", dashboard.Refresh)
+	}
+	if dashboard.Timezone != "" {
+		queryParams.Add("timezone", dashboard.Timezone)
+	}
+
+	dashboardPath := "d/" + url.PathEscape(dashboard.UID)
+	if dashboard.Slug != "" {
+		dashboardPath = dashboardPath + "/" + url.PathEscape(dashboard.Slug)
+	}
+
+	u := fmt.Sprintf("%s/%s?%s", baseUrl, dashboardPath, queryParams.Encode())
+	return u, nil
+}
+
+// IsDashboardURL returns true if the URL is a link to a dashboard (i.e. /d/<uid>/<slug>) rather than Explore.
+func IsDashboardURL(inputURL string) bool {
+	parsedURL, err := url.Parse(inputURL)
+	if err != nil {
+		return false
+	}
+	_, _, _, ok := splitDashboardPath(parsedURL.Path)
+	return ok
+}
+
+// ParseDashboardURL parses a link to a dashboard and returns
+// baseUrl - The base URL
+// a map of query parameters other than the ones stored in the dashboard
+// The dashboard.
+func ParseDashboardURL(inputURL string) (string, map[string][]string, *api.Dashboard, error) {
+	parsedURL, err := url.Parse(inputURL)
+	if err != nil {
+		return "", nil, nil, errors.Wrapf(err, "failed to parse URL: %v", inputURL)
+	}
+
+	prefix, uid, slug, ok := splitDashboardPath(parsedURL.Path)
+	if !ok {
+		return "", nil, nil, errors.Errorf("URL %v isn't a link to a dashboard; expected a path of the form /d/<uid>/<slug>", inputURL)
+	}
+
+	dashboard := &api.Dashboard{
+		UID:  uid,
+		Slug: slug,
+	}
+
+	queryArgs := map[string][]string{}
+	for key, value := range parsedURL.Query() {
+		switch {
+		case strings.HasPrefix(key, varPrefix):
+			if dashboard.Variables == nil {
+				dashboard.Variables = map[string][]string{}
+			}
+			dashboard.Variables[strings.TrimPrefix(key, varPrefix)] = value
+		case key == "viewPanel":
+			dashboard.ViewPanel = value[0]
+		case key == "from":
+			dashboard.Range.From = value[0]
+		case key == "to":
+			dashboard.Range.To = value[0]
+		case key == "refresh":
+			dashboard.Refresh = value[0]
+		case key == "timezone":
+			dashboard.Timezone = value[0]
+		default:
+			queryArgs[key] = value
+		}
+	}
+
+	baseURL := fmt.Sprintf("%s://%s%s", parsedURL.Scheme, parsedURL.Host, prefix)
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	return baseURL, queryArgs, dashboard, nil
+}
+
+// splitDashboardPath splits the path of a dashboard link into the prefix (e.g. if grafana is served from a subpath),
+// the uid and the slug. ok is false if the path isn't the path of a dashboard.
+func splitDashboardPath(p string) (string, string, string, bool) {
+	pieces := strings.Split(strings.Trim(p, "/"), "/")
+	for i, piece := range pieces {
+		if piece != "d" || i+1 >= len(pieces) {
+			continue
+		}
+		prefix := ""
+		if i > 0 {
+			prefix = "/" + strings.Join(pieces[:i], "/")
+		}
+		slug := ""
+		if i+2 < len(pieces) {
+			slug = pieces[i+2]
+		}
+		return prefix, pieces[i+1], slug, true
+	}
+	return "", "", "", false
+}
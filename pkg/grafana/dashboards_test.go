@@ -0,0 +1,183 @@
+package grafana
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/grafctl/api"
+)
+
+func Test_GetDashboardLink(t *testing.T) {
+	type testCase struct {
+		Name      string
+		BaseURL   string
+		Dashboard api.Dashboard
+		Expected  string
+	}
+
+	cases := []testCase{
+		{
+			Name:    "basic",
+			BaseURL: "https://grafana.acme.com",
+			Dashboard: api.Dashboard{
+				UID:  "abc123",
+				Slug: "service-overview",
+				Variables: map[string][]string{
+					"service": {"foyle"},
+					"cluster": {"prod", "staging"},
+				},
+				ViewPanel: "2",
+				Range: api.TimeRange{
+					From: "now-6h",
+					To:   "now",
+				},
+				Refresh: "30s",
+			},
+			Expected: "https://grafana.acme.com/d/abc123/service-overview?from=now-6h&orgId=1&refresh=30s&to=now&var-cluster=prod&var-cluster=staging&var-service=foyle&viewPanel=2",
+		},
+		{
+			Name:    "no-slug",
+			BaseURL: "https://grafana.acme.com",
+			Dashboard: api.Dashboard{
+				UID: "abc123",
+			},
+			Expected: "https://grafana.acme.com/d/abc123?orgId=1",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			actual, err := GetDashboardLink(c.BaseURL, "1", c.Dashboard)
+			if err != nil {
+				t.Fatalf("Error calling GetDashboardLink: %v", err)
+			}
+
+			if actual != c.Expected {
+				t.Errorf("Got %v;\n Want %v", actual, c.Expected)
+			}
+		})
+	}
+}
+
+func Test_ParseDashboardURL(t *testing.T) {
+	type testCase struct {
+		Name          string
+		Input         string
+		ExpectedBase  string
+		ExpectedArgs  map[string][]string
+		ExpectedBoard *api.Dashboard
+	}
+
+	cases := []testCase{
+		{
+			Name:         "basic",
+			Input:        "https://grafana.acme.com/d/abc123/service-overview?orgId=1&var-service=foyle&var-cluster=prod&var-cluster=staging&from=now-6h&to=now&viewPanel=2&refresh=30s",
+			ExpectedBase: "https://grafana.acme.com",
+			ExpectedArgs: map[string][]string{
+				"orgId": {"1"},
+			},
+			ExpectedBoard: &api.Dashboard{
+				UID:  "abc123",
+				Slug: "service-overview",
+				Variables: map[string][]string{
+					"service": {"foyle"},
+					"cluster": {"prod", "staging"},
+				},
+				ViewPanel: "2",
+				Range: api.TimeRange{
+					From: "now-6h",
+					To:   "now",
+				},
+				Refresh: "30s",
+			},
+		},
+		{
+			Name:         "subpath",
+			Input:        "https://acme.com/grafana/d/abc123?orgId=2",
+			ExpectedBase: "https://acme.com/grafana",
+			ExpectedArgs: map[string][]string{
+				"orgId": {"2"},
+			},
+			ExpectedBoard: &api.Dashboard{
+				UID: "abc123",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			baseUrl, queryArgs, dashboard, err := ParseDashboardURL(c.Input)
+			if err != nil {
+				t.Fatalf("Error calling ParseDashboardURL: %v", err)
+			}
+
+			if baseUrl != c.ExpectedBase {
+				t.Errorf("Got %v;\n Want %v", baseUrl, c.ExpectedBase)
+			}
+
+			if d := cmp.Diff(c.ExpectedArgs, queryArgs); d != "" {
+				t.Errorf("Unexpected diff in query args:\n%v", d)
+			}
+
+			if d := cmp.Diff(c.ExpectedBoard, dashboard); d != "" {
+				t.Errorf("Unexpected diff in dashboard:\n%v", d)
+			}
+		})
+	}
+}
+
+func Test_IsDashboardURL(t *testing.T) {
+	cases := map[string]bool{
+		"https://grafana.acme.com/d/abc123/service-overview?orgId=1": true,
+		"https://grafana.acme.com/explore?orgId=1&panes=%7B%7D":      false,
+		"https://grafana.acme.com/d/":                                false,
+	}
+
+	for input, expected := range cases {
+		if actual := IsDashboardURL(input); actual != expected {
+			t.Errorf("IsDashboardURL(%v) = %v; want %v", input, actual, expected)
+		}
+	}
+}
+
+func Test_URLToLinkOrgID(t *testing.T) {
+	type testCase struct {
+		name     string
+		input    string
+		expected string
+	}
+
+	cases := []testCase{
+		{
+			name:     "default-org",
+			input:    "https://grafana.acme.com/d/abc123?orgId=1",
+			expected: "",
+		},
+		{
+			name:     "other-org",
+			input:    "https://grafana.acme.com/d/abc123?orgId=2",
+			expected: "2",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			link, err := URLToLink(c.input)
+			if err != nil {
+				t.Fatalf("Failed to convert URL to link: %v", err)
+			}
+			if link.OrgID != c.expected {
+				t.Errorf("Got orgId %v; want %v", link.OrgID, c.expected)
+			}
+
+			// The link opens the same organization as the URL.
+			u, err := LinkToURL(*link)
+			if err != nil {
+				t.Fatalf("Failed to convert link to URL: %v", err)
+			}
+			if u != c.input {
+				t.Errorf("Got URL %v; want %v", u, c.input)
+			}
+		})
+	}
+}
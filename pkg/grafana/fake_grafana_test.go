@@ -0,0 +1,209 @@
+package grafana
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	fakeToken = "fake-token"
+)
+
+// fakeGrafana is a fake implementation of the Grafana HTTP API for tests.
+type fakeGrafana struct {
+	server *httptest.Server
+
+	mu          sync.Mutex
+	dashboards  map[string]map[string]any
+	datasources []DataSource
+	folders     []Folder
+	// shortURLs maps the uid of a short URL to the path it points to.
+	shortURLs map[string]string
+	// queries are the bodies of the requests to the query API.
+	queries []map[string]any
+	// queryResponse is the response to return from the query API.
+	queryResponse *QueryResponse
+}
+
+// newFakeGrafana starts a fake Grafana server. The server is stopped when the test finishes.
+func newFakeGrafana(t *testing.T) *fakeGrafana {
+	f := &fakeGrafana{
+		dashboards: map[string]map[string]any{},
+		shortURLs:  map[string]string{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/search", f.search)
+	mux.HandleFunc("GET /api/dashboards/uid/{uid}", f.getDashboard)
+	mux.HandleFunc("GET /api/datasources", f.listDatasources)
+	mux.HandleFunc("GET /api/datasources/uid/{uid}", f.getDatasource)
+	mux.HandleFunc("GET /api/folders", f.listFolders)
+	mux.HandleFunc("GET /api/folders/{uid}", f.getFolder)
+	mux.HandleFunc("POST /api/short-urls", f.createShortURL)
+	mux.HandleFunc("GET /goto/{uid}", f.gotoShortURL)
+	mux.HandleFunc("POST /api/ds/query", f.query)
+
+	f.server = httptest.NewServer(f.authenticate(mux))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// client returns a client for the fake server.
+func (f *fakeGrafana) client(t *testing.T) *Client {
+	c, err := NewClient(f.server.URL, Auth{Token: fakeToken})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	return c
+}
+
+// addDashboard adds a dashboard given its JSON model.
+func (f *fakeGrafana) addDashboard(t *testing.T, model string) {
+	d := map[string]any{}
+	if err := json.Unmarshal([]byte(model), &d); err != nil {
+		t.Fatalf("Failed to unmarshal dashboard: %v", err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.dashboards[d["uid"].(string)] = d
+}
+
+func (f *fakeGrafana) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, hasBasic := r.BasicAuth()
+		switch {
+		case r.Header.Get("Authorization") == "Bearer "+fakeToken:
+		case hasBasic && user == "admin" && password == "admin":
+		default:
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"message": "Unauthorized"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (f *fakeGrafana) search(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	query := strings.ToLower(r.URL.Query().Get("query"))
+	hits := make([]SearchHit, 0)
+	for uid, d := range f.dashboards {
+		title, _ := d["title"].(string)
+		if !strings.Contains(strings.ToLower(title), query) {
+			continue
+		}
+		hits = append(hits, SearchHit{UID: uid, Title: title, Type: "dash-db", URL: "/d/" + uid})
+	}
+	writeJSON(w, http.StatusOK, hits)
+}
+
+func (f *fakeGrafana) getDashboard(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d, ok := f.dashboards[r.PathValue("uid")]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Dashboard not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"dashboard": d,
+		"meta": DashboardMeta{
+			Slug: "some-slug",
+			URL:  "/d/" + r.PathValue("uid") + "/some-slug",
+		},
+	})
+}
+
+func (f *fakeGrafana) listDatasources(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	writeJSON(w, http.StatusOK, f.datasources)
+}
+
+func (f *fakeGrafana) getDatasource(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, ds := range f.datasources {
+		if ds.UID == r.PathValue("uid") {
+			writeJSON(w, http.StatusOK, ds)
+			return
+		}
+	}
+	writeJSON(w, http.StatusNotFound, map[string]string{"message": "Data source not found"})
+}
+
+func (f *fakeGrafana) listFolders(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	writeJSON(w, http.StatusOK, f.folders)
+}
+
+func (f *fakeGrafana) getFolder(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, folder := range f.folders {
+		if folder.UID == r.PathValue("uid") {
+			writeJSON(w, http.StatusOK, folder)
+			return
+		}
+	}
+	writeJSON(w, http.StatusNotFound, map[string]string{"message": "Folder not found"})
+}
+
+func (f *fakeGrafana) createShortURL(w http.ResponseWriter, r *http.Request) {
+	req := map[string]string{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": "bad request"})
+		return
+	}
+	if strings.HasPrefix(req["path"], "/") || strings.Contains(req["path"], "://") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": "Path should be relative"})
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	uid := fmt.Sprintf("short%d", len(f.shortURLs))
+	f.shortURLs[uid] = req["path"]
+	writeJSON(w, http.StatusOK, ShortURL{UID: uid, URL: f.server.URL + "/goto/" + uid + "?orgId=1"})
+}
+
+func (f *fakeGrafana) gotoShortURL(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.shortURLs[r.PathValue("uid")]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Short URL not found"})
+		return
+	}
+	http.Redirect(w, r, "/"+p, http.StatusFound)
+}
+
+func (f *fakeGrafana) query(w http.ResponseWriter, r *http.Request) {
+	req := map[string]any{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": "bad request"})
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries = append(f.queries, req)
+	if f.queryResponse == nil {
+		writeJSON(w, http.StatusOK, QueryResponse{Results: map[string]QueryResult{}})
+		return
+	}
+	writeJSON(w, http.StatusOK, f.queryResponse)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,132 @@
+package grafana
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jlewi/grafctl/api"
+	"github.com/pkg/errors"
+)
+
+var (
+	// variableRefRe matches references to template variables i.e. $name, ${name} and [[name]]
+	variableRefRe = regexp.MustCompile(`^(?:\$\{([^}:]+)(?::[^}]*)?\}|\$(\w+)|\[\[(\w+)\]\])$`)
+	nonSlugRe     = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// FindPanel returns the panel with the given ID. Panels nested inside collapsed rows are included in the search.
+func FindPanel(panels []Panel, id int) (*Panel, bool) {
+	for i := range panels {
+		if panels[i].ID == id {
+			return &panels[i], true
+		}
+		if p, ok := FindPanel(panels[i].Panels, id); ok {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// QueryPanels returns all the panels with queries; rows and panels without targets (e.g. text panels) are skipped.
+func QueryPanels(panels []Panel) []Panel {
+	results := make([]Panel, 0, len(panels))
+	for _, p := range panels {
+		if len(p.Targets) > 0 {
+			results = append(results, p)
+		}
+		results = append(results, QueryPanels(p.Panels)...)
+	}
+	return results
+}
+
+// PanelToLink creates a GrafanaLink for an Explore view of the queries in a panel of the dashboard.
+// Datasources that refer to datasource variables are resolved using the current values of the variables.
+func PanelToLink(baseURL string, dashboard DashboardModel, panel Panel) (*api.GrafanaLink, error) {
+	if len(panel.Targets) == 0 {
+		return nil, errors.Errorf("Panel %v (%v) doesn't have any queries", panel.ID, panel.Title)
+	}
+
+	panelDS, err := panel.DatasourceRef()
+	if err != nil {
+		return nil, err
+	}
+	panelDS.UID, err = resolveVariable(dashboard, panelDS.UID)
+	if err != nil {
+		return nil, err
+	}
+
+	queries := make([]api.Query, 0, len(panel.Targets))
+	for _, t := range panel.Targets {
+		if t.Datasource.UID == "" {
+			t.Datasource = panelDS
+		}
+		t.Datasource.UID, err = resolveVariable(dashboard, t.Datasource.UID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to resolve the datasource of query %v", t.RefID)
+		}
+		queries = append(queries, t)
+	}
+
+	paneDS := panelDS.UID
+	if paneDS == "" {
+		paneDS = queries[0].Datasource.UID
+	}
+
+	link := &api.GrafanaLink{
+		APIVersion: api.LinkGVK.GroupVersion().String(),
+		Kind:       api.LinkGVK.Kind,
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Panes: api.Panes{
+			fmt.Sprintf("panel%d", panel.ID): api.PaneBody{
+				Datasource: paneDS,
+				Queries:    queries,
+				Range:      dashboard.Time,
+			},
+		},
+	}
+	if dashboard.Timezone != "" && dashboard.Timezone != "browser" {
+		link.Timezone = dashboard.Timezone
+	}
+	return link, nil
+}
+
+// PanelLinkName returns the default name for the link created from a panel; it is derived from the titles of the
+// dashboard and the panel and the ID of the panel. The ID is included because panels in different rows often have
+// the same title.
+func PanelLinkName(dashboard DashboardModel, panel Panel) string {
+	title := panel.Title
+	if title == "" {
+		title = "panel"
+	}
+	return Slugify(fmt.Sprintf("%v-%v-%d", dashboard.Title, title, panel.ID))
+}
+
+// Slugify converts s into a string that can be used as a file name and resource name.
+func Slugify(s string) string {
+	return strings.Trim(nonSlugRe.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+// resolveVariable resolves value if it is a reference to a template variable; otherwise it is returned unchanged.
+func resolveVariable(dashboard DashboardModel, value string) (string, error) {
+	m := variableRefRe.FindStringSubmatch(value)
+	if m == nil {
+		return value, nil
+	}
+	name := m[1] + m[2] + m[3]
+	for _, v := range dashboard.Templating.List {
+		if v.Name != name {
+			continue
+		}
+		switch current := v.Current.Value.(type) {
+		case string:
+			return current, nil
+		case []any:
+			if len(current) == 1 {
+				return fmt.Sprintf("%v", current[0]), nil
+			}
+		}
+		return "", errors.Errorf("Variable %v doesn't have a single current value", name)
+	}
+	return "", errors.Errorf("Dashboard %v doesn't have a variable named %v", dashboard.UID, name)
+}
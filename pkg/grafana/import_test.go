@@ -0,0 +1,137 @@
+package grafana
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/grafctl/api"
+)
+
+func Test_PanelToLink(t *testing.T) {
+	type testCase struct {
+		name      string
+		dashboard string
+		panelID   int
+		expected  *api.GrafanaLink
+	}
+
+	cases := []testCase{
+		{
+			name:      "basic",
+			dashboard: testDashboard,
+			panelID:   1,
+			expected: &api.GrafanaLink{
+				APIVersion: api.LinkGVK.GroupVersion().String(),
+				Kind:       api.LinkGVK.Kind,
+				BaseURL:    "https://grafana.acme.com",
+				Panes: api.Panes{
+					"panel1": api.PaneBody{
+						Datasource: "someuid",
+						Queries: []api.Query{
+							{
+								RefID: "A",
+								Datasource: api.Datasource{
+									Type: "grafana-clickhouse-datasource",
+									UID:  "someuid",
+								},
+								EditorType: "sql",
+								RawSQL:     "SELECT * FROM logs",
+								AdditionalFields: map[string]any{
+									"customarg": "customvalue",
+								},
+							},
+						},
+						Range: api.TimeRange{
+							From: "now-6h",
+							To:   "now",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "datasource-variable",
+			dashboard: `{
+  "uid": "vars",
+  "title": "Variables",
+  "time": {"from": "now-1h", "to": "now"},
+  "timezone": "utc",
+  "templating": {"list": [{"name": "ds", "type": "datasource", "current": {"value": "promuid"}}]},
+  "panels": [
+    {
+      "id": 7,
+      "title": "Requests",
+      "datasource": {"type": "prometheus", "uid": "${ds}"},
+      "targets": [{"refId": "A", "expr": "rate(requests_total[5m])"}]
+    }
+  ]
+}`,
+			panelID: 7,
+			expected: &api.GrafanaLink{
+				APIVersion: api.LinkGVK.GroupVersion().String(),
+				Kind:       api.LinkGVK.Kind,
+				BaseURL:    "https://grafana.acme.com",
+				Timezone:   "utc",
+				Panes: api.Panes{
+					"panel7": api.PaneBody{
+						Datasource: "promuid",
+						Queries: []api.Query{
+							{
+								RefID: "A",
+								Datasource: api.Datasource{
+									Type: "prometheus",
+									UID:  "promuid",
+								},
+								Expr:             "rate(requests_total[5m])",
+								AdditionalFields: map[string]any{},
+							},
+						},
+						Range: api.TimeRange{
+							From: "now-1h",
+							To:   "now",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dashboard := DashboardModel{}
+			if err := json.Unmarshal([]byte(c.dashboard), &dashboard); err != nil {
+				t.Fatalf("Failed to unmarshal dashboard: %v", err)
+			}
+			panel, ok := FindPanel(dashboard.Panels, c.panelID)
+			if !ok {
+				t.Fatalf("Panel %v not found", c.panelID)
+			}
+			actual, err := PanelToLink("https://grafana.acme.com/", dashboard, *panel)
+			if err != nil {
+				t.Fatalf("Failed to convert panel to link: %v", err)
+			}
+			if d := cmp.Diff(c.expected, actual); d != "" {
+				t.Errorf("Unexpected diff:\n%v", d)
+			}
+		})
+	}
+}
+
+func Test_QueryPanels(t *testing.T) {
+	dashboard := DashboardModel{}
+	if err := json.Unmarshal([]byte(testDashboard), &dashboard); err != nil {
+		t.Fatalf("Failed to unmarshal dashboard: %v", err)
+	}
+
+	panels := QueryPanels(dashboard.Panels)
+	names := make([]string, 0, len(panels))
+	for _, p := range panels {
+		names = append(names, PanelLinkName(dashboard, p))
+	}
+
+	expected := []string{"service-overview-logs-1", "service-overview-legacy-3"}
+	if d := cmp.Diff(expected, names); d != "" {
+		t.Errorf("Unexpected diff:\n%v", d)
+	}
+}
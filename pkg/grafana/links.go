@@ -1,8 +1,10 @@
 package grafana
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"path"
@@ -13,28 +15,37 @@ import (
 	"github.com/jlewi/monogo/yamlfiles"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
 )
 
 func LinkToURL(link api.GrafanaLink) (string, error) {
-	// TODO(jeremy): Rather than hard coding orgid should we add it to GrafanaLink and include it in the URL?
-	return GetLogsLink(link.BaseURL, "1", link.Panes)
+	queryParams, err := linkQueryParams(link)
+	if err != nil {
+		return "", err
+	}
+	if link.Dashboard != nil {
+		return dashboardURL(link.BaseURL, queryParams, *link.Dashboard)
+	}
+	return exploreURL(link.BaseURL, queryParams, link.Panes)
 }
 
 // GetLogsLink returns a link to the Datadog logs matching the given query.
 func GetLogsLink(baseUrl string, orgId string, panes api.Panes) (string, error) {
-	// Create a new url.Values object
 	queryParams := url.Values{}
-
 	queryParams.Add("orgId", orgId)
-	queryParams.Add("schemaVersion", "1")
+	queryParams.Add("schemaVersion", defaultSchemaVersion)
+	return exploreURL(baseUrl, queryParams, panes)
+}
 
+// exploreURL returns a link to Explore showing the panes. queryParams are the other query parameters of the link.
+func exploreURL(baseUrl string, queryParams url.Values, panes api.Panes) (string, error) {
 	panesData, err := json.Marshal(panes)
 
 	if err != nil {
 		return "", errors.Wrapf(err, "Error marshalling panes data")
 	}
 
-	queryParams.Add("panes", string(panesData))
+	queryParams.Set("panes", string(panesData))
 
 	// Encode the values into a query string
 	encodedQuery := queryParams.Encode()
@@ -85,13 +96,18 @@ func ParseURL(inputURL string) (string, map[string][]string, []*api.Panes, error
 	return baseURL, queryArgs, panes, nil
 }
 
-// URLToLink converts a URL to a GrafanaLink
+// URLToLink converts a URL to a GrafanaLink. The URL can be a link to Explore or to a dashboard.
 func URLToLink(logUrl string) (*api.GrafanaLink, error) {
+	if IsDashboardURL(logUrl) {
+		return dashboardURLToLink(logUrl)
+	}
+
 	baseUrl, queryParams, panes, err := ParseURL(logUrl)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Fprintf(os.Stdout, "Query Arguments:\n%v\n", queryParams)
+	log := zapr.NewLogger(zap.L())
+	log.V(1).Info("Parsed URL", "queryArgs", queryParams)
 
 	if len(panes) == 0 {
 		return nil, errors.New("No panes found in URL")
@@ -107,38 +123,93 @@ func URLToLink(logUrl string) (*api.GrafanaLink, error) {
 		BaseURL:    baseUrl,
 		Panes:      *panes[0],
 	}
+	setURLOptions(link, queryParams)
+	return link, nil
+}
+
+func dashboardURLToLink(dashboardUrl string) (*api.GrafanaLink, error) {
+	baseUrl, queryParams, dashboard, err := ParseDashboardURL(dashboardUrl)
+	if err != nil {
+		return nil, err
+	}
+	log := zapr.NewLogger(zap.L())
+	log.V(1).Info("Parsed URL", "queryArgs", queryParams)
+
+	link := &api.GrafanaLink{
+		APIVersion: api.LinkGVK.GroupVersion().String(),
+		Kind:       api.LinkGVK.Kind,
+		BaseURL:    baseUrl,
+		Dashboard:  dashboard,
+	}
+	setURLOptions(link, queryParams)
 	return link, nil
 }
 
 // LoadGrafanaLinksInDir looks for YAML files in the given directory containing GrafanaLink resources
 func LoadGrafanaLinksInDir(dir string) ([]*api.GrafanaLink, error) {
+	return loadResourcesInDir(dir, api.LinkGVK.Kind, DecodeGrafanaLink)
+}
+
+// LoadLinkBundlesInDir looks for YAML files in the given directory containing LinkBundle resources
+func LoadLinkBundlesInDir(dir string) ([]*api.LinkBundle, error) {
+	return loadResourcesInDir(dir, api.BundleGVK.Kind, DecodeLinkBundle)
+}
+
+// loadResourcesInDir loads all the resources of the kind in the YAML files in dir. decode converts the resources to
+// the current version. Files and resources that can't be read are logged and skipped.
+func loadResourcesInDir[T any](dir string, kind string, decode func(*yaml.Node) (*T, error)) ([]*T, error) {
 	log := zapr.NewLogger(zap.L())
 	files, err := yamlfiles.Find(dir)
 	if err != nil {
 		return nil, errors.Wrapf(err, "Error finding files in %v", dir)
 	}
 
-	links := make([]*api.GrafanaLink, 0)
+	resources := make([]*T, 0)
 	for _, f := range files {
-		nodes, err := yamlfiles.Read(f)
+		docs, err := readYAMLDocuments(f)
 		if err != nil {
 			log.Error(err, "Error reading file", "file", f)
 			continue
 		}
 
-		for _, node := range nodes {
-			if node.GetKind() != api.LinkGVK.Kind {
+		for _, doc := range docs {
+			meta := struct {
+				Kind     string       `yaml:"kind"`
+				Metadata api.Metadata `yaml:"metadata"`
+			}{}
+			if err := doc.Decode(&meta); err != nil || meta.Kind != kind {
 				continue
 			}
 
-			link := &api.GrafanaLink{}
-			if err := node.YNode().Decode(link); err != nil {
-				log.Error(err, "Failed to decode GrafanaLink", "file", "name", node.GetName())
+			r, err := decode(doc)
+			if err != nil {
+				log.Error(err, "Failed to decode resource", "kind", kind, "file", f, "name", meta.Metadata.Name)
 				continue
 			}
-			links = append(links, link)
+			resources = append(resources, r)
 		}
 	}
 
-	return links, nil
+	return resources, nil
+}
+
+// readYAMLDocuments reads all the documents in the YAML file.
+func readYAMLDocuments(path string) ([]*yaml.Node, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read file %v", path)
+	}
+	docs := make([]*yaml.Node, 0)
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		doc := &yaml.Node{}
+		err := decoder.Decode(doc)
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to decode YAML in %v", path)
+		}
+		docs = append(docs, doc)
+	}
 }
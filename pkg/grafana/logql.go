@@ -0,0 +1,78 @@
+package grafana
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	LineContains       = "|="
+	LineNotContains    = "!="
+	LineMatchesRegexp  = "|~"
+	LineNotMatchRegexp = "!~"
+)
+
+var (
+	lineFilterOps = []string{LineContains, LineNotContains, LineMatchesRegexp, LineNotMatchRegexp}
+)
+
+// LineFilter is a LogQL line filter e.g. |= "error"
+type LineFilter struct {
+	Op    string
+	Value string
+}
+
+func (f LineFilter) String() string {
+	return f.Op + " " + strconv.Quote(f.Value)
+}
+
+// NewLineFilter returns a line filter; op defaults to |=.
+func NewLineFilter(op string, value string) (LineFilter, error) {
+	if op == "" {
+		op = LineContains
+	}
+	for _, o := range lineFilterOps {
+		if o == op {
+			return LineFilter{Op: op, Value: value}, nil
+		}
+	}
+	return LineFilter{}, errors.Errorf("Invalid line filter operator %v; operator must be one of %v", op, lineFilterOps)
+}
+
+// BuildLogQL composes a LogQL query from label matchers and line filters
+// e.g. {service="app", level="error"} |= "timeout"
+//
+// If expr is empty a new query is built; Loki requires at least one label matcher. Otherwise the matchers are
+// added to every stream selector in expr, replacing the existing matchers for the same labels, and the line filters
+// are added right after each stream selector.
+func BuildLogQL(expr string, matchers []LabelMatcher, filters []LineFilter) (string, error) {
+	if strings.TrimSpace(expr) == "" {
+		if len(matchers) == 0 {
+			return "", errors.New("Unable to build a LogQL query without a label matcher; a stream selector needs at least one label matcher")
+		}
+		expr = "{}"
+	}
+
+	spans, err := findSelectors(expr)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to parse LogQL expression")
+	}
+	if len(spans) == 0 {
+		return "", errors.Errorf("LogQL expression %v doesn't have a stream selector", expr)
+	}
+
+	pipeline := ""
+	for _, f := range filters {
+		pipeline += " " + f.String()
+	}
+
+	result, err := rewriteSelectors(expr, func(existing []LabelMatcher) string {
+		return formatSelector(mergeMatchers(existing, matchers)) + pipeline
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to parse LogQL expression")
+	}
+	return result, nil
+}
@@ -0,0 +1,130 @@
+package grafana
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/grafctl/api"
+)
+
+func Test_BuildLogQL(t *testing.T) {
+	type testCase struct {
+		name      string
+		expr      string
+		matchers  []LabelMatcher
+		filters   []LineFilter
+		expected  string
+		expectErr bool
+	}
+
+	cases := []testCase{
+		{
+			name:     "new",
+			matchers: []LabelMatcher{{Name: "service", Op: "=", Value: "app"}},
+			filters:  []LineFilter{{Op: "|=", Value: "error"}},
+			expected: `{service="app"} |= "error"`,
+		},
+		{
+			name:     "replace",
+			expr:     `{service="other", cluster=~"prod.*"} | json`,
+			matchers: []LabelMatcher{{Name: "service", Op: "=", Value: "app"}},
+			expected: `{cluster=~"prod.*", service="app"} | json`,
+		},
+		{
+			name:     "metric",
+			expr:     `sum by (level) (count_over_time({service="app"} | line_format "{{.msg}}" [5m]))`,
+			matchers: []LabelMatcher{{Name: "level", Op: "!=", Value: "debug"}},
+			filters:  []LineFilter{{Op: "!~", Value: `time\s?out`}},
+			expected: `sum by (level) (count_over_time({service="app", level!="debug"} !~ "time\\s?out" | line_format "{{.msg}}" [5m]))`,
+		},
+		{
+			name:     "escaped",
+			expr:     `{service='a\'b', path=` + "`/x`" + `}`,
+			matchers: []LabelMatcher{{Name: "level", Op: "=", Value: `say "hi"`}},
+			expected: `{service="a'b", path="/x", level="say \"hi\""}`,
+		},
+		{
+			name:      "no-matchers",
+			filters:   []LineFilter{{Op: "|=", Value: "error"}},
+			expectErr: true,
+		},
+		{
+			name:      "no-selector",
+			expr:      `rate(requests_total[5m])`,
+			matchers:  []LabelMatcher{{Name: "service", Op: "=", Value: "app"}},
+			expectErr: true,
+		},
+		{
+			name:      "unclosed",
+			expr:      `{service="app"`,
+			matchers:  []LabelMatcher{{Name: "service", Op: "=", Value: "app"}},
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := BuildLogQL(c.expr, c.matchers, c.filters)
+			if c.expectErr {
+				if err == nil {
+					t.Fatalf("Expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to build LogQL: %v", err)
+			}
+			if actual != c.expected {
+				t.Errorf("Got %v;\n Want %v", actual, c.expected)
+			}
+		})
+	}
+}
+
+func Test_ApplyPatchLokiParams(t *testing.T) {
+	fixTime := false
+	base := &api.GrafanaLink{
+		Metadata: api.Metadata{Name: "test"},
+		Parameters: []api.Parameter{
+			{Name: "service", Label: "service"},
+			{Name: "level", Type: api.ParameterTypeEnum, Values: []string{"info", "error"}, Label: "level", Default: "error"},
+			{Name: "search", LineFilter: true, Operator: "|~", Default: "timeout"},
+		},
+		Panes: api.Panes{
+			"eja": api.PaneBody{
+				Queries: []api.Query{
+					{
+						RefID:      "A",
+						Datasource: api.Datasource{Type: "loki", UID: "lokiuid"},
+						Expr:       `{cluster="prod"} | json`,
+						QueryType:  api.LokiRangeQueryType,
+					},
+				},
+			},
+		},
+	}
+
+	patch := api.PanePatch{
+		Template: "test",
+		Params:   map[string]interface{}{"service": "app"},
+		FixTime:  &fixTime,
+	}
+
+	actual, err := NewPatcher(FakeClock{}).ApplyPatch([]*api.GrafanaLink{base}, patch)
+	if err != nil {
+		t.Fatalf("Error applying patch: %v", err)
+	}
+
+	expected := []api.Query{
+		{
+			RefID:            "A",
+			Datasource:       api.Datasource{Type: "loki", UID: "lokiuid"},
+			Expr:             `{cluster="prod", service="app", level="error"} |~ "timeout" | json`,
+			QueryType:        api.LokiRangeQueryType,
+			AdditionalFields: map[string]interface{}{},
+		},
+	}
+	if d := cmp.Diff(expected, actual.Panes["eja"].Queries); d != "" {
+		t.Errorf("Unexpected diff:\n%v", d)
+	}
+}
@@ -0,0 +1,223 @@
+package grafana
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jlewi/grafctl/api"
+	"github.com/pkg/errors"
+)
+
+var (
+	// appendedFields are the fields of a PanePatch whose lists are appended to the lists of earlier layers rather
+	// than replacing them.
+	appendedFields = []string{"operations", "targets"}
+)
+
+// PatchLayer is one of the patches that are merged to produce the patch applied to a template.
+type PatchLayer struct {
+	// Source is where the patch came from e.g. the path of the file; it is reported in the provenance of the fields
+	// set by the patch.
+	Source string
+	Patch  *api.PanePatch
+}
+
+// Provenance is the source of the layer that set each field of a merged patch keyed by the dot separated path of
+// the field e.g. query.builderOptions.table. Items of appended lists are identified by their index e.g.
+// operations[1].
+type Provenance map[string]string
+
+// ExpandBases returns the layers for the patch; the patches named by its bases, recursively, followed by the patch
+// itself. Relative paths in bases are relative to dir. source is the path of the file containing the patch (or
+// e.g. stdin); it identifies the patch in the provenance and errors.
+//
+// seen holds the files that have already been layered, keyed by their absolute paths, so that a file shared by
+// several patches is only layered once; otherwise its operations and targets would be applied more than once. Files
+// in seen, including source, aren't layered again and the files that are layered are added to it. seen can be nil
+// if the patch is expanded on its own.
+func ExpandBases(patch *api.PanePatch, source string, dir string, seen map[string]bool) ([]PatchLayer, error) {
+	if seen == nil {
+		seen = map[string]bool{}
+	}
+	key := layerKey(source)
+	if seen[key] {
+		return nil, nil
+	}
+	seen[key] = true
+	return expandBases(patch, source, dir, []string{key}, seen)
+}
+
+func expandBases(patch *api.PanePatch, source string, dir string, stack []string, seen map[string]bool) ([]PatchLayer, error) {
+	layers := []PatchLayer{}
+	for _, b := range patch.Bases {
+		path := b
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		key := layerKey(path)
+		for _, s := range stack {
+			if s == key {
+				return nil, errors.Errorf("Patch %v is a base of itself; %v", path, strings.Join(append(stack, key), " -> "))
+			}
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		base, err := readPatchLayerFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to read base %v of %v", b, source)
+		}
+		baseLayers, err := expandBases(base, path, filepath.Dir(path), append(stack, key), seen)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, baseLayers...)
+	}
+	return append(layers, PatchLayer{Source: source, Patch: patch}), nil
+}
+
+// layerKey returns the key identifying the file at path; its absolute, cleaned path.
+func layerKey(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	return abs
+}
+
+// readPatchLayerFile reads a file that should contain exactly one patch.
+func readPatchLayerFile(path string) (*api.PanePatch, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to open patch file %v", path)
+	}
+	defer f.Close()
+	entries, err := ReadPatches(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read patch file %v", path)
+	}
+	if len(entries) != 1 {
+		return nil, errors.Errorf("Patch file %v contains %v patches; a base must contain exactly one patch", path, len(entries))
+	}
+	if entries[0].Err != nil {
+		return nil, errors.Wrapf(entries[0].Err, "Invalid patch file %v", path)
+	}
+	return entries[0].Patch, nil
+}
+
+// MergePatches merges the layers in order into a single patch. Objects (e.g. query, params and panes) are merged
+// recursively and other values, including null, replace the values of earlier layers so later layers override
+// earlier ones. The operations and targets of the layers are appended. The bases of the layers are dropped from
+// the result since the layers are expected to already include them.
+func MergePatches(layers []PatchLayer) (*api.PanePatch, Provenance, error) {
+	merged := map[string]interface{}{}
+	provenance := Provenance{}
+	for _, l := range layers {
+		fields, err := patchFields(l.Patch)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Failed to merge patch %v", l.Source)
+		}
+		for k, v := range fields {
+			if isAppendedField(k) {
+				existing, _ := merged[k].([]interface{})
+				items, _ := v.([]interface{})
+				for i := range items {
+					provenance[fmt.Sprintf("%v[%v]", k, len(existing)+i)] = l.Source
+				}
+				merged[k] = append(existing, items...)
+				continue
+			}
+			merged[k] = mergeValue(merged[k], v, k, l.Source, provenance)
+		}
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Failed to serialize the merged patch")
+	}
+	patch := &api.PanePatch{}
+	if err := json.Unmarshal(data, patch); err != nil {
+		return nil, nil, errors.Wrapf(err, "Failed to deserialize the merged patch")
+	}
+	return patch, provenance, nil
+}
+
+// patchFields returns the fields set by the patch. Fields that are empty strings aren't set.
+func patchFields(patch *api.PanePatch) (map[string]interface{}, error) {
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "bases")
+	for k, v := range fields {
+		if s, ok := v.(string); ok && s == "" {
+			delete(fields, k)
+		}
+	}
+	return fields, nil
+}
+
+// mergeValue merges value into existing and records the source of the fields value sets in provenance.
+func mergeValue(existing interface{}, value interface{}, path string, source string, provenance Provenance) interface{} {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		clearProvenance(provenance, path)
+		provenance[path] = source
+		return value
+	}
+	e, ok := existing.(map[string]interface{})
+	if !ok {
+		clearProvenance(provenance, path)
+		e = map[string]interface{}{}
+	}
+	for k, v := range m {
+		e[k] = mergeValue(e[k], v, path+"."+k, source, provenance)
+	}
+	return e
+}
+
+// clearProvenance removes the provenance of the field at path and the fields nested in it.
+func clearProvenance(provenance Provenance, path string) {
+	for k := range provenance {
+		if k == path || strings.HasPrefix(k, path+".") {
+			delete(provenance, k)
+		}
+	}
+}
+
+func isAppendedField(field string) bool {
+	for _, f := range appendedFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteProvenance writes a table with the source of each field.
+func WriteProvenance(w io.Writer, provenance Provenance) error {
+	fields := make([]string, 0, len(provenance))
+	for f := range provenance {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIELD\tSOURCE")
+	for _, f := range fields {
+		fmt.Fprintf(tw, "%v\t%v\n", f, provenance[f])
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,253 @@
+package grafana
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/grafctl/api"
+)
+
+func Test_MergePatches(t *testing.T) {
+	fixTime := false
+	layers := []PatchLayer{
+		{
+			Source: "base.yaml",
+			Patch: &api.PanePatch{
+				Template: "logs",
+				Query: map[string]interface{}{
+					"builderOptions": map[string]interface{}{
+						"database": "views",
+						"table":    "logs",
+					},
+					"rawSql": "SELECT 1",
+				},
+				Params:     map[string]interface{}{"app": "foyle"},
+				Range:      api.TimeRange{From: "now-1h", To: "now"},
+				Operations: []api.Operation{{Op: "remove", Path: "/panes/metrics"}},
+			},
+		},
+		{
+			Source: "prod.yaml",
+			Patch: &api.PanePatch{
+				Bases: []string{"base.yaml"},
+				Query: map[string]interface{}{
+					"builderOptions": map[string]interface{}{
+						"table": "prodlogs",
+					},
+					"rawSql": map[string]interface{}{"text": "SELECT 2"},
+					"format": nil,
+				},
+				Context:    "prod",
+				FixTime:    &fixTime,
+				Operations: []api.Operation{{Op: "replace", Path: "/panes/logs/queries/0/refId", Value: "B"}},
+			},
+		},
+		{
+			Source: "flags",
+			Patch: &api.PanePatch{
+				Range: api.TimeRange{From: "now-2h"},
+			},
+		},
+	}
+
+	patch, provenance, err := MergePatches(layers)
+	if err != nil {
+		t.Fatalf("Failed to merge patches: %+v", err)
+	}
+
+	expected := &api.PanePatch{
+		Template: "logs",
+		Query: map[string]interface{}{
+			"builderOptions": map[string]interface{}{
+				"database": "views",
+				"table":    "prodlogs",
+			},
+			"rawSql": map[string]interface{}{"text": "SELECT 2"},
+			"format": nil,
+		},
+		Params:  map[string]interface{}{"app": "foyle"},
+		Range:   api.TimeRange{From: "now-2h", To: "now"},
+		FixTime: &fixTime,
+		Context: "prod",
+		Operations: []api.Operation{
+			{Op: "remove", Path: "/panes/metrics"},
+			{Op: "replace", Path: "/panes/logs/queries/0/refId", Value: "B"},
+		},
+	}
+	if d := cmp.Diff(expected, patch); d != "" {
+		t.Errorf("Unexpected patch:\n%v", d)
+	}
+
+	expectedProvenance := Provenance{
+		"template":                      "base.yaml",
+		"query.builderOptions.database": "base.yaml",
+		"query.builderOptions.table":    "prod.yaml",
+		"query.rawSql.text":             "prod.yaml",
+		"query.format":                  "prod.yaml",
+		"params.app":                    "base.yaml",
+		"range.from":                    "flags",
+		"range.to":                      "base.yaml",
+		"fixTime":                       "prod.yaml",
+		"context":                       "prod.yaml",
+		"operations[0]":                 "base.yaml",
+		"operations[1]":                 "prod.yaml",
+	}
+	if d := cmp.Diff(expectedProvenance, provenance); d != "" {
+		t.Errorf("Unexpected provenance:\n%v", d)
+	}
+}
+
+func Test_ExpandBases(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"shared/base.yaml": `template: logs
+params:
+  app: foyle
+`,
+		"shared/logs.yaml": `bases:
+  - base.yaml
+query:
+  builderOptions:
+    table: logs
+`,
+		"prod.yaml": `bases:
+  - shared/logs.yaml
+context: prod
+`,
+		"cycle-a.yaml": `bases:
+  - cycle-b.yaml
+`,
+		"cycle-b.yaml": `bases:
+  - cycle-a.yaml
+`,
+		"batch.yaml": `template: logs
+---
+template: metrics
+`,
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	type testCase struct {
+		name      string
+		bases     []string
+		expected  []string
+		expectErr string
+	}
+
+	cases := []testCase{
+		{
+			name:     "nested",
+			bases:    []string{"prod.yaml"},
+			expected: []string{"shared/base.yaml", "shared/logs.yaml", "prod.yaml", "overlay"},
+		},
+		{
+			name:      "cycle",
+			bases:     []string{"cycle-a.yaml"},
+			expectErr: "is a base of itself",
+		},
+		{
+			name:      "batch",
+			bases:     []string{"batch.yaml"},
+			expectErr: "a base must contain exactly one patch",
+		},
+		{
+			name:      "missing",
+			bases:     []string{"missing.yaml"},
+			expectErr: "Failed to read base missing.yaml of overlay",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			layers, err := ExpandBases(&api.PanePatch{Bases: c.bases}, "overlay", dir, nil)
+			if c.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.expectErr) {
+					t.Fatalf("Got error %v; want an error containing %q", err, c.expectErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to expand bases: %+v", err)
+			}
+			sources := []string{}
+			for _, l := range layers {
+				sources = append(sources, filepath.ToSlash(strings.TrimPrefix(l.Source, dir+string(filepath.Separator))))
+			}
+			if d := cmp.Diff(c.expected, sources); d != "" {
+				t.Errorf("Unexpected layers:\n%v", d)
+			}
+		})
+	}
+}
+
+func Test_ExpandBasesSharedFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"shared.yaml": `template: logs
+operations:
+  - op: remove
+    path: /panes/metrics
+`,
+		"prod.yaml": `bases:
+  - shared.yaml
+query:
+  builderOptions:
+    table: prodlogs
+`,
+		"staging.yaml": `bases:
+  - ./shared.yaml
+context: staging
+`,
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	// Equivalent to -p shared.yaml -p prod.yaml -p staging.yaml; shared.yaml is only layered once.
+	seen := map[string]bool{}
+	sources := []string{}
+	for _, name := range []string{"shared.yaml", "prod.yaml", "staging.yaml"} {
+		path := filepath.Join(dir, name)
+		patch, err := readPatchLayerFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read %v: %+v", path, err)
+		}
+		layers, err := ExpandBases(patch, path, dir, seen)
+		if err != nil {
+			t.Fatalf("Failed to expand bases of %v: %+v", path, err)
+		}
+		for _, l := range layers {
+			sources = append(sources, filepath.Base(l.Source))
+		}
+	}
+	if d := cmp.Diff([]string{"shared.yaml", "prod.yaml", "staging.yaml"}, sources); d != "" {
+		t.Errorf("Unexpected layers:\n%v", d)
+	}
+
+	// A self reference is detected even if the path of the patch isn't clean.
+	self := filepath.Join(dir, "sub", "..", "self.yaml")
+	if err := os.WriteFile(filepath.Join(dir, "self.yaml"), []byte("bases:\n  - self.yaml\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	_, err := ExpandBases(&api.PanePatch{Bases: []string{"self.yaml"}}, self, dir, nil)
+	if err == nil || !strings.Contains(err.Error(), "is a base of itself") {
+		t.Fatalf("Got error %v; want an error that self.yaml is a base of itself", err)
+	}
+	// The cycle is self.yaml -> self.yaml; it isn't read again under a different name first.
+	if n := strings.Count(err.Error(), "self.yaml"); n != 3 {
+		t.Errorf("Got error %v; want the cycle to be detected before self.yaml is read", err)
+	}
+}
@@ -0,0 +1,117 @@
+package grafana
+
+import (
+	"strings"
+
+	"github.com/jlewi/grafctl/api"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// PatchOverrides are values for a PanePatch set on the command line. They override the values of the patch they
+// are applied to so that a link can be built from flags alone or from a patch file with some fields changed.
+type PatchOverrides struct {
+	// Template overrides the template of the patch.
+	Template string
+	// Set are key=value pairs where key is a dot separated path to a field of the query e.g.
+	// builderOptions.table=logs. The values are parsed as YAML scalars so numbers and booleans keep their types.
+	Set []string
+	// Params are key=value pairs setting the values of the template's parameters.
+	Params []string
+	// From and To override the start and end of the time range.
+	From string
+	To   string
+	// FixTime overrides whether relative times are converted to absolute times. It is left unchanged if nil.
+	FixTime *bool
+}
+
+// Apply sets the values of the overrides on the patch.
+func (o PatchOverrides) Apply(patch *api.PanePatch) error {
+	if o.Template != "" {
+		patch.Template = o.Template
+	}
+
+	for _, s := range o.Set {
+		path, value, err := splitKeyValue("set", s)
+		if err != nil {
+			return err
+		}
+		if patch.Query == nil {
+			patch.Query = map[string]interface{}{}
+		}
+		if err := setPath(patch.Query, path, parseScalar(value)); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range o.Params {
+		name, value, err := splitKeyValue("param", p)
+		if err != nil {
+			return err
+		}
+		if patch.Params == nil {
+			patch.Params = map[string]interface{}{}
+		}
+		patch.Params[name] = value
+	}
+
+	if o.From != "" {
+		patch.Range.From = o.From
+	}
+	if o.To != "" {
+		patch.Range.To = o.To
+	}
+	if o.FixTime != nil {
+		fixTime := *o.FixTime
+		patch.FixTime = &fixTime
+	}
+	return nil
+}
+
+// splitKeyValue splits a key=value pair passed to the flag.
+func splitKeyValue(flag string, s string) (string, string, error) {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || strings.TrimSpace(key) == "" {
+		return "", "", errors.Errorf("Invalid value %v for --%v; value should be of the form key=value", s, flag)
+	}
+	return strings.TrimSpace(key), value, nil
+}
+
+// setPath sets the field at the dot separated path in m to value, creating any missing objects along the way.
+// Fields on the path that aren't objects are replaced.
+func setPath(m map[string]interface{}, path string, value interface{}) error {
+	keys := strings.Split(path, ".")
+	for _, k := range keys {
+		if k == "" {
+			return errors.Errorf("Invalid path %v; path should be a dot separated list of field names", path)
+		}
+	}
+
+	for _, k := range keys[:len(keys)-1] {
+		child, ok := m[k].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			m[k] = child
+		}
+		m = child
+	}
+	m[keys[len(keys)-1]] = value
+	return nil
+}
+
+// parseScalar parses numbers, booleans and null so that e.g. 100 is an int and null deletes the field. Any other
+// value, including one that YAML would interpret as a string, comment or object, is returned unchanged.
+func parseScalar(value string) interface{} {
+	if strings.TrimSpace(value) == "" || strings.Contains(value, "#") {
+		return value
+	}
+	var v interface{}
+	if err := yaml.Unmarshal([]byte(value), &v); err != nil {
+		return value
+	}
+	switch v.(type) {
+	case nil, int, float64, bool:
+		return v
+	}
+	return value
+}
@@ -0,0 +1,180 @@
+package grafana
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/grafctl/api"
+)
+
+func Test_PatchOverrides(t *testing.T) {
+	type testCase struct {
+		name      string
+		patch     api.PanePatch
+		overrides PatchOverrides
+		expected  api.PanePatch
+		expectErr bool
+	}
+
+	fixTime := false
+	cases := []testCase{
+		{
+			name: "flags-only",
+			overrides: PatchOverrides{
+				Template: "logs",
+				Set:      []string{"builderOptions.table=logs", "builderOptions.limit=100", "rawSql=SELECT * FROM logs # all", "format=null"},
+				Params:   []string{"app=foyle", "filter=level=error"},
+				From:     "now-1h",
+				To:       "now",
+				FixTime:  &fixTime,
+			},
+			expected: api.PanePatch{
+				Template: "logs",
+				Query: map[string]interface{}{
+					"builderOptions": map[string]interface{}{
+						"table": "logs",
+						"limit": 100,
+					},
+					"rawSql": "SELECT * FROM logs # all",
+					"format": nil,
+				},
+				Params: map[string]interface{}{
+					"app":    "foyle",
+					"filter": "level=error",
+				},
+				Range:   api.TimeRange{From: "now-1h", To: "now"},
+				FixTime: &fixTime,
+			},
+		},
+		{
+			name: "override-file",
+			patch: api.PanePatch{
+				Template: "logs",
+				Query: map[string]interface{}{
+					"builderOptions": map[string]interface{}{
+						"table":    "logs",
+						"database": "views",
+					},
+					"rawSql": "SELECT 1",
+				},
+				Params: map[string]interface{}{"app": "foyle", "level": "info"},
+				Range:  api.TimeRange{From: "now-1d", To: "now"},
+			},
+			overrides: PatchOverrides{
+				Set:    []string{"builderOptions.table=traces", "rawSql.text=SELECT 2"},
+				Params: []string{"level=error"},
+				From:   "now-2h",
+			},
+			expected: api.PanePatch{
+				Template: "logs",
+				Query: map[string]interface{}{
+					"builderOptions": map[string]interface{}{
+						"table":    "traces",
+						"database": "views",
+					},
+					"rawSql": map[string]interface{}{"text": "SELECT 2"},
+				},
+				Params: map[string]interface{}{"app": "foyle", "level": "error"},
+				Range:  api.TimeRange{From: "now-2h", To: "now"},
+			},
+		},
+		{
+			name:      "missing-value",
+			overrides: PatchOverrides{Set: []string{"builderOptions.table"}},
+			expectErr: true,
+		},
+		{
+			name:      "bad-path",
+			overrides: PatchOverrides{Set: []string{"builderOptions..table=logs"}},
+			expectErr: true,
+		},
+		{
+			name:      "missing-param-name",
+			overrides: PatchOverrides{Params: []string{"=foyle"}},
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			patch := c.patch
+			err := c.overrides.Apply(&patch)
+			if c.expectErr {
+				if err == nil {
+					t.Fatalf("Expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to apply overrides: %+v", err)
+			}
+			if d := cmp.Diff(c.expected, patch); d != "" {
+				t.Errorf("Unexpected diff:\n%v", d)
+			}
+		})
+	}
+}
+
+func Test_PatchOverridesWithoutRange(t *testing.T) {
+	// A patch built only from --set should keep the template's time range.
+	bases := []*api.GrafanaLink{
+		{
+			Metadata: api.Metadata{
+				Name: "logs",
+			},
+			Panes: api.Panes{
+				"eja": api.PaneBody{
+					Queries: []api.Query{
+						{
+							AdditionalFields: map[string]interface{}{
+								"builderOptions": map[string]interface{}{
+									"table": "logs",
+								},
+							},
+						},
+					},
+					Range: api.TimeRange{
+						From: "now-1h",
+						To:   "now",
+					},
+				},
+			},
+		},
+	}
+
+	patch := api.PanePatch{}
+	overrides := PatchOverrides{
+		Template: "logs",
+		Set:      []string{"builderOptions.limit=100"},
+	}
+	if err := overrides.Apply(&patch); err != nil {
+		t.Fatalf("Failed to apply overrides: %+v", err)
+	}
+
+	actual, err := NewPatcher(FakeClock{}).ApplyPatch(bases, patch)
+	if err != nil {
+		t.Fatalf("Error applying patch: %+v", err)
+	}
+
+	expected := api.Panes{
+		"eja": api.PaneBody{
+			Queries: []api.Query{
+				{
+					AdditionalFields: map[string]interface{}{
+						"builderOptions": map[string]interface{}{
+							"table": "logs",
+							"limit": 100,
+						},
+					},
+				},
+			},
+			Range: api.TimeRange{
+				From: "1708863900000",
+				To:   "1708867500000",
+			},
+		},
+	}
+	if d := cmp.Diff(expected, actual.Panes); d != "" {
+		t.Errorf("Unexpected diff:\n%v", d)
+	}
+}
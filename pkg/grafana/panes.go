@@ -3,6 +3,7 @@ package grafana
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 
 	"github.com/jlewi/grafctl/api"
 	"github.com/pkg/errors"
@@ -14,6 +15,16 @@ import (
 
 type Patcher struct {
 	Clock Clock
+	// Timezone is the default timezone used to resolve relative times for templates and patches that don't
+	// specify a timezone.
+	Timezone string
+	// WeekStart is the default first day of the week for templates and patches that don't specify one.
+	WeekStart string
+	// Contexts are the Grafana instances links can be rebased onto.
+	Contexts []Context
+	// Context is the name of the context links are rebased onto if the patch doesn't select one. If it is empty
+	// links aren't rebased.
+	Context string
 }
 
 func NewPatcher(clock Clock) *Patcher {
@@ -28,10 +39,6 @@ func (a *Patcher) ApplyPatch(bases []*api.GrafanaLink, patch api.PanePatch) (*ap
 		return nil, errors.New("Template must be specified in the patch and should be the name of the template to apply")
 	}
 
-	if patch.Query == nil {
-		return nil, errors.New("Query must be specified in the patch")
-	}
-
 	// Find the base
 	var base *api.GrafanaLink
 	baseNames := make([]string, 0, len(bases))
@@ -47,36 +54,111 @@ func (a *Patcher) ApplyPatch(bases []*api.GrafanaLink, patch api.PanePatch) (*ap
 		return nil, errors.Errorf("Unable to apply the patch because there is no template %v in the links; add the template to the links in your configuration or select one of your existing links. The known bases are %v", patch.Template, baseNames)
 	}
 
-	if len(base.Panes) != 1 {
-		// N.B. Right now we assume there is only 1 pane in the base resource and that's the one to apply the patch
-		// to. Its TBD whether Grafana has resources where there is more than 1 pane and if there is how identify
-		// the correct pane to apply the patch to. I guess we could just specify a parameter in the patch.
-		return nil, errors.Errorf("Unable to apply patch to the GrafanaLink. GrafanaLink has %v panes; expected 1", len(base.Panes))
+	if base.Dashboard == nil && len(queryPatches(patch)) == 0 && len(patch.Panes) == 0 && len(patch.Operations) == 0 && len(base.Parameters) == 0 && patch.Range == (api.TimeRange{}) {
+		return nil, errors.New("Query, targets, panes, operations, params or range must be specified in the patch")
 	}
 
-	for k := range base.Panes {
-		paneBody := base.Panes[k]
-		if err := ApplyPatchToPane(&paneBody, patch); err != nil {
+	return a.patchLink(base, patch)
+}
+
+// patchLink applies the patch to base.
+func (a *Patcher) patchLink(base *api.GrafanaLink, patch api.PanePatch) (*api.GrafanaLink, error) {
+	// Rebase the link before applying the patch so that the patch can override the context.
+	if err := a.rebase(base, patch); err != nil {
+		return nil, errors.Wrapf(err, "Failed to apply patch to template %v", patch.Template)
+	}
+
+	timeParser, err := a.timeParser(base, patch)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to apply patch to template %v", patch.Template)
+	}
+
+	params, err := ResolveParams(base.Parameters, patch.Params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to apply patch to template %v", patch.Template)
+	}
+
+	if err := applyURLOptions(base, patch); err != nil {
+		return nil, errors.Wrapf(err, "Failed to apply patch to template %v", patch.Template)
+	}
+
+	if base.Dashboard != nil {
+		if err := a.applyPatchToDashboard(base, patch, params, timeParser); err != nil {
 			return nil, errors.Wrapf(err, "Failed to apply patch to template %v", patch.Template)
 		}
+		return base, nil
+	}
 
-		if patch.FixTime == nil || *patch.FixTime {
-			p := NewRelativeTimeParser()
-			p.Clock = a.Clock
-			from, err := p.ParseGrafanaRelativeTime(patch.Range.From)
-			if err != nil {
-				return nil, errors.Wrapf(err, "Failed to parse relative time in from field of value %v", patch.Range.From)
-			}
-			// From is unix epoch in milliseconds
-			paneBody.Range.From = fmt.Sprintf("%d", from.Unix()*1000)
+	for _, p := range base.Parameters {
+		if p.Variable != "" {
+			return nil, errors.Errorf("Parameter %v of template %v sets variable %v but variables only apply to dashboard links; use path to set a field in a query", p.Name, patch.Template, p.Variable)
+		}
+	}
 
-			to, err := p.ParseGrafanaRelativeTime(patch.Range.To)
-			if err != nil {
-				return nil, errors.Wrapf(err, "Failed to parse relative time in to field of value %v", patch.Range.To)
+	// Templates in the template's queries and in the patch are rendered before any values are inserted so that the
+	// values of parameters are substituted once and never evaluated as templates themselves.
+	// Only templates that declare parameters are rendered; this avoids misinterpreting Grafana's own use of {{ }}.
+	if len(base.Parameters) > 0 {
+		for paneID, paneBody := range base.Panes {
+			for i := range paneBody.Queries {
+				if err := RenderQuery(&paneBody.Queries[i], params); err != nil {
+					return nil, errors.Wrapf(err, "Failed to render query %v in pane %v of template %v", paneBody.Queries[i].RefID, paneID, patch.Template)
+				}
 			}
-			// From is unix epoch in milliseconds
-			paneBody.Range.To = fmt.Sprintf("%d", to.Unix()*1000)
 		}
+		patch, err = renderPatch(patch, params)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to render the patch to template %v", patch.Template)
+		}
+	}
+
+	// Parameters are applied before the other patches so that the patches can override them.
+	paramTargets, err := paramQueryPatches(base, params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to apply patch to template %v", patch.Template)
+	}
+	targets := queryPatches(patch)
+
+	if len(patch.Variables) > 0 {
+		return nil, errors.Errorf("Unable to apply patch to template %v; variables can only be set on dashboard links but %v is an Explore link", patch.Template, patch.Template)
+	}
+
+	if err := applyQueryPatches(base, paramTargets); err != nil {
+		return nil, errors.Wrapf(err, "Failed to apply patch to template %v", patch.Template)
+	}
+	if err := applyExprParams(base, params); err != nil {
+		return nil, errors.Wrapf(err, "Failed to apply patch to template %v", patch.Template)
+	}
+
+	for _, paneID := range sortedKeys(patch.Panes) {
+		paneBody, ok := base.Panes[paneID]
+		if !ok {
+			return nil, errors.Errorf("Failed to apply patch to template %v; there is no pane with ID %v; the panes are %v", patch.Template, paneID, paneIDs(base.Panes))
+		}
+		if err := applyPatchWithType(&paneBody, patch.Panes[paneID], patch.PatchType); err != nil {
+			return nil, errors.Wrapf(err, "Failed to apply patch to pane %v of template %v", paneID, patch.Template)
+		}
+		base.Panes[paneID] = paneBody
+	}
+
+	if err := applyQueryPatches(base, targets); err != nil {
+		return nil, errors.Wrapf(err, "Failed to apply patch to template %v", patch.Template)
+	}
+
+	if len(patch.Operations) > 0 {
+		if err := applyOperations(base, patch.Operations); err != nil {
+			return nil, errors.Wrapf(err, "Failed to apply operations to template %v", patch.Template)
+		}
+	}
+
+	// The time range applies to all the panes in the link.
+	for k := range base.Panes {
+		paneBody := base.Panes[k]
+		r, err := resolveRange(paneBody.Range, patch, timeParser)
+		if err != nil {
+			return nil, err
+		}
+		paneBody.Range = r
 
 		base.Panes[k] = paneBody
 	}
@@ -84,22 +166,250 @@ func (a *Patcher) ApplyPatch(bases []*api.GrafanaLink, patch api.PanePatch) (*ap
 	return base, nil
 }
 
-// ApplyPatchToPane applies the patch to the pane.
-func ApplyPatchToPane(pane *api.PaneBody, patch api.PanePatch) error {
-	if len(pane.Queries) != 1 {
-		return errors.Errorf("Unable to apply patch to the PaneBody. PaneBody has %v queries; expected 1", len(pane.Queries))
+// applyQueryPatches applies the query patches to the panes of the base.
+func applyQueryPatches(base *api.GrafanaLink, targets []api.QueryPatch) error {
+	for _, t := range targets {
+		paneID, err := selectPane(base.Panes, t.Pane)
+		if err != nil {
+			return err
+		}
+		paneBody := base.Panes[paneID]
+		if err := ApplyPatchToPane(&paneBody, t); err != nil {
+			return errors.Wrapf(err, "Failed to apply patch to pane %v", paneID)
+		}
+		base.Panes[paneID] = paneBody
+	}
+	return nil
+}
+
+// applyPatchToDashboard applies the variables and time range in the patch to the dashboard of the base.
+// params are the resolved values of the template's parameters.
+func (a *Patcher) applyPatchToDashboard(base *api.GrafanaLink, patch api.PanePatch, params map[string]interface{}, timeParser *RelativeTimeParser) error {
+	dashboard := base.Dashboard
+	if len(queryPatches(patch)) > 0 {
+		return errors.New("Queries can't be patched on a dashboard link; use variables to change the values of the dashboard's template variables")
+	}
+	if len(patch.Panes) > 0 {
+		return errors.New("Panes can't be patched on a dashboard link; use variables to change the values of the dashboard's template variables")
+	}
+
+	setVariable := func(name string, values []string) {
+		if dashboard.Variables == nil {
+			dashboard.Variables = map[string][]string{}
+		}
+		dashboard.Variables[name] = values
+	}
+
+	// Parameters are applied before the variables so that the variables in the patch can override them.
+	for _, p := range base.Parameters {
+		if p.Path != "" {
+			return errors.Errorf("Parameter %v sets the field %v of a query but dashboard links don't have queries; use variable to set a dashboard variable", p.Name, p.Path)
+		}
+		if p.Label != "" || p.LineFilter || p.Attribute != "" {
+			return errors.Errorf("Parameter %v sets a label matcher, line filter or TraceQL condition of a query but dashboard links don't have queries; use variable to set a dashboard variable", p.Name)
+		}
+		if p.Variable == "" {
+			continue
+		}
+		setVariable(p.Variable, []string{fmt.Sprintf("%v", params[p.Name])})
+	}
+
+	for name, values := range patch.Variables {
+		setVariable(name, values)
+	}
+
+	if len(patch.Operations) > 0 {
+		if err := applyOperations(base, patch.Operations); err != nil {
+			return errors.Wrapf(err, "Failed to apply operations")
+		}
+		dashboard = base.Dashboard
+		if dashboard == nil {
+			return errors.New("Operations must not remove the dashboard from a dashboard link")
+		}
+	}
+
+	r, err := resolveRange(dashboard.Range, patch, timeParser)
+	if err != nil {
+		return err
+	}
+	dashboard.Range = r
+
+	// Display the dashboard in the timezone used to resolve the time range so that boundaries like now/d line up.
+	if tz := a.timezone(base, patch); tz != "" {
+		dashboard.Timezone = tz
+	}
+	return nil
+}
+
+// timezone returns the timezone to use for the patch. The timezone in the patch takes precedence over the
+// template's which takes precedence over the Patcher's default.
+func (a *Patcher) timezone(base *api.GrafanaLink, patch api.PanePatch) string {
+	if patch.Timezone != "" {
+		return patch.Timezone
+	}
+	if base.Timezone != "" {
+		return base.Timezone
+	}
+	if base.Dashboard != nil && base.Dashboard.Timezone != "" {
+		return base.Dashboard.Timezone
+	}
+	return a.Timezone
+}
+
+// timeParser returns the parser to resolve the relative times in the patch with.
+func (a *Patcher) timeParser(base *api.GrafanaLink, patch api.PanePatch) (*RelativeTimeParser, error) {
+	loc, err := LoadLocation(a.timezone(base, patch))
+	if err != nil {
+		return nil, err
+	}
+
+	weekStart := a.WeekStart
+	if base.WeekStart != "" {
+		weekStart = base.WeekStart
+	}
+	if patch.WeekStart != "" {
+		weekStart = patch.WeekStart
+	}
+	day, err := ParseWeekStart(weekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	p := NewRelativeTimeParser()
+	p.Clock = a.Clock
+	p.Location = loc
+	p.WeekStart = day
+	return p, nil
+}
+
+// resolveRange returns the time range to use in the link. current is the range in the template; it is used when
+// the patch doesn't set a range e.g. a patch that only sets query fields.
+// If FixTime is true the relative times are converted to absolute times.
+func resolveRange(current api.TimeRange, patch api.PanePatch, p *RelativeTimeParser) (api.TimeRange, error) {
+	r := patch.Range
+	if r.From == "" && r.To == "" {
+		r = current
+	}
+	if patch.FixTime != nil && !*patch.FixTime {
+		// Use the relative times as is.
+		return r, nil
+	}
+	if r.From == "" && r.To == "" {
+		// Neither the patch nor the template has a range so there is nothing to resolve.
+		return r, nil
+	}
+
+	from, to, err := p.ParseTimeRange(r)
+	if err != nil {
+		return current, err
 	}
 
-	q := pane.Queries[0]
+	// Times are unix epoch in milliseconds
+	return api.TimeRange{
+		From: fmt.Sprintf("%d", from.UnixMilli()),
+		To:   fmt.Sprintf("%d", to.UnixMilli()),
+	}, nil
+}
 
-	if err := applyPatch(&q, patch.Query); err != nil {
+// queryPatches returns the list of query patches in the patch. The Query at the top level of the patch comes first
+// followed by the Targets.
+func queryPatches(patch api.PanePatch) []api.QueryPatch {
+	targets := make([]api.QueryPatch, 0, len(patch.Targets)+1)
+	if patch.Query != nil {
+		targets = append(targets, api.QueryPatch{
+			Pane:  patch.Pane,
+			RefID: patch.RefID,
+			Query: patch.Query,
+		})
+	}
+	targets = append(targets, patch.Targets...)
+	for i := range targets {
+		if targets[i].PatchType == "" {
+			targets[i].PatchType = patch.PatchType
+		}
+	}
+	return targets
+}
+
+// selectPane returns the ID of the pane to patch. If paneID is empty the panes must contain exactly one pane.
+func selectPane(panes api.Panes, paneID string) (string, error) {
+	if paneID != "" {
+		if _, ok := panes[paneID]; !ok {
+			return "", errors.Errorf("There is no pane with ID %v; the panes are %v", paneID, paneIDs(panes))
+		}
+		return paneID, nil
+	}
+
+	if len(panes) != 1 {
+		return "", errors.Errorf("GrafanaLink has %v panes; set pane in the patch to select one of %v", len(panes), paneIDs(panes))
+	}
+
+	for k := range panes {
+		paneID = k
+	}
+	return paneID, nil
+}
+
+func paneIDs(panes api.Panes) []string {
+	ids := make([]string, 0, len(panes))
+	for k := range panes {
+		ids = append(ids, k)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// ApplyPatchToPane applies the patch to the query in the pane selected by patch.RefID.
+// If patch.RefID is empty the pane must contain exactly one query.
+func ApplyPatchToPane(pane *api.PaneBody, patch api.QueryPatch) error {
+	index, err := selectQuery(*pane, patch.RefID)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to apply patch to the PaneBody")
+	}
+
+	q := pane.Queries[index]
+
+	if err := applyPatchWithType(&q, patch.Query, patch.PatchType); err != nil {
 		return errors.Wrapf(err, "Failed to patch query")
 	}
 
-	pane.Queries[0] = q
+	pane.Queries[index] = q
 	return nil
 }
 
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// selectQuery returns the index of the query with the refID. If refID is empty the pane must contain exactly one query.
+func selectQuery(pane api.PaneBody, refID string) (int, error) {
+	if refID == "" {
+		if len(pane.Queries) != 1 {
+			return -1, errors.Errorf("PaneBody has %v queries; set refId to select one of %v", len(pane.Queries), refIDs(pane.Queries))
+		}
+		return 0, nil
+	}
+	for i, q := range pane.Queries {
+		if q.RefID == refID {
+			return i, nil
+		}
+	}
+	return -1, errors.Errorf("There is no query with refId %v; the refIds are %v", refID, refIDs(pane.Queries))
+}
+
+func refIDs(queries []api.Query) []string {
+	ids := make([]string, 0, len(queries))
+	for _, q := range queries {
+		ids = append(ids, q.RefID)
+	}
+	return ids
+}
+
 // apply the patch. The patch is merged into base.
 // base should be a pointer
 //
@@ -27,9 +27,11 @@ func Test_ApplyPatchToLink(t *testing.T) {
 						"eja": api.PaneBody{
 							Queries: []api.Query{
 								{
-									BuilderOptions: api.BuilderOptions{
-										Database: "somedatabase",
-										Table:    "sometable",
+									AdditionalFields: map[string]interface{}{
+										"builderOptions": map[string]interface{}{
+											"database": "somedatabase",
+											"table":    "sometable",
+										},
 									},
 								},
 							},
@@ -59,12 +61,12 @@ func Test_ApplyPatchToLink(t *testing.T) {
 					"eja": api.PaneBody{
 						Queries: []api.Query{
 							{
-								BuilderOptions: api.BuilderOptions{
-									Database:       "somedatabase",
-									Table:          "sometable",
-									SimplelogQuery: "service:foo",
-								},
 								AdditionalFields: map[string]interface{}{
+									"builderOptions": map[string]interface{}{
+										"database":       "somedatabase",
+										"table":          "sometable",
+										"simplelogQuery": "service:foo",
+									},
 									"customarg": "customvalue",
 								},
 							},
@@ -77,6 +79,233 @@ func Test_ApplyPatchToLink(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "dashboard",
+			bases: []*api.GrafanaLink{
+				{
+					Metadata: api.Metadata{
+						Name: "test",
+					},
+					Dashboard: &api.Dashboard{
+						UID: "abc123",
+						Variables: map[string][]string{
+							"service": {"foyle"},
+							"cluster": {"prod"},
+						},
+						Range: api.TimeRange{
+							From: "now-6h",
+							To:   "now",
+						},
+					},
+				},
+			},
+			patch: api.PanePatch{
+				Template: "test",
+				Variables: map[string][]string{
+					"service": {"agent"},
+				},
+				Range: api.TimeRange{
+					From: "now-1h",
+					To:   "now",
+				},
+			},
+			expected: &api.GrafanaLink{
+				Metadata: api.Metadata{
+					Name: "test",
+				},
+				Dashboard: &api.Dashboard{
+					UID: "abc123",
+					Variables: map[string][]string{
+						"service": {"agent"},
+						"cluster": {"prod"},
+					},
+					Range: api.TimeRange{
+						From: "1708863900000",
+						To:   "1708867500000",
+					},
+				},
+			},
+		},
+		{
+			name: "dashboard-timezone",
+			bases: []*api.GrafanaLink{
+				{
+					Metadata: api.Metadata{
+						Name: "test",
+					},
+					Timezone: "utc",
+					Dashboard: &api.Dashboard{
+						UID: "abc123",
+					},
+				},
+			},
+			patch: api.PanePatch{
+				Template: "test",
+				Timezone: "America/Los_Angeles",
+				Range: api.TimeRange{
+					From: "now/d",
+					To:   "now/d",
+				},
+			},
+			expected: &api.GrafanaLink{
+				Metadata: api.Metadata{
+					Name: "test",
+				},
+				Timezone: "utc",
+				Dashboard: &api.Dashboard{
+					UID: "abc123",
+					Range: api.TimeRange{
+						From: "1708848000000",
+						To:   "1708934399999",
+					},
+					Timezone: "America/Los_Angeles",
+				},
+			},
+		},
+		{
+			name: "relative-time",
+			bases: []*api.GrafanaLink{
+				{
+					Metadata: api.Metadata{
+						Name: "test",
+					},
+					Dashboard: &api.Dashboard{
+						UID: "abc123",
+						Range: api.TimeRange{
+							From: "now-6h",
+							To:   "now",
+						},
+					},
+				},
+			},
+			patch: api.PanePatch{
+				Template: "test",
+				FixTime:  new(bool),
+				Range: api.TimeRange{
+					From: "now-1h",
+					To:   "now",
+				},
+			},
+			expected: &api.GrafanaLink{
+				Metadata: api.Metadata{
+					Name: "test",
+				},
+				Dashboard: &api.Dashboard{
+					UID: "abc123",
+					Range: api.TimeRange{
+						From: "now-1h",
+						To:   "now",
+					},
+				},
+			},
+		},
+		{
+			name: "split-view",
+			bases: []*api.GrafanaLink{
+				{
+					Metadata: api.Metadata{
+						Name: "test",
+					},
+					Panes: api.Panes{
+						"logs": api.PaneBody{
+							Queries: []api.Query{
+								{
+									RefID: "A",
+									AdditionalFields: map[string]interface{}{
+										"builderOptions": map[string]interface{}{
+											"table": "logs",
+										},
+									},
+								},
+								{
+									RefID: "B",
+									AdditionalFields: map[string]interface{}{
+										"builderOptions": map[string]interface{}{
+											"table": "events",
+										},
+									},
+								},
+							},
+						},
+						"metrics": api.PaneBody{
+							Queries: []api.Query{
+								{
+									RefID:  "A",
+									RawSQL: "SELECT 1",
+								},
+							},
+						},
+					},
+				},
+			},
+			patch: api.PanePatch{
+				Template: "test",
+				Pane:     "logs",
+				RefID:    "B",
+				Query: map[string]any{
+					"builderOptions": map[string]any{
+						"simplelogQuery": "service:foo",
+					},
+				},
+				Targets: []api.QueryPatch{
+					{
+						Pane: "metrics",
+						Query: map[string]any{
+							"rawSql": "SELECT 2",
+						},
+					},
+				},
+				Range: api.TimeRange{
+					From: "now-1h",
+					To:   "now",
+				},
+			},
+			expected: &api.GrafanaLink{
+				Metadata: api.Metadata{
+					Name: "test",
+				},
+				Panes: api.Panes{
+					"logs": api.PaneBody{
+						Queries: []api.Query{
+							{
+								RefID: "A",
+								AdditionalFields: map[string]interface{}{
+									"builderOptions": map[string]interface{}{
+										"table": "logs",
+									},
+								},
+							},
+							{
+								RefID: "B",
+								AdditionalFields: map[string]interface{}{
+									"builderOptions": map[string]interface{}{
+										"table":          "events",
+										"simplelogQuery": "service:foo",
+									},
+								},
+							},
+						},
+						Range: api.TimeRange{
+							From: "1708863900000",
+							To:   "1708867500000",
+						},
+					},
+					"metrics": api.PaneBody{
+						Queries: []api.Query{
+							{
+								RefID:            "A",
+								RawSQL:           "SELECT 2",
+								AdditionalFields: map[string]interface{}{},
+							},
+						},
+						Range: api.TimeRange{
+							From: "1708863900000",
+							To:   "1708867500000",
+						},
+					},
+				},
+			},
+		},
 	}
 
 	applier := NewPatcher(FakeClock{})
@@ -93,6 +322,75 @@ func Test_ApplyPatchToLink(t *testing.T) {
 	}
 }
 
+func Test_ApplyPatchErrors(t *testing.T) {
+	type testCase struct {
+		name  string
+		patch api.PanePatch
+	}
+
+	newBases := func() []*api.GrafanaLink {
+		return []*api.GrafanaLink{
+			{
+				Metadata: api.Metadata{
+					Name: "test",
+				},
+				Panes: api.Panes{
+					"logs": api.PaneBody{
+						Queries: []api.Query{{RefID: "A"}, {RefID: "B"}},
+					},
+					"metrics": api.PaneBody{
+						Queries: []api.Query{{RefID: "A"}},
+					},
+				},
+			},
+		}
+	}
+
+	cases := []testCase{
+		{
+			name: "missing-pane",
+			patch: api.PanePatch{
+				Template: "test",
+				Query:    map[string]any{"rawSql": "SELECT 1"},
+			},
+		},
+		{
+			name: "unknown-pane",
+			patch: api.PanePatch{
+				Template: "test",
+				Pane:     "traces",
+				Query:    map[string]any{"rawSql": "SELECT 1"},
+			},
+		},
+		{
+			name: "missing-refid",
+			patch: api.PanePatch{
+				Template: "test",
+				Pane:     "logs",
+				Query:    map[string]any{"rawSql": "SELECT 1"},
+			},
+		},
+		{
+			name: "unknown-refid",
+			patch: api.PanePatch{
+				Template: "test",
+				Pane:     "logs",
+				RefID:    "C",
+				Query:    map[string]any{"rawSql": "SELECT 1"},
+			},
+		},
+	}
+
+	applier := NewPatcher(FakeClock{})
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := applier.ApplyPatch(newBases(), c.patch); err == nil {
+				t.Fatalf("Expected an error applying the patch")
+			}
+		})
+	}
+}
+
 func Test_applyPatch(t *testing.T) {
 	type testCase struct {
 		name     string
@@ -0,0 +1,346 @@
+package grafana
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jlewi/grafctl/api"
+	"github.com/pkg/errors"
+)
+
+var (
+	// durationRe matches durations using Grafana's units e.g. 30s, 5m, 1h30m or 7d.
+	durationRe = regexp.MustCompile(`^(\d+(ms|s|m|h|d|w|y))+$`)
+
+	parameterTypes = []api.ParameterType{api.ParameterTypeString, api.ParameterTypeEnum, api.ParameterTypeInt, api.ParameterTypeDuration}
+)
+
+// ResolveParams validates the values of the parameters and converts them to the types of the parameters.
+// Parameters that aren't set use their defaults. It is an error to set a parameter the template doesn't declare
+// or to omit a parameter that doesn't have a default.
+func ResolveParams(params []api.Parameter, values map[string]interface{}) (map[string]interface{}, error) {
+	declared := make(map[string]api.Parameter, len(params))
+	for _, p := range params {
+		declared[p.Name] = p
+	}
+
+	for name := range values {
+		if _, ok := declared[name]; !ok {
+			return nil, errors.Errorf("Unknown parameter %v; the template's parameters are %v", name, paramNames(params))
+		}
+	}
+
+	resolved := make(map[string]interface{}, len(params))
+	for _, p := range params {
+		value, ok := values[p.Name]
+		if !ok || value == nil {
+			value = p.Default
+		}
+		if value == nil {
+			if p.Description == "" {
+				return nil, errors.Errorf("Parameter %v is required", p.Name)
+			}
+			return nil, errors.Errorf("Parameter %v is required; %v", p.Name, p.Description)
+		}
+
+		converted, err := convertParam(p, value)
+		if err != nil {
+			return nil, err
+		}
+		resolved[p.Name] = converted
+	}
+	return resolved, nil
+}
+
+// CheckParameter checks that the declaration of the parameter is valid i.e. that the type is known, enums have
+// values, the default has the right type and the parameter maps to at most one place.
+func CheckParameter(p api.Parameter) error {
+	if p.Name == "" {
+		return errors.New("Parameter must have a name")
+	}
+	if !isParameterType(p.Type) {
+		return errors.Errorf("Parameter %v has unknown type %v; type must be one of %v", p.Name, p.Type, parameterTypes)
+	}
+	if p.Type == api.ParameterTypeEnum && len(p.Values) == 0 {
+		return errors.Errorf("Parameter %v is an enum but doesn't list its values", p.Name)
+	}
+	if p.Default != nil {
+		if _, err := convertParam(p, p.Default); err != nil {
+			return errors.Wrapf(err, "Parameter %v has an invalid default", p.Name)
+		}
+	}
+
+	targets := []string{}
+	if p.Path != "" {
+		targets = append(targets, "path")
+	}
+	if p.Variable != "" {
+		targets = append(targets, "variable")
+	}
+	if p.Label != "" {
+		targets = append(targets, "label")
+	}
+	if p.LineFilter {
+		targets = append(targets, "lineFilter")
+	}
+	if p.Attribute != "" {
+		targets = append(targets, "attribute")
+	}
+	if len(targets) > 1 {
+		return errors.Errorf("Parameter %v sets %v; a parameter can only set one of them", p.Name, targets)
+	}
+	return nil
+}
+
+// convertParam converts the value to the type of the parameter.
+func convertParam(p api.Parameter, value interface{}) (interface{}, error) {
+	switch p.Type {
+	case api.ParameterTypeString, "":
+		return paramString(p, value)
+	case api.ParameterTypeEnum:
+		s, err := paramString(p, value)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range p.Values {
+			if v == s {
+				return s, nil
+			}
+		}
+		return nil, errors.Errorf("Invalid value %v for parameter %v; value must be one of %v", s, p.Name, p.Values)
+	case api.ParameterTypeInt:
+		switch v := value.(type) {
+		case int:
+			return v, nil
+		case int64:
+			return int(v), nil
+		case float64:
+			if v != math.Trunc(v) {
+				return nil, errors.Errorf("Invalid value %v for parameter %v; value must be an integer", v, p.Name)
+			}
+			return int(v), nil
+		case string:
+			i, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil {
+				return nil, errors.Errorf("Invalid value %v for parameter %v; value must be an integer", v, p.Name)
+			}
+			return i, nil
+		}
+		return nil, errors.Errorf("Invalid value %v for parameter %v; value must be an integer", value, p.Name)
+	case api.ParameterTypeDuration:
+		s, err := paramString(p, value)
+		if err != nil {
+			return nil, err
+		}
+		if !durationRe.MatchString(s) {
+			return nil, errors.Errorf("Invalid value %v for parameter %v; value must be a duration such as 30s, 5m, 1h or 7d", s, p.Name)
+		}
+		return s, nil
+	}
+	return nil, errors.Errorf("Parameter %v has unknown type %v; type must be one of %v", p.Name, p.Type, parameterTypes)
+}
+
+func isParameterType(t api.ParameterType) bool {
+	if t == "" {
+		return true
+	}
+	for _, known := range parameterTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+func paramString(p api.Parameter, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case int, int64, float64, bool:
+		return fmt.Sprintf("%v", v), nil
+	}
+	return "", errors.Errorf("Invalid value %v for parameter %v; value must be a scalar", value, p.Name)
+}
+
+func paramNames(params []api.Parameter) []string {
+	names := make([]string, 0, len(params))
+	for _, p := range params {
+		names = append(names, p.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pathToPatch converts a dot separated path and a value into a merge patch that sets the field at path to value
+// e.g. "builderOptions.table" becomes {"builderOptions": {"table": value}}
+func pathToPatch(path string, value interface{}) (map[string]interface{}, error) {
+	keys := strings.Split(path, ".")
+	for _, k := range keys {
+		if k == "" {
+			return nil, errors.Errorf("Invalid path %v; path should be a dot separated list of field names", path)
+		}
+	}
+
+	var patch interface{} = value
+	for i := len(keys) - 1; i >= 0; i-- {
+		patch = map[string]interface{}{keys[i]: patch}
+	}
+	return patch.(map[string]interface{}), nil
+}
+
+// paramQueryPatches returns the query patches that set the fields the parameters map to. It is an error for a
+// parameter's path to name a field that isn't in the template's query; otherwise a typo in the path would add an
+// unused field to the query rather than set the intended one.
+func paramQueryPatches(base *api.GrafanaLink, values map[string]interface{}) ([]api.QueryPatch, error) {
+	patches := make([]api.QueryPatch, 0, len(base.Parameters))
+	for _, p := range base.Parameters {
+		if p.Path == "" {
+			continue
+		}
+		paneID, err := selectPane(base.Panes, p.Pane)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Parameter %v doesn't select a query", p.Name)
+		}
+		index, err := selectQuery(base.Panes[paneID], p.RefID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Parameter %v doesn't select a query", p.Name)
+		}
+		if err := CheckQueryPath(&base.Panes[paneID].Queries[index], p.Path); err != nil {
+			return nil, errors.Wrapf(err, "Parameter %v has an invalid path", p.Name)
+		}
+		q, err := pathToPatch(p.Path, values[p.Name])
+		if err != nil {
+			return nil, errors.Wrapf(err, "Parameter %v has an invalid path", p.Name)
+		}
+		patches = append(patches, api.QueryPatch{
+			Pane:  p.Pane,
+			RefID: p.RefID,
+			Query: q,
+		})
+	}
+	return patches, nil
+}
+
+// exprParamPatch is the label matchers, line filters and TraceQL conditions parameters add to the expression of a
+// single query.
+type exprParamPatch struct {
+	pane       string
+	refID      string
+	matchers   []LabelMatcher
+	filters    []LineFilter
+	conditions []TraceQLCondition
+}
+
+// applyExprParams adds the label matchers, line filters and TraceQL conditions defined by the parameters to the
+// LogQL, PromQL or TraceQL expressions of the queries the parameters select. The language is determined by the type
+// of the query's datasource.
+func applyExprParams(base *api.GrafanaLink, values map[string]interface{}) error {
+	patches := []*exprParamPatch{}
+	for _, p := range base.Parameters {
+		kinds := 0
+		for _, set := range []bool{p.Label != "", p.LineFilter, p.Attribute != ""} {
+			if set {
+				kinds++
+			}
+		}
+		if kinds == 0 {
+			continue
+		}
+		if kinds > 1 {
+			return errors.Errorf("Parameter %v sets more than one of label, lineFilter and attribute; a parameter can only be one of them", p.Name)
+		}
+
+		var patch *exprParamPatch
+		for _, existing := range patches {
+			if existing.pane == p.Pane && existing.refID == p.RefID {
+				patch = existing
+				break
+			}
+		}
+		if patch == nil {
+			patch = &exprParamPatch{pane: p.Pane, refID: p.RefID}
+			patches = append(patches, patch)
+		}
+
+		value := fmt.Sprintf("%v", values[p.Name])
+		switch {
+		case p.Label != "":
+			m, err := NewLabelMatcher(p.Label, p.Operator, value)
+			if err != nil {
+				return errors.Wrapf(err, "Parameter %v has an invalid label matcher", p.Name)
+			}
+			patch.matchers = append(patch.matchers, m)
+		case p.LineFilter:
+			f, err := NewLineFilter(p.Operator, value)
+			if err != nil {
+				return errors.Wrapf(err, "Parameter %v has an invalid line filter", p.Name)
+			}
+			patch.filters = append(patch.filters, f)
+		default:
+			quote := p.Type != api.ParameterTypeInt && p.Type != api.ParameterTypeDuration
+			c, err := NewTraceQLCondition(p.Attribute, p.Operator, value, quote)
+			if err != nil {
+				return errors.Wrapf(err, "Parameter %v has an invalid TraceQL condition", p.Name)
+			}
+			patch.conditions = append(patch.conditions, c)
+		}
+	}
+
+	for _, patch := range patches {
+		paneID, err := selectPane(base.Panes, patch.pane)
+		if err != nil {
+			return err
+		}
+		paneBody := base.Panes[paneID]
+		index, err := selectQuery(paneBody, patch.refID)
+		if err != nil {
+			return err
+		}
+		q := paneBody.Queries[index]
+		if err := applyExprPatch(&q, patch); err != nil {
+			return errors.Wrapf(err, "Failed to apply parameters to query %v in pane %v", q.RefID, paneID)
+		}
+		paneBody.Queries[index] = q
+		base.Panes[paneID] = paneBody
+	}
+	return nil
+}
+
+// applyExprPatch applies the patch to the expression of the query.
+func applyExprPatch(q *api.Query, patch *exprParamPatch) error {
+	if q.Datasource.Type == api.TempoDatasourceType {
+		if len(patch.matchers) > 0 || len(patch.filters) > 0 {
+			return errors.New("Label matchers and line filters don't apply to Tempo queries; use attribute to add a TraceQL condition")
+		}
+		query, err := BuildTraceQL(q.Query, patch.conditions)
+		if err != nil {
+			return err
+		}
+		q.Query = query
+		return nil
+	}
+
+	if len(patch.conditions) > 0 {
+		return errors.Errorf("TraceQL conditions only apply to %v queries", api.TempoDatasourceType)
+	}
+
+	var expr string
+	var err error
+	if q.Datasource.Type == api.PrometheusDatasourceType {
+		if len(patch.filters) > 0 {
+			return errors.New("Line filters only apply to Loki queries")
+		}
+		expr, err = InjectPromQL(q.Expr, patch.matchers)
+	} else {
+		expr, err = BuildLogQL(q.Expr, patch.matchers, patch.filters)
+	}
+	if err != nil {
+		return err
+	}
+	q.Expr = expr
+	return nil
+}
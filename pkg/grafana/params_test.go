@@ -0,0 +1,359 @@
+package grafana
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/grafctl/api"
+)
+
+func Test_ResolveParams(t *testing.T) {
+	params := []api.Parameter{
+		{Name: "service", Description: "The service to show logs for"},
+		{Name: "level", Type: api.ParameterTypeEnum, Values: []string{"info", "error"}, Default: "info"},
+		{Name: "limit", Type: api.ParameterTypeInt, Default: 100},
+		{Name: "window", Type: api.ParameterTypeDuration, Default: "5m"},
+	}
+
+	type testCase struct {
+		name      string
+		values    map[string]interface{}
+		expected  map[string]interface{}
+		expectErr bool
+	}
+
+	cases := []testCase{
+		{
+			name:   "defaults",
+			values: map[string]interface{}{"service": "foyle"},
+			expected: map[string]interface{}{
+				"service": "foyle",
+				"level":   "info",
+				"limit":   100,
+				"window":  "5m",
+			},
+		},
+		{
+			name: "conversions",
+			values: map[string]interface{}{
+				"service": 42,
+				"level":   "error",
+				"limit":   "20",
+				"window":  "1h30m",
+			},
+			expected: map[string]interface{}{
+				"service": "42",
+				"level":   "error",
+				"limit":   20,
+				"window":  "1h30m",
+			},
+		},
+		{
+			name:   "json-number",
+			values: map[string]interface{}{"service": "foyle", "limit": float64(20)},
+			expected: map[string]interface{}{
+				"service": "foyle",
+				"level":   "info",
+				"limit":   20,
+				"window":  "5m",
+			},
+		},
+		{
+			name:      "missing-required",
+			values:    map[string]interface{}{},
+			expectErr: true,
+		},
+		{
+			name:      "unknown",
+			values:    map[string]interface{}{"service": "foyle", "cluster": "prod"},
+			expectErr: true,
+		},
+		{
+			name:      "bad-enum",
+			values:    map[string]interface{}{"service": "foyle", "level": "debug"},
+			expectErr: true,
+		},
+		{
+			name:      "bad-int",
+			values:    map[string]interface{}{"service": "foyle", "limit": "ten"},
+			expectErr: true,
+		},
+		{
+			name:      "bad-duration",
+			values:    map[string]interface{}{"service": "foyle", "window": "5 minutes"},
+			expectErr: true,
+		},
+		{
+			name:      "not-scalar",
+			values:    map[string]interface{}{"service": []interface{}{"a", "b"}},
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := ResolveParams(params, c.values)
+			if c.expectErr {
+				if err == nil {
+					t.Fatalf("Expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to resolve params: %v", err)
+			}
+			if d := cmp.Diff(c.expected, actual); d != "" {
+				t.Errorf("Unexpected diff:\n%v", d)
+			}
+		})
+	}
+}
+
+func Test_ApplyPatchParams(t *testing.T) {
+	type testCase struct {
+		name     string
+		base     *api.GrafanaLink
+		patch    api.PanePatch
+		expected *api.GrafanaLink
+	}
+
+	fixTime := false
+	cases := []testCase{
+		{
+			name: "explore",
+			base: &api.GrafanaLink{
+				Metadata: api.Metadata{Name: "test"},
+				Parameters: []api.Parameter{
+					{Name: "table", Path: "builderOptions.table", Default: "logs"},
+					{Name: "limit", Type: api.ParameterTypeInt, Path: "builderOptions.limit", Default: 100},
+				},
+				Panes: api.Panes{
+					"eja": api.PaneBody{
+						Queries: []api.Query{
+							{
+								AdditionalFields: map[string]interface{}{
+									"builderOptions": map[string]interface{}{
+										"database": "somedatabase",
+										"table":    "sometable",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			patch: api.PanePatch{
+				Template: "test",
+				Params:   map[string]interface{}{"limit": "10"},
+				FixTime:  &fixTime,
+			},
+			expected: &api.GrafanaLink{
+				Metadata: api.Metadata{Name: "test"},
+				Parameters: []api.Parameter{
+					{Name: "table", Path: "builderOptions.table", Default: "logs"},
+					{Name: "limit", Type: api.ParameterTypeInt, Path: "builderOptions.limit", Default: 100},
+				},
+				Panes: api.Panes{
+					"eja": api.PaneBody{
+						Queries: []api.Query{
+							{
+								AdditionalFields: map[string]interface{}{
+									"builderOptions": map[string]interface{}{
+										"database": "somedatabase",
+										"table":    "logs",
+										"limit":    10,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "template",
+			base: &api.GrafanaLink{
+				Metadata: api.Metadata{Name: "test"},
+				Parameters: []api.Parameter{
+					{Name: "service"},
+				},
+				Panes: api.Panes{
+					"eja": api.PaneBody{
+						Queries: []api.Query{
+							{
+								RawSQL: "SELECT * FROM logs WHERE service = {{ sqlString .service }}",
+							},
+						},
+					},
+				},
+			},
+			patch: api.PanePatch{
+				Template: "test",
+				Params:   map[string]interface{}{"service": "app"},
+				FixTime:  &fixTime,
+			},
+			expected: &api.GrafanaLink{
+				Metadata: api.Metadata{Name: "test"},
+				Parameters: []api.Parameter{
+					{Name: "service"},
+				},
+				Panes: api.Panes{
+					"eja": api.PaneBody{
+						Queries: []api.Query{
+							{
+								RawSQL:           "SELECT * FROM logs WHERE service = 'app'",
+								AdditionalFields: map[string]interface{}{},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "values-not-rendered",
+			base: &api.GrafanaLink{
+				Metadata: api.Metadata{Name: "test"},
+				Parameters: []api.Parameter{
+					{Name: "service"},
+					{Name: "filter", Path: "builderOptions.simplelogQuery"},
+				},
+				Panes: api.Panes{
+					"eja": api.PaneBody{
+						Queries: []api.Query{
+							{
+								RawSQL: "SELECT * FROM logs WHERE service = {{ sqlString .service }}",
+								AdditionalFields: map[string]interface{}{
+									"builderOptions": map[string]interface{}{
+										"table": "logs",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			patch: api.PanePatch{
+				Template: "test",
+				// Values that look like templates are inserted as is; only the template and the patch are rendered.
+				Params: map[string]interface{}{"service": "app{{ .filter }}", "filter": "{{ .service }}"},
+				Query: map[string]interface{}{
+					"alias": "{{ .service }}",
+				},
+				FixTime: &fixTime,
+			},
+			expected: &api.GrafanaLink{
+				Metadata: api.Metadata{Name: "test"},
+				Parameters: []api.Parameter{
+					{Name: "service"},
+					{Name: "filter", Path: "builderOptions.simplelogQuery"},
+				},
+				Panes: api.Panes{
+					"eja": api.PaneBody{
+						Queries: []api.Query{
+							{
+								RawSQL: "SELECT * FROM logs WHERE service = 'app{{ .filter }}'",
+								AdditionalFields: map[string]interface{}{
+									"builderOptions": map[string]interface{}{
+										"table":          "logs",
+										"simplelogQuery": "{{ .service }}",
+									},
+									"alias": "app{{ .filter }}",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "dashboard",
+			base: &api.GrafanaLink{
+				Metadata: api.Metadata{Name: "test"},
+				Parameters: []api.Parameter{
+					{Name: "service", Variable: "app"},
+				},
+				Dashboard: &api.Dashboard{
+					UID: "abc123",
+				},
+			},
+			patch: api.PanePatch{
+				Template: "test",
+				Params:   map[string]interface{}{"service": "foyle"},
+				FixTime:  &fixTime,
+			},
+			expected: &api.GrafanaLink{
+				Metadata: api.Metadata{Name: "test"},
+				Parameters: []api.Parameter{
+					{Name: "service", Variable: "app"},
+				},
+				Dashboard: &api.Dashboard{
+					UID:       "abc123",
+					Variables: map[string][]string{"app": {"foyle"}},
+				},
+			},
+		},
+	}
+
+	applier := NewPatcher(FakeClock{})
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := applier.ApplyPatch([]*api.GrafanaLink{c.base}, c.patch)
+			if err != nil {
+				t.Fatalf("Error applying patch: %v", err)
+			}
+			if d := cmp.Diff(c.expected, actual); d != "" {
+				t.Fatalf("Unexpected diff:\n%v", d)
+			}
+		})
+	}
+}
+
+func Test_ApplyPatchParamsErrors(t *testing.T) {
+	type testCase struct {
+		name   string
+		params []api.Parameter
+	}
+
+	cases := []testCase{
+		{
+			name:   "misspelled-path",
+			params: []api.Parameter{{Name: "limit", Type: api.ParameterTypeInt, Path: "builderOptions.limt", Default: 100}},
+		},
+		{
+			name:   "unknown-field",
+			params: []api.Parameter{{Name: "level", Path: "level", Default: "error"}},
+		},
+		{
+			name:   "unknown-nested-field",
+			params: []api.Parameter{{Name: "level", Path: "builderOptions.level", Default: "error"}},
+		},
+	}
+
+	applier := NewPatcher(FakeClock{})
+	fixTime := false
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			base := &api.GrafanaLink{
+				Metadata:   api.Metadata{Name: "test"},
+				Parameters: c.params,
+				Panes: api.Panes{
+					"eja": api.PaneBody{
+						Queries: []api.Query{
+							{
+								AdditionalFields: map[string]interface{}{
+									"builderOptions": map[string]interface{}{
+										"table": "logs",
+									},
+								},
+							},
+						},
+					},
+				},
+			}
+			patch := api.PanePatch{Template: "test", FixTime: &fixTime}
+			if _, err := applier.ApplyPatch([]*api.GrafanaLink{base}, patch); err == nil {
+				t.Fatalf("Expected an error applying the patch")
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package grafana
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// promqlGroupingKeywords are the keywords that are followed by a list of labels in parentheses
+	// e.g. sum by (job) (...)
+	promqlGroupingKeywords = map[string]bool{
+		"by":          true,
+		"without":     true,
+		"on":          true,
+		"ignoring":    true,
+		"group_left":  true,
+		"group_right": true,
+	}
+
+	// promqlKeywords are the identifiers that aren't metric names.
+	promqlKeywords = map[string]bool{
+		"and":    true,
+		"or":     true,
+		"unless": true,
+		"bool":   true,
+		"offset": true,
+		"atan2":  true,
+		"inf":    true,
+		"nan":    true,
+	}
+)
+
+// InjectPromQL adds the label matchers to every vector selector in the PromQL expression, replacing the existing
+// matchers for the same labels, e.g. adding job="api" to sum(rate(http_requests_total[5m])) by (code)
+// yields sum(rate(http_requests_total{job="api"}[5m])) by (code)
+//
+// If expr is empty the expression is a selector with just the matchers.
+func InjectPromQL(expr string, matchers []LabelMatcher) (string, error) {
+	if strings.TrimSpace(expr) == "" {
+		if len(matchers) == 0 {
+			return "", errors.New("Unable to build a PromQL query without a label matcher")
+		}
+		return formatSelector(matchers), nil
+	}
+
+	var sb strings.Builder
+	found := false
+	i := 0
+	for i < len(expr) {
+		c := expr[i]
+		switch {
+		case c == '"' || c == '\'' || c == '`':
+			end, err := skipString(expr, i)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(expr[i:end])
+			i = end
+		case c == '#':
+			// Comments run to the end of the line.
+			end := strings.IndexByte(expr[i:], '\n')
+			if end < 0 {
+				end = len(expr) - i
+			}
+			sb.WriteString(expr[i : i+end])
+			i += end
+		case c == '[':
+			// Range and subquery durations e.g. [5m] or [1h:1m]
+			end := strings.IndexByte(expr[i:], ']')
+			if end < 0 {
+				return "", errors.Errorf("Invalid expression %v; the range at offset %v isn't closed", expr, i)
+			}
+			sb.WriteString(expr[i : i+end+1])
+			i += end + 1
+		case c == '{':
+			// A selector without a metric name e.g. {__name__="up"}
+			end, err := rewriteSelectorAt(&sb, expr, i, matchers)
+			if err != nil {
+				return "", err
+			}
+			found = true
+			i = end
+		case c >= '0' && c <= '9' || c == '.':
+			// Numbers and durations e.g. 0.5, 1e3 or 5m
+			start := i
+			for i < len(expr) && (isLabelChar(expr[i], false) || expr[i] == '.') {
+				i++
+			}
+			sb.WriteString(expr[start:i])
+		case isMetricChar(c, true):
+			start := i
+			for i < len(expr) && isMetricChar(expr[i], false) {
+				i++
+			}
+			name := expr[start:i]
+			sb.WriteString(name)
+
+			next := skipSpace(expr, i)
+			switch {
+			case promqlGroupingKeywords[strings.ToLower(name)]:
+				// Copy the list of labels so that they aren't mistaken for metrics.
+				if next < len(expr) && expr[next] == '(' {
+					end := strings.IndexByte(expr[next:], ')')
+					if end < 0 {
+						return "", errors.Errorf("Invalid expression %v; the label list at offset %v isn't closed", expr, next)
+					}
+					sb.WriteString(expr[i : next+end+1])
+					i = next + end + 1
+				}
+			case promqlKeywords[strings.ToLower(name)]:
+			case next < len(expr) && expr[next] == '(':
+				// A function or aggregation.
+			case promqlGroupingKeywords[strings.ToLower(nextIdentifier(expr, next))]:
+				// An aggregation with the grouping before the expression e.g. sum by (job) (...)
+			case next < len(expr) && expr[next] == '{':
+				sb.WriteString(expr[i:next])
+				end, err := rewriteSelectorAt(&sb, expr, next, matchers)
+				if err != nil {
+					return "", err
+				}
+				found = true
+				i = end
+			default:
+				sb.WriteString(formatSelector(matchers))
+				found = true
+			}
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+
+	if !found {
+		return "", errors.Errorf("PromQL expression %v doesn't have a vector selector", expr)
+	}
+	return sb.String(), nil
+}
+
+// rewriteSelectorAt writes the selector starting at offset start, with the matchers merged into it, to sb.
+// It returns the offset just past the end of the selector.
+func rewriteSelectorAt(sb *strings.Builder, expr string, start int, matchers []LabelMatcher) (int, error) {
+	spans, err := findSelectors(expr[start:])
+	if err != nil {
+		return 0, err
+	}
+	if len(spans) == 0 {
+		return 0, errors.Errorf("Invalid expression %v; the selector at offset %v isn't closed", expr, start)
+	}
+	end := start + spans[0].end
+	existing, err := parseMatchers(expr[start+1 : end-1])
+	if err != nil {
+		return 0, err
+	}
+	sb.WriteString(formatSelector(mergeMatchers(existing, matchers)))
+	return end, nil
+}
+
+// nextIdentifier returns the identifier starting at offset i or the empty string if there isn't one.
+func nextIdentifier(expr string, i int) string {
+	start := i
+	for i < len(expr) && isLabelChar(expr[i], i == start) {
+		i++
+	}
+	return expr[start:i]
+}
+
+func skipSpace(expr string, i int) int {
+	for i < len(expr) && (expr[i] == ' ' || expr[i] == '\t' || expr[i] == '\n' || expr[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+// isMetricChar returns true if c can be part of a metric name. Unlike label names metric names can contain colons.
+func isMetricChar(c byte, first bool) bool {
+	return c == ':' || isLabelChar(c, first)
+}
@@ -0,0 +1,150 @@
+package grafana
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/grafctl/api"
+)
+
+func Test_InjectPromQL(t *testing.T) {
+	job := []LabelMatcher{{Name: "job", Op: "=", Value: "api"}}
+
+	type testCase struct {
+		name      string
+		expr      string
+		matchers  []LabelMatcher
+		expected  string
+		expectErr bool
+	}
+
+	cases := []testCase{
+		{
+			name:     "bare",
+			expr:     "up",
+			matchers: job,
+			expected: `up{job="api"}`,
+		},
+		{
+			name:     "range",
+			expr:     `sum(rate(http_requests_total[5m])) by (code)`,
+			matchers: job,
+			expected: `sum(rate(http_requests_total{job="api"}[5m])) by (code)`,
+		},
+		{
+			name:     "existing",
+			expr:     `sum by (code) (rate(http_requests_total{job="web", code=~"5.."}[5m]))`,
+			matchers: job,
+			expected: `sum by (code) (rate(http_requests_total{code=~"5..", job="api"}[5m]))`,
+		},
+		{
+			name:     "binary",
+			expr:     `rate(errors_total[5m]) / on(instance) group_left(version) rate(requests_total[5m] offset 1h) > 0.05`,
+			matchers: job,
+			expected: `rate(errors_total{job="api"}[5m]) / on(instance) group_left(version) rate(requests_total{job="api"}[5m] offset 1h) > 0.05`,
+		},
+		{
+			name:     "no-name",
+			expr:     `count({__name__=~"node_.*"})`,
+			matchers: job,
+			expected: `count({__name__=~"node_.*", job="api"})`,
+		},
+		{
+			name:     "recording-rule",
+			expr:     `histogram_quantile(0.99, job:request_latency_seconds:rate5m{le!=""}[1h:5m])`,
+			matchers: job,
+			expected: `histogram_quantile(0.99, job:request_latency_seconds:rate5m{le!="", job="api"}[1h:5m])`,
+		},
+		{
+			name:     "label-replace",
+			expr:     `label_replace(up, "host", "$1", "instance", "(.*):.*")`,
+			matchers: job,
+			expected: `label_replace(up{job="api"}, "host", "$1", "instance", "(.*):.*")`,
+		},
+		{
+			name:     "empty",
+			matchers: job,
+			expected: `{job="api"}`,
+		},
+		{
+			name:      "no-selector",
+			expr:      `vector(1)`,
+			matchers:  job,
+			expectErr: true,
+		},
+		{
+			name:      "unclosed",
+			expr:      `up{job="api"`,
+			matchers:  job,
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := InjectPromQL(c.expr, c.matchers)
+			if c.expectErr {
+				if err == nil {
+					t.Fatalf("Expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to inject matchers: %v", err)
+			}
+			if actual != c.expected {
+				t.Errorf("Got %v;\n Want %v", actual, c.expected)
+			}
+		})
+	}
+}
+
+func Test_ApplyPatchPrometheusParams(t *testing.T) {
+	fixTime := false
+	base := &api.GrafanaLink{
+		Metadata: api.Metadata{Name: "test"},
+		Parameters: []api.Parameter{
+			{Name: "service", Label: "service"},
+			{Name: "code", Label: "code", Operator: "=~", Default: "5.."},
+		},
+		Panes: api.Panes{
+			"eja": api.PaneBody{
+				Datasource: "promuid",
+				Queries: []api.Query{
+					{
+						RefID:      "A",
+						Datasource: api.Datasource{Type: "prometheus", UID: "promuid"},
+						Expr:       `sum(rate(http_requests_total[5m])) by (code)`,
+						Range:      true,
+						Interval:   "1m",
+					},
+				},
+			},
+		},
+	}
+
+	patch := api.PanePatch{
+		Template: "test",
+		Params:   map[string]interface{}{"service": "app"},
+		FixTime:  &fixTime,
+	}
+
+	actual, err := NewPatcher(FakeClock{}).ApplyPatch([]*api.GrafanaLink{base}, patch)
+	if err != nil {
+		t.Fatalf("Error applying patch: %v", err)
+	}
+
+	expected := []api.Query{
+		{
+			RefID:            "A",
+			Datasource:       api.Datasource{Type: "prometheus", UID: "promuid"},
+			Expr:             `sum(rate(http_requests_total{service="app", code=~"5.."}[5m])) by (code)`,
+			Range:            true,
+			Interval:         "1m",
+			AdditionalFields: map[string]interface{}{},
+		},
+	}
+	if d := cmp.Diff(expected, actual.Panes["eja"].Queries); d != "" {
+		t.Errorf("Unexpected diff:\n%v", d)
+	}
+}
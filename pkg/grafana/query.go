@@ -0,0 +1,288 @@
+package grafana
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jlewi/grafctl/api"
+	"github.com/pkg/errors"
+)
+
+const (
+	// OutputTable, OutputJSON and OutputCSV are the formats for printing query results.
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputCSV   = "csv"
+)
+
+// QueryRequest is the body of a request to the query API.
+// https://grafana.com/docs/grafana/latest/developers/http_api/data_source/#query-a-data-source
+type QueryRequest struct {
+	// Pane is the ID of the pane the queries are from. It isn't sent to Grafana.
+	Pane    string      `json:"-"`
+	Queries []api.Query `json:"queries"`
+	// From and To are the time range of the queries. They can be epoch milliseconds or relative times like now-1h.
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// QueryResponse is the response of the query API. Results maps the refId of each query to its result.
+type QueryResponse struct {
+	Results map[string]QueryResult `json:"results"`
+}
+
+// QueryResult is the result of a single query.
+type QueryResult struct {
+	Status int     `json:"status,omitempty"`
+	Error  string  `json:"error,omitempty"`
+	Frames []Frame `json:"frames,omitempty"`
+}
+
+// Frame is a data frame; a table of columns (fields) of equal length.
+// https://grafana.com/developers/plugin-tools/introduction/data-frames
+type Frame struct {
+	Schema FrameSchema `json:"schema"`
+	Data   FrameData   `json:"data"`
+}
+
+type FrameSchema struct {
+	Name   string       `json:"name,omitempty"`
+	RefID  string       `json:"refId,omitempty"`
+	Fields []FrameField `json:"fields"`
+}
+
+type FrameField struct {
+	Name   string            `json:"name"`
+	Type   string            `json:"type,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type FrameData struct {
+	// Values are the columns of the frame; Values[i] holds the values of the i-th field.
+	Values [][]any `json:"values"`
+}
+
+// Query runs the queries using the query API. The queries must have their datasources set.
+func (c *Client) Query(ctx context.Context, request QueryRequest) (*QueryResponse, error) {
+	// N.B. The API returns a 207 (multi status) when some of the queries fail. The errors are reported in the
+	// results of the individual queries.
+	resp := &QueryResponse{}
+	if err := c.do(ctx, http.MethodPost, "/api/ds/query", nil, request, resp); err != nil {
+		return nil, errors.Wrapf(err, "Failed to run queries")
+	}
+	return resp, nil
+}
+
+// LinkToQueryRequests converts the panes of an Explore link into requests for the query API; one request per pane
+// since each pane has its own time range. Queries without a datasource inherit the datasource of the pane.
+func LinkToQueryRequests(link api.GrafanaLink) ([]QueryRequest, error) {
+	if link.Dashboard != nil {
+		return nil, errors.New("Dashboard links can't be queried; only Explore links can be queried")
+	}
+
+	requests := make([]QueryRequest, 0, len(link.Panes))
+	for _, id := range paneIDs(link.Panes) {
+		pane := link.Panes[id]
+		queries := make([]api.Query, 0, len(pane.Queries))
+		for _, q := range pane.Queries {
+			if q.Datasource.UID == "" {
+				q.Datasource.UID = pane.Datasource
+			}
+			if q.Datasource.UID == "" {
+				return nil, errors.Errorf("Query %v in pane %v doesn't have a datasource", q.RefID, id)
+			}
+			queries = append(queries, q)
+		}
+		requests = append(requests, QueryRequest{
+			Pane:    id,
+			Queries: queries,
+			From:    pane.Range.From,
+			To:      pane.Range.To,
+		})
+	}
+	return requests, nil
+}
+
+// WriteQueryResponses writes the responses to the requests for the panes of a link to w in the given format.
+// responses are keyed by the ID of the pane. JSON is written as a single object keyed by the ID of the pane so the
+// output can be parsed as one document; tables and CSV are written one pane after another in order of the IDs.
+func WriteQueryResponses(w io.Writer, responses map[string]*QueryResponse, format string) error {
+	switch format {
+	case OutputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(responses)
+	case OutputTable, OutputCSV:
+	default:
+		return errors.Errorf("Unknown output format %v; format should be one of %v", format, []string{OutputTable, OutputJSON, OutputCSV})
+	}
+	for _, id := range sortedKeys(responses) {
+		if err := WriteQueryResponse(w, responses[id], format); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteQueryResponse writes the frames in the response to w in the given format.
+func WriteQueryResponse(w io.Writer, resp *QueryResponse, format string) error {
+	switch format {
+	case OutputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(resp)
+	case OutputTable, OutputCSV:
+	default:
+		return errors.Errorf("Unknown output format %v; format should be one of %v", format, []string{OutputTable, OutputJSON, OutputCSV})
+	}
+
+	refIDs := make([]string, 0, len(resp.Results))
+	for refID := range resp.Results {
+		refIDs = append(refIDs, refID)
+	}
+	sort.Strings(refIDs)
+
+	for _, refID := range refIDs {
+		result := resp.Results[refID]
+		if result.Error != "" {
+			if _, err := fmt.Fprintf(w, "Query %v failed: %v\n", refID, result.Error); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, frame := range result.Frames {
+			var err error
+			if format == OutputCSV {
+				err = writeFrameCSV(w, frame)
+			} else {
+				err = writeFrameTable(w, frame)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeFrameTable(w io.Writer, frame Frame) error {
+	name := frame.Schema.Name
+	if name == "" {
+		name = frame.Schema.RefID
+	}
+	if _, err := fmt.Fprintf(w, "%v\n", name); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, strings.Join(frameHeader(frame), "\t")); err != nil {
+		return err
+	}
+	for _, row := range frameRows(frame) {
+		if _, err := fmt.Fprintln(tw, strings.Join(row, "\t")); err != nil {
+			return err
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+func writeFrameCSV(w io.Writer, frame Frame) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(frameHeader(frame)); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(frameRows(frame)); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// frameHeader returns the names of the columns. Labels are included in the name because frames of time series
+// often have the same field name and differ only in their labels.
+func frameHeader(frame Frame) []string {
+	header := make([]string, 0, len(frame.Schema.Fields))
+	for _, f := range frame.Schema.Fields {
+		name := f.Name
+		if len(f.Labels) > 0 {
+			keys := make([]string, 0, len(f.Labels))
+			for k := range f.Labels {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			labels := make([]string, 0, len(keys))
+			for _, k := range keys {
+				labels = append(labels, fmt.Sprintf("%v=%q", k, f.Labels[k]))
+			}
+			name = fmt.Sprintf("%v{%v}", name, strings.Join(labels, ", "))
+		}
+		header = append(header, name)
+	}
+	return header
+}
+
+// frameRows transposes the columns of the frame into rows of formatted values.
+func frameRows(frame Frame) [][]string {
+	numRows := 0
+	for _, col := range frame.Data.Values {
+		if len(col) > numRows {
+			numRows = len(col)
+		}
+	}
+
+	rows := make([][]string, 0, numRows)
+	for i := 0; i < numRows; i++ {
+		row := make([]string, 0, len(frame.Data.Values))
+		for j, col := range frame.Data.Values {
+			fieldType := ""
+			if j < len(frame.Schema.Fields) {
+				fieldType = frame.Schema.Fields[j].Type
+			}
+			value := ""
+			if i < len(col) {
+				value = formatFrameValue(col[i], fieldType)
+			}
+			row = append(row, value)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func formatFrameValue(v any, fieldType string) string {
+	if v == nil {
+		return ""
+	}
+	// Time fields are encoded as epoch milliseconds.
+	if millis, ok := v.(float64); ok && fieldType == "time" {
+		return time.UnixMilli(int64(millis)).UTC().Format(time.RFC3339Nano)
+	}
+	switch value := v.(type) {
+	case string:
+		return value
+	case float64:
+		// Use plain notation so that large counts and timestamps aren't printed as e.g. 1.234567e+06.
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	default:
+		b, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Sprintf("%v", value)
+		}
+		return string(b)
+	}
+}
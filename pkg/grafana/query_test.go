@@ -0,0 +1,259 @@
+package grafana
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/grafctl/api"
+)
+
+var (
+	testQueryResponse = &QueryResponse{
+		Results: map[string]QueryResult{
+			"A": {
+				Status: 200,
+				Frames: []Frame{
+					{
+						Schema: FrameSchema{
+							RefID: "A",
+							Fields: []FrameField{
+								{Name: "timestamp", Type: "time"},
+								{Name: "body", Type: "string"},
+							},
+						},
+						Data: FrameData{
+							Values: [][]any{
+								{float64(1708863900000), float64(1708863960000)},
+								{"started", "stopped, cleanly"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+)
+
+func Test_ClientQuery(t *testing.T) {
+	f := newFakeGrafana(t)
+	f.queryResponse = testQueryResponse
+	c := f.client(t)
+
+	link := api.GrafanaLink{
+		Panes: api.Panes{
+			"eja": api.PaneBody{
+				Datasource: "someuid",
+				Queries: []api.Query{
+					{
+						RefID:  "A",
+						RawSQL: "SELECT * FROM logs",
+						AdditionalFields: map[string]any{
+							"customarg": "customvalue",
+						},
+					},
+				},
+				Range: api.TimeRange{
+					From: "1708863900000",
+					To:   "1708867500000",
+				},
+			},
+		},
+	}
+
+	requests, err := LinkToQueryRequests(link)
+	if err != nil {
+		t.Fatalf("Failed to convert link to requests: %v", err)
+	}
+	if len(requests) != 1 {
+		t.Fatalf("Got %v requests; want 1", len(requests))
+	}
+
+	resp, err := c.Query(context.Background(), requests[0])
+	if err != nil {
+		t.Fatalf("Failed to run query: %v", err)
+	}
+
+	if d := cmp.Diff(testQueryResponse, resp); d != "" {
+		t.Errorf("Unexpected diff in response:\n%v", d)
+	}
+
+	expectedRequest := map[string]any{
+		"from": "1708863900000",
+		"to":   "1708867500000",
+		"queries": []any{
+			map[string]any{
+				"refId":      "A",
+				"rawSql":     "SELECT * FROM logs",
+				"customarg":  "customvalue",
+				"datasource": map[string]any{"uid": "someuid"},
+			},
+		},
+	}
+	if d := cmp.Diff(expectedRequest, f.queries[0]); d != "" {
+		t.Errorf("Unexpected diff in request:\n%v", d)
+	}
+}
+
+func Test_WriteQueryResponse(t *testing.T) {
+	type testCase struct {
+		name     string
+		format   string
+		expected string
+	}
+
+	cases := []testCase{
+		{
+			name:   "table",
+			format: OutputTable,
+			expected: `A
+timestamp             body
+2024-02-25T12:25:00Z  started
+2024-02-25T12:26:00Z  stopped, cleanly
+
+`,
+		},
+		{
+			name:   "csv",
+			format: OutputCSV,
+			expected: `timestamp,body
+2024-02-25T12:25:00Z,started
+2024-02-25T12:26:00Z,"stopped, cleanly"
+`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			if err := WriteQueryResponse(b, testQueryResponse, c.format); err != nil {
+				t.Fatalf("Failed to write response: %v", err)
+			}
+			if d := cmp.Diff(c.expected, b.String()); d != "" {
+				t.Errorf("Unexpected diff:\n%v", d)
+			}
+		})
+	}
+}
+
+func Test_LinkToQueryRequests(t *testing.T) {
+	link := api.GrafanaLink{
+		Panes: api.Panes{
+			"metrics": api.PaneBody{
+				Datasource: "promuid",
+				Queries: []api.Query{
+					{RefID: "A", Expr: "up"},
+				},
+				Range: api.TimeRange{From: "now-6h", To: "now"},
+			},
+			"logs": api.PaneBody{
+				Datasource: "lokiuid",
+				Queries: []api.Query{
+					{RefID: "A", Expr: `{service="app"}`},
+					{RefID: "B", Expr: `{service="db"}`, Datasource: api.Datasource{UID: "otheruid"}},
+				},
+				Range: api.TimeRange{From: "now-1h", To: "now"},
+			},
+		},
+	}
+
+	requests, err := LinkToQueryRequests(link)
+	if err != nil {
+		t.Fatalf("Failed to convert link to requests: %v", err)
+	}
+
+	expected := []QueryRequest{
+		{
+			Pane: "logs",
+			Queries: []api.Query{
+				{RefID: "A", Expr: `{service="app"}`, Datasource: api.Datasource{UID: "lokiuid"}},
+				{RefID: "B", Expr: `{service="db"}`, Datasource: api.Datasource{UID: "otheruid"}},
+			},
+			From: "now-1h",
+			To:   "now",
+		},
+		{
+			Pane: "metrics",
+			Queries: []api.Query{
+				{RefID: "A", Expr: "up", Datasource: api.Datasource{UID: "promuid"}},
+			},
+			From: "now-6h",
+			To:   "now",
+		},
+	}
+	if d := cmp.Diff(expected, requests); d != "" {
+		t.Errorf("Unexpected diff:\n%v", d)
+	}
+}
+
+func Test_WriteQueryResponses(t *testing.T) {
+	responses := map[string]*QueryResponse{
+		"logs": testQueryResponse,
+		"metrics": {
+			Results: map[string]QueryResult{
+				"A": {Status: 400, Error: "bad query"},
+			},
+		},
+	}
+
+	// JSON is a single document keyed by the ID of the pane.
+	b := &bytes.Buffer{}
+	if err := WriteQueryResponses(b, responses, OutputJSON); err != nil {
+		t.Fatalf("Failed to write responses: %v", err)
+	}
+	decoded := map[string]*QueryResponse{}
+	decoder := json.NewDecoder(b)
+	if err := decoder.Decode(&decoded); err != nil {
+		t.Fatalf("Failed to decode the output as a single JSON document: %v", err)
+	}
+	if decoder.More() {
+		t.Errorf("The output has more than one JSON document")
+	}
+	if d := cmp.Diff(responses, decoded); d != "" {
+		t.Errorf("Unexpected diff:\n%v", d)
+	}
+
+	b.Reset()
+	if err := WriteQueryResponses(b, responses, OutputTable); err != nil {
+		t.Fatalf("Failed to write responses: %v", err)
+	}
+	expected := `A
+timestamp             body
+2024-02-25T12:25:00Z  started
+2024-02-25T12:26:00Z  stopped, cleanly
+
+Query A failed: bad query
+`
+	if d := cmp.Diff(expected, b.String()); d != "" {
+		t.Errorf("Unexpected diff:\n%v", d)
+	}
+
+	if err := WriteQueryResponses(b, responses, "yaml"); err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+}
+
+func Test_formatFrameValue(t *testing.T) {
+	type testCase struct {
+		value     any
+		fieldType string
+		expected  string
+	}
+
+	cases := []testCase{
+		{value: float64(1234567), fieldType: "number", expected: "1234567"},
+		{value: 1.5e12, fieldType: "number", expected: "1500000000000"},
+		{value: 0.25, fieldType: "number", expected: "0.25"},
+		{value: float64(1708863900000), fieldType: "time", expected: "2024-02-25T12:25:00Z"},
+		{value: true, fieldType: "boolean", expected: "true"},
+		{value: nil, fieldType: "string", expected: ""},
+	}
+
+	for _, c := range cases {
+		if actual := formatFrameValue(c.value, c.fieldType); actual != c.expected {
+			t.Errorf("formatFrameValue(%v, %v) = %v; want %v", c.value, c.fieldType, actual, c.expected)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package grafana
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/jlewi/grafctl/api"
+	"github.com/pkg/errors"
+)
+
+var (
+	// AdditionalFieldTypes are the types of additional fields of queries that have a known shape.
+	AdditionalFieldTypes = map[string]reflect.Type{
+		"builderOptions": reflect.TypeOf(api.BuilderOptions{}),
+	}
+
+	queryType = reflect.TypeOf(api.Query{})
+)
+
+// CheckQueryPath checks that the dot separated path is a field of the query. Each key in the path must either be a
+// field of the type of the parent, if its type is known, or a key of the parent's value in the query; e.g.
+// builderOptions.orderBy is allowed when the query's builderOptions has an orderBy even though BuilderOptions doesn't
+// declare it. Otherwise the value set at the path would be silently dropped or add an unused field.
+func CheckQueryPath(q *api.Query, path string) error {
+	keys := strings.Split(path, ".")
+	for _, k := range keys {
+		if k == "" {
+			return errors.Errorf("Invalid path %v; path should be a dot separated list of field names", path)
+		}
+	}
+
+	fields := YAMLFields(queryType)
+	t, typed := fields[keys[0]]
+	var value interface{}
+	hasValue := false
+	if !typed {
+		// The values of additional fields in the template tell us which keys they have even if the type isn't known.
+		value, hasValue = q.AdditionalFields[keys[0]]
+		t = AdditionalFieldTypes[keys[0]]
+	}
+	if !typed && !hasValue && t == nil {
+		names := sortedKeys(fields)
+		for k := range q.AdditionalFields {
+			names = append(names, k)
+		}
+		return errors.Errorf("Invalid path %v; %v isn't a field of the query%v", path, keys[0], Suggest(keys[0], names))
+	}
+
+	for i, k := range keys[1:] {
+		parent := strings.Join(keys[:i+1], ".")
+		for t != nil && t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+
+		m, isMap := value.(map[string]interface{})
+		if t != nil && (t.Kind() == reflect.Map || t.Kind() == reflect.Interface) {
+			// Any key is allowed.
+			return nil
+		}
+		if (t == nil || t.Kind() != reflect.Struct) && !isMap {
+			return errors.Errorf("Invalid path %v; %v isn't an object", path, parent)
+		}
+
+		sub := map[string]reflect.Type{}
+		if t != nil && t.Kind() == reflect.Struct {
+			sub = YAMLFields(t)
+		}
+		next, nextTyped := sub[k]
+		nextValue, nextHasValue := m[k]
+		if !nextTyped && !nextHasValue {
+			names := sortedKeys(sub)
+			for name := range m {
+				if _, ok := sub[name]; !ok {
+					names = append(names, name)
+				}
+			}
+			return errors.Errorf("Invalid path %v; %v isn't a field of %v%v", path, k, parent, Suggest(k, names))
+		}
+		t, value = next, nextValue
+	}
+	return nil
+}
+
+// YAMLFields returns a map from the YAML names of the fields of the struct to their types.
+func YAMLFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// Suggest returns a hint naming the field that key was most likely meant to be.
+func Suggest(key string, names []string) string {
+	sort.Strings(names)
+
+	lower := strings.ToLower(key)
+	for _, name := range names {
+		n := strings.ToLower(name)
+		if n == lower || levenshtein(n, lower) <= 2 || (len(lower) >= 4 && strings.HasSuffix(n, lower)) {
+			return fmt.Sprintf("; did you mean %v?", name)
+		}
+	}
+	return fmt.Sprintf("; the fields are %v", names)
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,73 @@
+package grafana
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/grafctl/api"
+)
+
+func Test_CheckQueryPath(t *testing.T) {
+	q := &api.Query{
+		RawSQL: "SELECT * FROM logs",
+		AdditionalFields: map[string]interface{}{
+			"builderOptions": map[string]interface{}{
+				"table":   "logs",
+				"orderBy": []interface{}{map[string]interface{}{"name": "Timestamp", "dir": "DESC"}},
+			},
+			"customarg": map[string]interface{}{
+				"nested": "somevalue",
+			},
+		},
+	}
+
+	type testCase struct {
+		path     string
+		expected string
+	}
+
+	cases := []testCase{
+		{path: "rawSql"},
+		{path: "datasource.uid"},
+		{path: "builderOptions.limit"},
+		{path: "builderOptions.orderBy"},
+		{path: "customarg.nested"},
+		{path: "builderOptions.limt", expected: "Invalid path builderOptions.limt; limt isn't a field of builderOptions; did you mean limit?"},
+		{path: "customarg.other", expected: "Invalid path customarg.other; other isn't a field of customarg; the fields are [nested]"},
+		{path: "rawSQL", expected: "Invalid path rawSQL; rawSQL isn't a field of the query; did you mean rawSql?"},
+		{path: "rawSql.text", expected: "Invalid path rawSql.text; rawSql isn't an object"},
+		{path: "builderOptions..table", expected: "Invalid path builderOptions..table; path should be a dot separated list of field names"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.path, func(t *testing.T) {
+			actual := ""
+			if err := CheckQueryPath(q, c.path); err != nil {
+				actual = err.Error()
+			}
+			if d := cmp.Diff(c.expected, actual); d != "" {
+				t.Errorf("Unexpected diff:\n%v", d)
+			}
+		})
+	}
+}
+
+func Test_Suggest(t *testing.T) {
+	fields := sortedKeys(YAMLFields(reflect.TypeOf(api.BuilderOptions{})))
+	type testCase struct {
+		key      string
+		expected string
+	}
+	cases := []testCase{
+		{key: "Database", expected: "; did you mean database?"},
+		{key: "logQuery", expected: "; did you mean simplelogQuery?"},
+	}
+	for _, c := range cases {
+		t.Run(c.key, func(t *testing.T) {
+			if d := cmp.Diff(c.expected, Suggest(c.key, fields)); d != "" {
+				t.Errorf("Unexpected diff:\n%v", d)
+			}
+		})
+	}
+}
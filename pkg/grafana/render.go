@@ -0,0 +1,221 @@
+package grafana
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/jlewi/grafctl/api"
+	"github.com/pkg/errors"
+)
+
+var (
+	// unrenderedFields are the fields of a query that are never rendered as templates because Grafana uses {{ }} in
+	// them for its own purposes e.g. legendFormat: "{{pod}}" in Prometheus and Loki queries.
+	unrenderedFields = map[string]bool{
+		"legendFormat": true,
+	}
+
+	// templateFuncs are the functions available in templates. They quote values so that parameters can't change
+	// the structure of the query.
+	templateFuncs = template.FuncMap{
+		"sqlString":        sqlString,
+		"sqlIdent":         sqlIdent,
+		"clickhouseString": clickhouseString,
+		"clickhouseIdent":  clickhouseIdent,
+		"logqlString":      logqlString,
+		"promqlString":     promqlString,
+		"regexEscape":      regexEscape,
+	}
+)
+
+// RenderTemplate renders text as a Go text/template using values. It is an error for the template to refer to a
+// value that isn't set.
+func RenderTemplate(name string, text string, values map[string]interface{}) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	t, err := template.New(name).Option("missingkey=error").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to parse the template in %v", name)
+	}
+
+	var sb strings.Builder
+	if err := t.Execute(&sb, values); err != nil {
+		return "", errors.Wrapf(err, "Failed to render the template in %v", name)
+	}
+	return sb.String(), nil
+}
+
+// RenderQuery renders the templates in all the string fields of the query using values.
+func RenderQuery(q *api.Query, values map[string]interface{}) error {
+	b, err := json.Marshal(q)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to marshal query")
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return errors.Wrapf(err, "Failed to unmarshal query")
+	}
+
+	rendered, err := renderValue("", fields, values)
+	if err != nil {
+		return err
+	}
+
+	b, err = json.Marshal(rendered)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to marshal rendered query")
+	}
+	result := api.Query{}
+	if err := json.Unmarshal(b, &result); err != nil {
+		return errors.Wrapf(err, "Failed to unmarshal rendered query")
+	}
+	*q = result
+	return nil
+}
+
+// renderPatch returns a copy of the patch with the templates in the string values of its queries, panes and
+// operations rendered using values. Patches are rendered before they are applied so that the values of
+// parameters, which are inserted into the queries afterwards, are never evaluated as templates.
+func renderPatch(patch api.PanePatch, values map[string]interface{}) (api.PanePatch, error) {
+	r, err := renderValue("query", patch.Query, values)
+	if err != nil {
+		return patch, err
+	}
+	patch.Query = r.(map[string]interface{})
+
+	if patch.Targets != nil {
+		targets := make([]api.QueryPatch, len(patch.Targets))
+		for i, t := range patch.Targets {
+			r, err := renderValue("targets["+strconv.Itoa(i)+"].query", t.Query, values)
+			if err != nil {
+				return patch, err
+			}
+			t.Query = r.(map[string]interface{})
+			targets[i] = t
+		}
+		patch.Targets = targets
+	}
+
+	if patch.Panes != nil {
+		panes := make(map[string]map[string]interface{}, len(patch.Panes))
+		for id, body := range patch.Panes {
+			r, err := renderValue("panes."+id, body, values)
+			if err != nil {
+				return patch, err
+			}
+			panes[id] = r.(map[string]interface{})
+		}
+		patch.Panes = panes
+	}
+
+	if patch.Operations != nil {
+		ops := make([]api.Operation, len(patch.Operations))
+		for i, op := range patch.Operations {
+			r, err := renderValue("operations["+strconv.Itoa(i)+"].value", op.Value, values)
+			if err != nil {
+				return patch, err
+			}
+			op.Value = r
+			ops[i] = op
+		}
+		patch.Operations = ops
+	}
+	return patch, nil
+}
+
+// renderValue recursively renders the strings in value and returns the result; value isn't modified. path is the
+// dot separated path of value and is used in error messages.
+func renderValue(path string, value interface{}, values map[string]interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return RenderTemplate(path, v, values)
+	case map[string]interface{}:
+		if v == nil {
+			return v, nil
+		}
+		rendered := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			if unrenderedFields[k] {
+				rendered[k] = child
+				continue
+			}
+			childPath := k
+			if path != "" {
+				childPath = path + "." + k
+			}
+			r, err := renderValue(childPath, child, values)
+			if err != nil {
+				return nil, err
+			}
+			rendered[k] = r
+		}
+		return rendered, nil
+	case []interface{}:
+		if v == nil {
+			return v, nil
+		}
+		rendered := make([]interface{}, len(v))
+		for i, child := range v {
+			r, err := renderValue(path+"["+strconv.Itoa(i)+"]", child, values)
+			if err != nil {
+				return nil, err
+			}
+			rendered[i] = r
+		}
+		return rendered, nil
+	}
+	return value, nil
+}
+
+// sqlString quotes the value as a standard SQL string literal; single quotes are escaped by doubling them.
+// Use clickhouseString for ClickHouse queries.
+func sqlString(value interface{}) string {
+	return "'" + strings.ReplaceAll(toString(value), "'", "''") + "'"
+}
+
+// sqlIdent quotes the value as a standard SQL identifier e.g. a column or table name; double quotes are escaped by
+// doubling them. Use clickhouseIdent for ClickHouse queries.
+func sqlIdent(value interface{}) string {
+	return `"` + strings.ReplaceAll(toString(value), `"`, `""`) + `"`
+}
+
+// clickhouseString quotes the value as a ClickHouse string literal. ClickHouse, like MySQL, treats backslashes in
+// strings as escape characters so they are escaped before single quotes are doubled; otherwise a trailing backslash
+// would escape the closing quote.
+func clickhouseString(value interface{}) string {
+	return sqlString(strings.ReplaceAll(toString(value), `\`, `\\`))
+}
+
+// clickhouseIdent quotes the value as a ClickHouse identifier. Like clickhouseString, backslashes are escaped
+// before double quotes are doubled.
+func clickhouseIdent(value interface{}) string {
+	return sqlIdent(strings.ReplaceAll(toString(value), `\`, `\\`))
+}
+
+// logqlString quotes the value as a LogQL string e.g. for a label matcher or line filter.
+// LogQL strings use Go's syntax for string literals.
+func logqlString(value interface{}) string {
+	return strconv.Quote(toString(value))
+}
+
+// promqlString quotes the value as a PromQL string e.g. for a label matcher.
+// PromQL strings use Go's escaping rules.
+func promqlString(value interface{}) string {
+	return strconv.Quote(toString(value))
+}
+
+// regexEscape escapes the regular expression metacharacters in the value so that it matches literally.
+// Quote the result with logqlString or promqlString to use it in a regex label matcher.
+func regexEscape(value interface{}) string {
+	return regexp.QuoteMeta(toString(value))
+}
+
+func toString(value interface{}) string {
+	return fmt.Sprintf("%v", value)
+}
@@ -0,0 +1,127 @@
+package grafana
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/grafctl/api"
+)
+
+func Test_RenderTemplate(t *testing.T) {
+	type testCase struct {
+		name      string
+		text      string
+		values    map[string]interface{}
+		expected  string
+		expectErr bool
+	}
+
+	cases := []testCase{
+		{
+			name:     "no-template",
+			text:     "SELECT * FROM logs",
+			expected: "SELECT * FROM logs",
+		},
+		{
+			name:     "value",
+			text:     "SELECT * FROM logs LIMIT {{ .limit }}",
+			values:   map[string]interface{}{"limit": 10},
+			expected: "SELECT * FROM logs LIMIT 10",
+		},
+		{
+			name:     "sql",
+			text:     "SELECT * FROM {{ sqlIdent .table }} WHERE service = {{ sqlString .service }}",
+			values:   map[string]interface{}{"table": `my"logs`, "service": "o'brien"},
+			expected: `SELECT * FROM "my""logs" WHERE service = 'o''brien'`,
+		},
+		{
+			name:     "sql-backslash",
+			text:     "SELECT * FROM {{ sqlIdent .table }} WHERE service = {{ sqlString .service }}",
+			values:   map[string]interface{}{"table": `logs\`, "service": `C:\temp\`},
+			expected: `SELECT * FROM "logs\" WHERE service = 'C:\temp\'`,
+		},
+		{
+			name:     "clickhouse",
+			text:     "SELECT * FROM {{ clickhouseIdent .table }} WHERE service = {{ clickhouseString .service }} LIMIT 10",
+			values:   map[string]interface{}{"table": `logs\" --`, "service": `x\' OR 1=1 --`},
+			expected: `SELECT * FROM "logs\\"" --" WHERE service = 'x\\'' OR 1=1 --' LIMIT 10`,
+		},
+		{
+			name:     "logql",
+			text:     `{service={{ logqlString .service }}} |= {{ logqlString .filter }}`,
+			values:   map[string]interface{}{"service": "app", "filter": `say "hi"`},
+			expected: `{service="app"} |= "say \"hi\""`,
+		},
+		{
+			name:     "promql-regex",
+			text:     `rate(http_requests_total{path=~{{ promqlString (regexEscape .path) }}}[5m])`,
+			values:   map[string]interface{}{"path": "/api/v1.0"},
+			expected: `rate(http_requests_total{path=~"/api/v1\\.0"}[5m])`,
+		},
+		{
+			name:      "missing",
+			text:      "SELECT * FROM logs WHERE service = {{ sqlString .service }}",
+			values:    map[string]interface{}{},
+			expectErr: true,
+		},
+		{
+			name:      "invalid",
+			text:      "SELECT * FROM logs WHERE service = {{ .service ",
+			values:    map[string]interface{}{"service": "app"},
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := RenderTemplate(c.name, c.text, c.values)
+			if c.expectErr {
+				if err == nil {
+					t.Fatalf("Expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to render template: %v", err)
+			}
+			if actual != c.expected {
+				t.Errorf("Got %v;\n Want %v", actual, c.expected)
+			}
+		})
+	}
+}
+
+func Test_RenderQuery(t *testing.T) {
+	q := &api.Query{
+		RefID:        "A",
+		RawSQL:       "SELECT * FROM logs WHERE service = {{ sqlString .service }}",
+		Expr:         `{service={{ logqlString .service }}}`,
+		LegendFormat: "{{pod}}",
+		AdditionalFields: map[string]interface{}{
+			"builderOptions": map[string]interface{}{
+				"simplelogQuery": "service:{{ .service }}",
+			},
+			"alias": "{{ .service }}",
+		},
+	}
+
+	expected := &api.Query{
+		RefID:        "A",
+		RawSQL:       "SELECT * FROM logs WHERE service = 'app'",
+		Expr:         `{service="app"}`,
+		LegendFormat: "{{pod}}",
+		AdditionalFields: map[string]interface{}{
+			"builderOptions": map[string]interface{}{
+				"simplelogQuery": "service:app",
+			},
+			"alias": "app",
+		},
+	}
+
+	if err := RenderQuery(q, map[string]interface{}{"service": "app"}); err != nil {
+		t.Fatalf("Failed to render query: %v", err)
+	}
+	if d := cmp.Diff(expected, q); d != "" {
+		t.Errorf("Unexpected diff:\n%v", d)
+	}
+}
@@ -0,0 +1,250 @@
+package grafana
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	MatchEqual     = "="
+	MatchNotEqual  = "!="
+	MatchRegexp    = "=~"
+	MatchNotRegexp = "!~"
+)
+
+var (
+	// matcherOps are the operators of label matchers. Two character operators come first so that they are matched
+	// before "=".
+	matcherOps = []string{MatchRegexp, MatchNotRegexp, MatchNotEqual, MatchEqual}
+)
+
+// LabelMatcher is a label matcher in a LogQL stream selector or a PromQL vector selector e.g. service="app".
+type LabelMatcher struct {
+	Name  string
+	Op    string
+	Value string
+}
+
+func (m LabelMatcher) String() string {
+	return m.Name + m.Op + strconv.Quote(m.Value)
+}
+
+// NewLabelMatcher returns a label matcher; op defaults to =.
+func NewLabelMatcher(name string, op string, value string) (LabelMatcher, error) {
+	if op == "" {
+		op = MatchEqual
+	}
+	if !isLabelName(name) {
+		return LabelMatcher{}, errors.Errorf("Invalid label name %v; label names must match [a-zA-Z_][a-zA-Z0-9_]*", name)
+	}
+	for _, o := range matcherOps {
+		if o == op {
+			return LabelMatcher{Name: name, Op: op, Value: value}, nil
+		}
+	}
+	return LabelMatcher{}, errors.Errorf("Invalid label matcher operator %v; operator must be one of %v", op, matcherOps)
+}
+
+// selectorSpan is the location of a selector, including the braces, in an expression.
+type selectorSpan struct {
+	start int
+	end   int
+}
+
+// findSelectors returns the locations of the label selectors (i.e. {...}) in a LogQL or PromQL expression.
+// Braces inside of strings (e.g. in a line_format template) are ignored.
+func findSelectors(expr string) ([]selectorSpan, error) {
+	spans := []selectorSpan{}
+	start := -1
+	for i := 0; i < len(expr); i++ {
+		switch expr[i] {
+		case '"', '`', '\'':
+			end, err := skipString(expr, i)
+			if err != nil {
+				return nil, err
+			}
+			i = end - 1
+		case '{':
+			if start >= 0 {
+				return nil, errors.Errorf("Invalid expression %v; unexpected { at offset %v", expr, i)
+			}
+			start = i
+		case '}':
+			if start < 0 {
+				return nil, errors.Errorf("Invalid expression %v; unexpected } at offset %v", expr, i)
+			}
+			spans = append(spans, selectorSpan{start: start, end: i + 1})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		return nil, errors.Errorf("Invalid expression %v; the selector at offset %v isn't closed", expr, start)
+	}
+	return spans, nil
+}
+
+// skipString returns the offset just past the end of the string starting at offset start.
+func skipString(expr string, start int) (int, error) {
+	quote := expr[start]
+	for i := start + 1; i < len(expr); i++ {
+		switch expr[i] {
+		case '\\':
+			// Raw strings don't have escapes.
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			return i + 1, nil
+		}
+	}
+	return 0, errors.Errorf("Invalid expression %v; the string at offset %v isn't terminated", expr, start)
+}
+
+// parseMatchers parses the label matchers in the body of a selector i.e. the text between the braces.
+func parseMatchers(body string) ([]LabelMatcher, error) {
+	matchers := []LabelMatcher{}
+	rest := strings.TrimSpace(body)
+	for rest != "" {
+		i := 0
+		for i < len(rest) && isLabelChar(rest[i], i == 0) {
+			i++
+		}
+		name := rest[:i]
+		if name == "" {
+			return nil, errors.Errorf("Invalid selector {%v}; expected a label name at %v", body, rest)
+		}
+		rest = strings.TrimSpace(rest[i:])
+
+		op := ""
+		for _, o := range matcherOps {
+			if strings.HasPrefix(rest, o) {
+				op = o
+				break
+			}
+		}
+		if op == "" {
+			return nil, errors.Errorf("Invalid selector {%v}; expected an operator after label %v", body, name)
+		}
+		rest = strings.TrimSpace(rest[len(op):])
+
+		if rest == "" || strings.IndexByte("\"`'", rest[0]) < 0 {
+			return nil, errors.Errorf("Invalid selector {%v}; expected a quoted value for label %v", body, name)
+		}
+		end, err := skipString(rest, 0)
+		if err != nil {
+			return nil, err
+		}
+		value, err := unquote(rest[:end])
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid selector {%v}; invalid value for label %v", body, name)
+		}
+		matchers = append(matchers, LabelMatcher{Name: name, Op: op, Value: value})
+
+		rest = strings.TrimSpace(rest[end:])
+		if rest == "" {
+			break
+		}
+		if rest[0] != ',' {
+			return nil, errors.Errorf("Invalid selector {%v}; expected a comma after the matcher for label %v", body, name)
+		}
+		rest = strings.TrimSpace(rest[1:])
+	}
+	return matchers, nil
+}
+
+// unquote unquotes a string using Go's rules; PromQL and LogQL also allow single quoted strings.
+func unquote(s string) (string, error) {
+	if len(s) < 2 || s[0] != '\'' {
+		return strconv.Unquote(s)
+	}
+
+	// Convert the single quoted string to a double quoted one.
+	body := s[1 : len(s)-1]
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case c == '\\' && i+1 < len(body):
+			i++
+			if body[i] != '\'' {
+				sb.WriteByte(c)
+			}
+			sb.WriteByte(body[i])
+		case c == '"':
+			sb.WriteString(`\"`)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte('"')
+	return strconv.Unquote(sb.String())
+}
+
+// mergeMatchers adds matchers to existing. Matchers in existing for the same labels as matchers are replaced.
+func mergeMatchers(existing []LabelMatcher, matchers []LabelMatcher) []LabelMatcher {
+	replaced := map[string]bool{}
+	for _, m := range matchers {
+		replaced[m.Name] = true
+	}
+	merged := make([]LabelMatcher, 0, len(existing)+len(matchers))
+	for _, m := range existing {
+		if !replaced[m.Name] {
+			merged = append(merged, m)
+		}
+	}
+	return append(merged, matchers...)
+}
+
+// formatSelector formats the matchers as a selector e.g. {service="app", level="error"}
+func formatSelector(matchers []LabelMatcher) string {
+	pieces := make([]string, 0, len(matchers))
+	for _, m := range matchers {
+		pieces = append(pieces, m.String())
+	}
+	return "{" + strings.Join(pieces, ", ") + "}"
+}
+
+// rewriteSelectors calls rewrite for each of the selectors in expr and replaces the selector with the result.
+// rewrite is passed the matchers of the selector.
+func rewriteSelectors(expr string, rewrite func([]LabelMatcher) string) (string, error) {
+	spans, err := findSelectors(expr)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, s := range spans {
+		matchers, err := parseMatchers(expr[s.start+1 : s.end-1])
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(expr[last:s.start])
+		sb.WriteString(rewrite(matchers))
+		last = s.end
+	}
+	sb.WriteString(expr[last:])
+	return sb.String(), nil
+}
+
+func isLabelName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isLabelChar(name[i], i == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func isLabelChar(c byte, first bool) bool {
+	if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+		return true
+	}
+	return !first && c >= '0' && c <= '9'
+}
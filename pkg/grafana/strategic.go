@@ -0,0 +1,238 @@
+package grafana
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/jlewi/grafctl/api"
+	"github.com/pkg/errors"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+const (
+	// patchDirective is the key of the directive that controls how an object in a strategic merge patch is merged.
+	patchDirective = "$patch"
+	// deleteDirective deletes the field or the item of a list.
+	deleteDirective = "delete"
+	// replaceDirective replaces the object instead of merging it.
+	replaceDirective = "replace"
+)
+
+var (
+	// mergeKeys maps the names of fields holding lists of objects to the field that identifies the items of the list.
+	// Lists that aren't in mergeKeys are replaced by a strategic merge patch.
+	mergeKeys = map[string]string{
+		"queries": "refId",
+		"targets": "refId",
+		"columns": "name",
+		"filters": "key",
+	}
+)
+
+// applyPatchWithType merges the patch into base using the algorithm specified by patchType.
+// base should be a pointer.
+func applyPatchWithType(base any, patch any, patchType api.PatchType) error {
+	switch patchType {
+	case api.MergePatchType, "":
+		return applyPatch(base, patch)
+	case api.StrategicPatchType:
+		return applyStrategicPatch(base, patch)
+	}
+	return errors.Errorf("Unknown patchType %v; patchType must be one of %v", patchType, []api.PatchType{api.MergePatchType, api.StrategicPatchType})
+}
+
+// applyStrategicPatch applies a strategic merge patch to base.
+// base should be a pointer.
+//
+// Like a Kubernetes strategic merge patch, lists of objects are merged using the merge keys in mergeKeys rather than
+// being replaced. Items in the patch that don't match an item in base are appended.
+func applyStrategicPatch(base any, patch any) error {
+	original, err := toJSONValue(base)
+	if err != nil {
+		return errors.Wrapf(err, "Error marshalling base")
+	}
+	p, err := toJSONValue(patch)
+	if err != nil {
+		return errors.Wrapf(err, "Error marshalling patch")
+	}
+
+	merged, err := strategicMerge("", original, p)
+	if err != nil {
+		return errors.Wrapf(err, "Error applying the strategic merge patch")
+	}
+
+	mergedBytes, err := json.Marshal(merged)
+	if err != nil {
+		return errors.Wrapf(err, "Error marshalling the merged value")
+	}
+	return replaceWithJSON(base, mergedBytes)
+}
+
+// strategicMerge merges patch into original and returns the result. field is the name of the field holding
+// original; it determines the merge key for lists.
+func strategicMerge(field string, original interface{}, patch interface{}) (interface{}, error) {
+	switch p := patch.(type) {
+	case map[string]interface{}:
+		directive, err := getDirective(p)
+		if err != nil {
+			return nil, err
+		}
+		o, ok := original.(map[string]interface{})
+		if !ok || directive == replaceDirective {
+			return stripDirectives(p), nil
+		}
+		for k, v := range p {
+			if k == patchDirective {
+				continue
+			}
+			// Null values are ignored so that omitted fields don't delete fields in the template.
+			if v == nil {
+				continue
+			}
+			if child, ok := v.(map[string]interface{}); ok {
+				childDirective, err := getDirective(child)
+				if err != nil {
+					return nil, err
+				}
+				if childDirective == deleteDirective {
+					delete(o, k)
+					continue
+				}
+			}
+			merged, err := strategicMerge(k, o[k], v)
+			if err != nil {
+				return nil, err
+			}
+			o[k] = merged
+		}
+		return o, nil
+	case []interface{}:
+		key, ok := mergeKeys[field]
+		o, isList := original.([]interface{})
+		if !ok || !isList {
+			return stripDirectives(p), nil
+		}
+		return mergeList(field, key, o, p)
+	}
+	return patch, nil
+}
+
+// mergeList merges the items of patch into the items of original that have the same value of key.
+func mergeList(field string, key string, original []interface{}, patch []interface{}) ([]interface{}, error) {
+	for _, item := range patch {
+		pItem, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, errors.Errorf("Items of %v must be objects with the field %v", field, key)
+		}
+		value, ok := pItem[key]
+		if !ok {
+			return nil, errors.Errorf("Items of %v must set %v so that they can be merged with the items in the template", field, key)
+		}
+		directive, err := getDirective(pItem)
+		if err != nil {
+			return nil, err
+		}
+
+		index := -1
+		for i, o := range original {
+			if oItem, ok := o.(map[string]interface{}); ok && reflect.DeepEqual(oItem[key], value) {
+				index = i
+				break
+			}
+		}
+
+		switch {
+		case directive == deleteDirective:
+			if index < 0 {
+				return nil, errors.Errorf("Unable to delete the item of %v with %v %v; there is no such item", field, key, value)
+			}
+			original = append(original[:index], original[index+1:]...)
+		case index < 0:
+			original = append(original, stripDirectives(pItem))
+		default:
+			merged, err := strategicMerge("", original[index], pItem)
+			if err != nil {
+				return nil, err
+			}
+			original[index] = merged
+		}
+	}
+	return original, nil
+}
+
+// getDirective returns the value of the $patch directive in the object or the empty string if there isn't one.
+func getDirective(obj map[string]interface{}) (string, error) {
+	v, ok := obj[patchDirective]
+	if !ok {
+		return "", nil
+	}
+	switch v {
+	case deleteDirective, replaceDirective:
+		return v.(string), nil
+	}
+	return "", errors.Errorf("Unknown %v directive %v; directive must be one of %v", patchDirective, v, []string{deleteDirective, replaceDirective})
+}
+
+// stripDirectives removes the $patch directives from value so that it can be used as is.
+func stripDirectives(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		delete(v, patchDirective)
+		for k, child := range v {
+			if child == nil {
+				delete(v, k)
+				continue
+			}
+			v[k] = stripDirectives(child)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = stripDirectives(child)
+		}
+	}
+	return value
+}
+
+// applyOperations applies the RFC 6902 JSON Patch operations to base.
+// base should be a pointer.
+func applyOperations(base any, ops []api.Operation) error {
+	baseBytes, err := json.Marshal(base)
+	if err != nil {
+		return errors.Wrapf(err, "Error marshalling base")
+	}
+	opsBytes, err := json.Marshal(ops)
+	if err != nil {
+		return errors.Wrapf(err, "Error marshalling operations")
+	}
+	p, err := jsonpatch.DecodePatch(opsBytes)
+	if err != nil {
+		return errors.Wrapf(err, "Invalid JSON patch operations")
+	}
+	patchedBytes, err := p.Apply(baseBytes)
+	if err != nil {
+		return errors.Wrapf(err, "Error applying the JSON patch operations")
+	}
+	return replaceWithJSON(base, patchedBytes)
+}
+
+// replaceWithJSON replaces the value base points to with the value decoded from data. Unlike json.Unmarshal on its
+// own, fields and map entries that aren't in data don't keep their old values.
+func replaceWithJSON(base any, data []byte) error {
+	v := reflect.ValueOf(base).Elem()
+	v.Set(reflect.Zero(v.Type()))
+	return json.Unmarshal(data, base)
+}
+
+// toJSONValue converts value to the generic representation of its JSON i.e. maps, lists and scalars.
+func toJSONValue(value any) (interface{}, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, errors.Wrapf(err, "Failed to unmarshal %s", b)
+	}
+	return v, nil
+}
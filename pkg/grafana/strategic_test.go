@@ -0,0 +1,264 @@
+package grafana
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/grafctl/api"
+)
+
+func Test_applyStrategicPatch(t *testing.T) {
+	type testCase struct {
+		name     string
+		base     api.Query
+		patch    map[string]interface{}
+		expected api.Query
+	}
+
+	cases := []testCase{
+		{
+			name: "columns",
+			base: api.Query{
+				AdditionalFields: map[string]interface{}{
+					"builderOptions": map[string]interface{}{
+						"table": "logs",
+						"columns": []interface{}{
+							map[string]interface{}{"name": "timestamp", "hint": "time"},
+							map[string]interface{}{"name": "body"},
+						},
+					},
+				},
+			},
+			patch: map[string]interface{}{
+				"builderOptions": map[string]interface{}{
+					"columns": []interface{}{
+						map[string]interface{}{"name": "body", "hint": "log_message"},
+						map[string]interface{}{"name": "level"},
+					},
+				},
+			},
+			expected: api.Query{
+				AdditionalFields: map[string]interface{}{
+					"builderOptions": map[string]interface{}{
+						"table": "logs",
+						"columns": []interface{}{
+							map[string]interface{}{"name": "timestamp", "hint": "time"},
+							map[string]interface{}{"name": "body", "hint": "log_message"},
+							map[string]interface{}{"name": "level"},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "filters",
+			base: api.Query{
+				AdditionalFields: map[string]interface{}{
+					"builderOptions": map[string]interface{}{
+						"filters": []interface{}{
+							map[string]interface{}{"key": "service", "operator": "=", "value": "app"},
+							map[string]interface{}{"key": "level", "operator": "=", "value": "info"},
+						},
+					},
+				},
+			},
+			patch: map[string]interface{}{
+				"builderOptions": map[string]interface{}{
+					"filters": []interface{}{
+						map[string]interface{}{"key": "service", "value": "foyle"},
+						map[string]interface{}{"key": "level", "$patch": "delete"},
+					},
+				},
+			},
+			expected: api.Query{
+				AdditionalFields: map[string]interface{}{
+					"builderOptions": map[string]interface{}{
+						"filters": []interface{}{
+							map[string]interface{}{"key": "service", "operator": "=", "value": "foyle"},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "null-and-delete",
+			base: api.Query{
+				RawSQL: "SELECT 1",
+				AdditionalFields: map[string]interface{}{
+					"builderOptions": map[string]interface{}{
+						"table": "logs",
+						"limit": 10,
+					},
+				},
+			},
+			patch: map[string]interface{}{
+				"rawSql": nil,
+				"builderOptions": map[string]interface{}{
+					"limit": map[string]interface{}{"$patch": "delete"},
+				},
+			},
+			expected: api.Query{
+				RawSQL: "SELECT 1",
+				AdditionalFields: map[string]interface{}{
+					"builderOptions": map[string]interface{}{
+						"table": "logs",
+					},
+				},
+			},
+		},
+		{
+			name: "replace",
+			base: api.Query{
+				AdditionalFields: map[string]interface{}{
+					"builderOptions": map[string]interface{}{
+						"table": "logs",
+						"limit": 10,
+					},
+				},
+			},
+			patch: map[string]interface{}{
+				"builderOptions": map[string]interface{}{
+					"$patch": "replace",
+					"table":  "traces",
+				},
+			},
+			expected: api.Query{
+				AdditionalFields: map[string]interface{}{
+					"builderOptions": map[string]interface{}{
+						"table": "traces",
+					},
+				},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := c.base
+			if err := applyStrategicPatch(&actual, c.patch); err != nil {
+				t.Fatalf("Failed to apply patch: %v", err)
+			}
+			if d := cmp.Diff(c.expected, actual); d != "" {
+				t.Errorf("Unexpected diff:\n%v", d)
+			}
+		})
+	}
+}
+
+func Test_applyStrategicPatchErrors(t *testing.T) {
+	cases := map[string]map[string]interface{}{
+		"missing-merge-key": {
+			"builderOptions": map[string]interface{}{
+				"columns": []interface{}{
+					map[string]interface{}{"hint": "time"},
+				},
+			},
+		},
+		"unknown-directive": {
+			"builderOptions": map[string]interface{}{
+				"$patch": "merge",
+			},
+		},
+		"delete-missing": {
+			"builderOptions": map[string]interface{}{
+				"columns": []interface{}{
+					map[string]interface{}{"name": "level", "$patch": "delete"},
+				},
+			},
+		},
+	}
+
+	for name, patch := range cases {
+		t.Run(name, func(t *testing.T) {
+			q := api.Query{
+				AdditionalFields: map[string]interface{}{
+					"builderOptions": map[string]interface{}{
+						"columns": []interface{}{map[string]interface{}{"name": "timestamp"}},
+					},
+				},
+			}
+			if err := applyStrategicPatch(&q, patch); err == nil {
+				t.Fatalf("Expected an error but got none")
+			}
+		})
+	}
+}
+
+func Test_ApplyPatchStrategic(t *testing.T) {
+	type testCase struct {
+		name     string
+		patch    api.PanePatch
+		expected api.Panes
+	}
+
+	fixTime := false
+	cases := []testCase{
+		{
+			name: "panes",
+			patch: api.PanePatch{
+				Template:  "test",
+				PatchType: api.StrategicPatchType,
+				Panes: map[string]map[string]interface{}{
+					"eja": {
+						"queries": []interface{}{
+							map[string]interface{}{"refId": "A", "rawSql": "SELECT 2"},
+							map[string]interface{}{"refId": "C", "rawSql": "SELECT 3"},
+						},
+					},
+				},
+				FixTime: &fixTime,
+			},
+			expected: api.Panes{
+				"eja": api.PaneBody{
+					Queries: []api.Query{
+						{RefID: "A", RawSQL: "SELECT 2", AdditionalFields: map[string]interface{}{}},
+						{RefID: "B", RawSQL: "SELECT 1", AdditionalFields: map[string]interface{}{}},
+						{RefID: "C", RawSQL: "SELECT 3", AdditionalFields: map[string]interface{}{}},
+					},
+				},
+			},
+		},
+		{
+			name: "operations",
+			patch: api.PanePatch{
+				Template: "test",
+				Operations: []api.Operation{
+					{Op: "replace", Path: "/panes/eja/queries/1/rawSql", Value: "SELECT 2"},
+					{Op: "remove", Path: "/panes/eja/queries/0"},
+				},
+				FixTime: &fixTime,
+			},
+			expected: api.Panes{
+				"eja": api.PaneBody{
+					Queries: []api.Query{
+						{RefID: "B", RawSQL: "SELECT 2", AdditionalFields: map[string]interface{}{}},
+					},
+				},
+			},
+		},
+	}
+
+	applier := NewPatcher(FakeClock{})
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			base := &api.GrafanaLink{
+				Metadata: api.Metadata{Name: "test"},
+				Panes: api.Panes{
+					"eja": api.PaneBody{
+						Queries: []api.Query{
+							{RefID: "A", RawSQL: "SELECT 1"},
+							{RefID: "B", RawSQL: "SELECT 1"},
+						},
+					},
+				},
+			}
+			actual, err := applier.ApplyPatch([]*api.GrafanaLink{base}, c.patch)
+			if err != nil {
+				t.Fatalf("Error applying patch: %v", err)
+			}
+			if d := cmp.Diff(c.expected, actual.Panes); d != "" {
+				t.Fatalf("Unexpected diff:\n%v", d)
+			}
+		})
+	}
+}
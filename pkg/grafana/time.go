@@ -1,10 +1,12 @@
 package grafana
 
 import (
-	"regexp"
 	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
+	"github.com/jlewi/grafctl/api"
 	"github.com/pkg/errors"
 )
 
@@ -22,60 +24,302 @@ func NewRelativeTimeParser() *RelativeTimeParser {
 	return &RelativeTimeParser{Clock: RealClock{}}
 }
 
+// RelativeTimeParser parses time expressions using Grafana's syntax
+// https://grafana.com/docs/grafana/latest/dashboards/use-dashboards/#time-units-and-relative-ranges
 type RelativeTimeParser struct {
 	Clock Clock
+	// Location is the timezone used to round times to unit boundaries (e.g. the start of the day) and to interpret
+	// absolute times that don't specify a timezone. If nil the location of the time returned by Clock is used.
+	Location *time.Location
+	// WeekStart is the first day of the week used when rounding to weeks. The zero value is Sunday which
+	// is Grafana's default.
+	WeekStart time.Weekday
 }
 
-// ParseGrafanaRelativeTime converts a Grafana-style relative time string to a time.Time object.
-// Example inputs: "now", "now-1h", "now-30m", "now-7d"
+// LoadLocation returns the location for a Grafana timezone setting. The setting is an IANA timezone name,
+// "utc" or "browser" which, since there is no browser, means the local timezone. An empty string returns nil.
+func LoadLocation(timezone string) (*time.Location, error) {
+	switch strings.ToLower(timezone) {
+	case "":
+		return nil, nil
+	case "utc":
+		return time.UTC, nil
+	case "browser", "local":
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid timezone %v; timezone should be an IANA timezone name (e.g. America/Los_Angeles), utc or browser", timezone)
+	}
+	return loc, nil
+}
+
+// ParseWeekStart parses the name of the first day of the week e.g. "monday". An empty string returns Sunday which
+// is Grafana's default.
+func ParseWeekStart(weekStart string) (time.Weekday, error) {
+	if weekStart == "" {
+		return time.Sunday, nil
+	}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(d.String(), weekStart) {
+			return d, nil
+		}
+	}
+	return time.Sunday, errors.Errorf("Invalid week start %v; week start should be the name of a day e.g. monday", weekStart)
+}
+
+var (
+	// absoluteLayouts are the layouts of absolute times without a timezone. They are interpreted in the location of
+	// the parser.
+	absoluteLayouts = []string{
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02T15:04:05",
+		"2006-01-02T15:04",
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02 15:04:05",
+		"2006-01-02 15:04",
+		"2006-01-02",
+	}
+)
+
+// ParseGrafanaRelativeTime converts a Grafana-style time expression to a time.Time object.
+// Times are rounded down, which is how Grafana interprets the "from" field of a time range.
+// Example inputs: "now", "now-1h", "now-30m", "now-7d", "now/d", "now-1w/w", "2024-02-25T13:25:00Z"
 func (p RelativeTimeParser) ParseGrafanaRelativeTime(relativeTime string) (time.Time, error) {
-	if relativeTime == "" {
+	return p.ParseGrafanaTime(relativeTime, false)
+}
+
+// ParseTimeRange converts a time range to absolute times. The from time is rounded down and the to time is rounded
+// up so that e.g. from: now/d to: now/d covers the whole day just as it does in Grafana.
+func (p RelativeTimeParser) ParseTimeRange(r api.TimeRange) (time.Time, time.Time, error) {
+	from, err := p.ParseGrafanaTime(r.From, false)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.Wrapf(err, "Failed to parse relative time in from field of value %v", r.From)
+	}
+	to, err := p.ParseGrafanaTime(r.To, true)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.Wrapf(err, "Failed to parse relative time in to field of value %v", r.To)
+	}
+	return from, to, nil
+}
+
+// ParseGrafanaTime converts a Grafana time expression to a time.Time object.
+//
+// The expression is either
+//   - "now" followed by zero or more operations e.g. "now-1d/d"
+//   - an absolute time optionally followed by "||" and zero or more operations e.g. "2024-02-25||+1d"
+//
+// Absolute times can be RFC3339 timestamps, dates and times without a timezone (e.g. "2024-02-25 13:25:00") or
+// milliseconds since the unix epoch.
+//
+// Operations are
+//   - +<N><unit> adds N units; N defaults to 1
+//   - -<N><unit> subtracts N units; N defaults to 1
+//   - /<unit> rounds to the unit; down if roundUp is false and to the end of the unit if roundUp is true
+//
+// Units are s, m, h, d, w, M (months), Q (quarters) and y. Months, quarters and years use calendar arithmetic;
+// adding a month to January 31st yields the last day of February.
+func (p RelativeTimeParser) ParseGrafanaTime(expression string, roundUp bool) (time.Time, error) {
+	expression = strings.TrimSpace(expression)
+	if expression == "" {
 		return time.Time{}, errors.New("empty relative time; use 'now' for the current time")
 	}
-	// Get the current time
-	now := p.Clock.Now()
 
-	if relativeTime == "now" {
-		return now, nil
+	loc := p.Location
+	clock := p.Clock
+	if clock == nil {
+		clock = RealClock{}
+	}
+	now := clock.Now()
+	if loc == nil {
+		loc = now.Location()
 	}
 
-	// Define regex to match Grafana relative time format (e.g., now-1h, now-7d)
-	re := regexp.MustCompile(`^now-(\d+)([smhdwMy])$`)
-	matches := re.FindStringSubmatch(relativeTime)
+	var anchor time.Time
+	var math string
+	if strings.HasPrefix(expression, "now") {
+		anchor = now.In(loc)
+		math = expression[len("now"):]
+	} else {
+		absolute := expression
+		if i := strings.Index(expression, "||"); i >= 0 {
+			absolute = expression[:i]
+			math = expression[i+2:]
+		}
+		t, err := parseAbsoluteTime(absolute, loc)
+		if err != nil {
+			return time.Time{}, err
+		}
+		anchor = t
+	}
+
+	return p.applyMath(anchor, math, roundUp)
+}
 
-	if len(matches) != 3 {
-		return time.Time{}, errors.New("invalid relative time format")
+// parseAbsoluteTime parses a time that isn't relative to now.
+func parseAbsoluteTime(value string, loc *time.Location) (time.Time, error) {
+	if isDigits(value) {
+		// Grafana treats 8 digits as a date formatted as YYYYMMDD and any other number as epoch milliseconds.
+		if len(value) == 8 {
+			if t, err := time.ParseInLocation("20060102", value, loc); err == nil {
+				return t, nil
+			}
+		}
+		millis, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, errors.Wrapf(err, "invalid epoch milliseconds %v", value)
+		}
+		return time.UnixMilli(millis).In(loc), nil
 	}
 
-	// Extract the amount and unit from the matches
-	amount, err := strconv.Atoi(matches[1])
-	if err != nil {
-		return time.Time{}, errors.New("invalid time amount")
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t.In(loc), nil
+	}
+
+	for _, layout := range absoluteLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
 	}
+	return time.Time{}, errors.Errorf("invalid time %v; expected a relative time such as now-1h, an RFC3339 timestamp, a date or epoch milliseconds", value)
+}
+
+// applyMath applies the operations in math to t.
+func (p RelativeTimeParser) applyMath(t time.Time, math string, roundUp bool) (time.Time, error) {
+	i := 0
+	for i < len(math) {
+		op := math[i]
+		i++
+		if op != '/' && op != '+' && op != '-' {
+			return time.Time{}, errors.Errorf("invalid relative time format; unexpected character %q in %v", op, math)
+		}
+
+		start := i
+		for i < len(math) && unicode.IsDigit(rune(math[i])) {
+			i++
+		}
+		amount := 1
+		if i > start {
+			if op == '/' {
+				return time.Time{}, errors.Errorf("invalid relative time format; rounding can't have an amount in %v", math)
+			}
+			n, err := strconv.Atoi(math[start:i])
+			if err != nil {
+				return time.Time{}, errors.New("invalid time amount")
+			}
+			amount = n
+		}
+
+		if i >= len(math) {
+			return time.Time{}, errors.Errorf("invalid relative time format; missing unit in %v", math)
+		}
+		unit := math[i]
+		i++
+
+		if !isTimeUnit(unit) {
+			return time.Time{}, errors.Errorf("unknown time unit %q", unit)
+		}
+
+		switch op {
+		case '/':
+			t = p.roundTime(t, unit, roundUp)
+		case '+':
+			t = addTime(t, amount, unit)
+		case '-':
+			t = addTime(t, -amount, unit)
+		}
+	}
+	return t, nil
+}
 
-	unit := matches[2]
+func isTimeUnit(unit byte) bool {
+	return strings.IndexByte("smhdwMQy", unit) >= 0
+}
 
-	// Calculate the offset based on the unit
-	var duration time.Duration
+// addTime adds amount units to t.
+func addTime(t time.Time, amount int, unit byte) time.Time {
 	switch unit {
-	case "s":
-		duration = time.Duration(amount) * time.Second
-	case "m":
-		duration = time.Duration(amount) * time.Minute
-	case "h":
-		duration = time.Duration(amount) * time.Hour
-	case "d":
-		duration = time.Duration(amount) * 24 * time.Hour
-	case "w":
-		duration = time.Duration(amount) * 7 * 24 * time.Hour
-	case "M":
-		duration = time.Duration(amount) * 30 * 24 * time.Hour
-	case "y":
-		duration = time.Duration(amount) * 365 * 24 * time.Hour
-	default:
-		return time.Time{}, errors.New("unknown time unit")
-	}
-
-	// Subtract the duration from now
-	return now.Add(-duration), nil
+	case 's':
+		return t.Add(time.Duration(amount) * time.Second)
+	case 'm':
+		return t.Add(time.Duration(amount) * time.Minute)
+	case 'h':
+		return t.Add(time.Duration(amount) * time.Hour)
+	case 'd':
+		return t.AddDate(0, 0, amount)
+	case 'w':
+		return t.AddDate(0, 0, 7*amount)
+	case 'M':
+		return addMonths(t, amount)
+	case 'Q':
+		return addMonths(t, 3*amount)
+	case 'y':
+		return addMonths(t, 12*amount)
+	}
+	return t
+}
+
+// addMonths adds months to t. Unlike time.AddDate the day of the month is clamped to the last day of the
+// resulting month rather than overflowing into the following month.
+func addMonths(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	hour, min, sec := t.Clock()
+
+	firstOfMonth := time.Date(year, month+time.Month(months), 1, 0, 0, 0, 0, t.Location())
+	if last := daysInMonth(firstOfMonth); day > last {
+		day = last
+	}
+	return time.Date(firstOfMonth.Year(), firstOfMonth.Month(), day, hour, min, sec, t.Nanosecond(), t.Location())
+}
+
+func daysInMonth(t time.Time) int {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()
+}
+
+// roundTime rounds t to the start of the unit or, if roundUp is true, to the last millisecond of the unit.
+func (p RelativeTimeParser) roundTime(t time.Time, unit byte, roundUp bool) time.Time {
+	start := p.startOf(t, unit)
+	if !roundUp {
+		return start
+	}
+	return addTime(start, 1, unit).Add(-time.Millisecond)
+}
+
+// startOf returns the start of the unit containing t.
+func (p RelativeTimeParser) startOf(t time.Time, unit byte) time.Time {
+	year, month, day := t.Date()
+	loc := t.Location()
+	switch unit {
+	case 's':
+		return t.Truncate(time.Second)
+	case 'm':
+		return time.Date(year, month, day, t.Hour(), t.Minute(), 0, 0, loc)
+	case 'h':
+		return time.Date(year, month, day, t.Hour(), 0, 0, 0, loc)
+	case 'd':
+		return time.Date(year, month, day, 0, 0, 0, 0, loc)
+	case 'w':
+		offset := (int(t.Weekday()) - int(p.WeekStart) + 7) % 7
+		return time.Date(year, month, day-offset, 0, 0, 0, 0, loc)
+	case 'M':
+		return time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	case 'Q':
+		quarterStart := month - (month-1)%3
+		return time.Date(year, quarterStart, 1, 0, 0, 0, 0, loc)
+	case 'y':
+		return time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+	}
+	return t
+}
+
+func isDigits(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
 }
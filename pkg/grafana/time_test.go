@@ -3,6 +3,8 @@ package grafana
 import (
 	"testing"
 	"time"
+
+	"github.com/jlewi/grafctl/api"
 )
 
 type FakeClock struct {
@@ -12,6 +14,15 @@ func (f FakeClock) Now() time.Time {
 	return time.Date(2024, time.February, 25, 13, 25, 0, 0, time.UTC)
 }
 
+// fixedClock is a clock that always returns the same time.
+type fixedClock struct {
+	t time.Time
+}
+
+func (f fixedClock) Now() time.Time {
+	return f.t
+}
+
 func TestParseGrafanaRelativeTime(t *testing.T) {
 	clock := FakeClock{}
 	tests := []struct {
@@ -23,10 +34,32 @@ func TestParseGrafanaRelativeTime(t *testing.T) {
 		{"now-1h", false, clock.Now().Add(-1 * time.Hour)},
 		{"now-30m", false, clock.Now().Add(-30 * time.Minute)},
 		{"now-7d", false, clock.Now().Add(-7 * 24 * time.Hour)},
-		{"now-3M", false, clock.Now().Add(-3 * 30 * 24 * time.Hour)},
-		{"now-1y", false, clock.Now().Add(-365 * 24 * time.Hour)},
+		{"now-3M", false, time.Date(2023, time.November, 25, 13, 25, 0, 0, time.UTC)},
+		{"now-1y", false, time.Date(2023, time.February, 25, 13, 25, 0, 0, time.UTC)},
+		{"now+1h", false, clock.Now().Add(time.Hour)},
+		{"now-d", false, clock.Now().Add(-24 * time.Hour)},
+		{"now-1Q", false, time.Date(2023, time.November, 25, 13, 25, 0, 0, time.UTC)},
+		{"now/d", false, time.Date(2024, time.February, 25, 0, 0, 0, 0, time.UTC)},
+		{"now-1d/d", false, time.Date(2024, time.February, 24, 0, 0, 0, 0, time.UTC)},
+		// February 25th 2024 is a Sunday
+		{"now/w", false, time.Date(2024, time.February, 25, 0, 0, 0, 0, time.UTC)},
+		{"now-1w/w", false, time.Date(2024, time.February, 18, 0, 0, 0, 0, time.UTC)},
+		{"now/M", false, time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"now/Q", false, time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"now/y", false, time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"now/h", false, time.Date(2024, time.February, 25, 13, 0, 0, 0, time.UTC)},
+		{"2024-02-20T10:00:00Z", false, time.Date(2024, time.February, 20, 10, 0, 0, 0, time.UTC)},
+		{"2024-02-20T10:00:00+01:00", false, time.Date(2024, time.February, 20, 9, 0, 0, 0, time.UTC)},
+		{"2024-02-20 10:00:00", false, time.Date(2024, time.February, 20, 10, 0, 0, 0, time.UTC)},
+		{"2024-02-20", false, time.Date(2024, time.February, 20, 0, 0, 0, 0, time.UTC)},
+		{"20240220", false, time.Date(2024, time.February, 20, 0, 0, 0, 0, time.UTC)},
+		{"1708863900000", false, time.Date(2024, time.February, 25, 12, 25, 0, 0, time.UTC)},
+		{"2024-02-20||+1d/d", false, time.Date(2024, time.February, 21, 0, 0, 0, 0, time.UTC)},
 		{"invalid", true, clock.Now()},
 		{"now-5x", true, clock.Now()},
+		{"now/2d", true, clock.Now()},
+		{"now-", true, clock.Now()},
+		{"now*1d", true, clock.Now()},
 	}
 
 	p := RelativeTimeParser{
@@ -48,9 +81,146 @@ func TestParseGrafanaRelativeTime(t *testing.T) {
 				return
 			}
 
-			if parsedTime != test.expected {
+			if !parsedTime.Equal(test.expected) {
 				t.Errorf("expected %v but got %v for input %s", test.expected, parsedTime, test.input)
 			}
 		})
 	}
 }
+
+func TestParseGrafanaTimeCalendar(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatalf("Failed to load location: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		location *time.Location
+		input    string
+		roundUp  bool
+		expected time.Time
+	}{
+		{
+			name:     "month-clamps-to-end-of-month",
+			now:      time.Date(2024, time.March, 31, 12, 0, 0, 0, time.UTC),
+			input:    "now-1M",
+			expected: time.Date(2024, time.February, 29, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "leap-year",
+			now:      time.Date(2024, time.February, 29, 12, 0, 0, 0, time.UTC),
+			input:    "now-1y",
+			expected: time.Date(2023, time.February, 28, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "round-up-day",
+			now:      time.Date(2024, time.February, 25, 13, 25, 0, 0, time.UTC),
+			input:    "now-1d/d",
+			roundUp:  true,
+			expected: time.Date(2024, time.February, 24, 23, 59, 59, int(999*time.Millisecond), time.UTC),
+		},
+		{
+			name:     "round-up-month",
+			now:      time.Date(2024, time.February, 25, 13, 25, 0, 0, time.UTC),
+			input:    "now/M",
+			roundUp:  true,
+			expected: time.Date(2024, time.February, 29, 23, 59, 59, int(999*time.Millisecond), time.UTC),
+		},
+		{
+			name:     "round-in-timezone",
+			now:      time.Date(2024, time.February, 25, 3, 0, 0, 0, time.UTC),
+			location: la,
+			input:    "now/d",
+			expected: time.Date(2024, time.February, 24, 0, 0, 0, 0, la),
+		},
+		{
+			name:     "absolute-in-timezone",
+			now:      time.Date(2024, time.February, 25, 3, 0, 0, 0, time.UTC),
+			location: la,
+			input:    "2024-02-20 10:00",
+			expected: time.Date(2024, time.February, 20, 10, 0, 0, 0, la),
+		},
+		{
+			name:     "day-across-dst",
+			now:      time.Date(2024, time.March, 10, 12, 0, 0, 0, la),
+			location: la,
+			input:    "now-1d",
+			expected: time.Date(2024, time.March, 9, 12, 0, 0, 0, la),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := RelativeTimeParser{
+				Clock:    fixedClock{t: test.now},
+				Location: test.location,
+			}
+			actual, err := p.ParseGrafanaTime(test.input, test.roundUp)
+			if err != nil {
+				t.Fatalf("did not expect error but got %v for input %s", err, test.input)
+			}
+			if !actual.Equal(test.expected) {
+				t.Errorf("expected %v but got %v for input %s", test.expected, actual, test.input)
+			}
+		})
+	}
+}
+
+func TestParseGrafanaTimeWeekStart(t *testing.T) {
+	// February 25th 2024 is a Sunday
+	tests := []struct {
+		weekStart string
+		expected  time.Time
+	}{
+		{"", time.Date(2024, time.February, 25, 0, 0, 0, 0, time.UTC)},
+		{"monday", time.Date(2024, time.February, 19, 0, 0, 0, 0, time.UTC)},
+		{"Saturday", time.Date(2024, time.February, 24, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.weekStart, func(t *testing.T) {
+			day, err := ParseWeekStart(test.weekStart)
+			if err != nil {
+				t.Fatalf("Failed to parse week start: %v", err)
+			}
+			p := RelativeTimeParser{
+				Clock:     FakeClock{},
+				WeekStart: day,
+			}
+			actual, err := p.ParseGrafanaRelativeTime("now/w")
+			if err != nil {
+				t.Fatalf("did not expect error but got %v", err)
+			}
+			if !actual.Equal(test.expected) {
+				t.Errorf("expected %v but got %v", test.expected, actual)
+			}
+		})
+	}
+
+	if _, err := ParseWeekStart("someday"); err == nil {
+		t.Errorf("expected error for invalid week start")
+	}
+}
+
+func TestParseTimeRange(t *testing.T) {
+	p := RelativeTimeParser{
+		Clock: FakeClock{},
+	}
+
+	// Yesterday
+	from, to, err := p.ParseTimeRange(api.TimeRange{From: "now-1d/d", To: "now-1d/d"})
+	if err != nil {
+		t.Fatalf("Failed to parse time range: %v", err)
+	}
+
+	expectedFrom := time.Date(2024, time.February, 24, 0, 0, 0, 0, time.UTC)
+	expectedTo := time.Date(2024, time.February, 24, 23, 59, 59, int(999*time.Millisecond), time.UTC)
+	if !from.Equal(expectedFrom) {
+		t.Errorf("expected from %v but got %v", expectedFrom, from)
+	}
+	if !to.Equal(expectedTo) {
+		t.Errorf("expected to %v but got %v", expectedTo, to)
+	}
+}
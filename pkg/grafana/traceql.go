@@ -0,0 +1,184 @@
+package grafana
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jlewi/grafctl/api"
+	"github.com/pkg/errors"
+)
+
+const (
+	// tracePaneID is the ID of the pane in links created by NewTraceLink.
+	tracePaneID = "trace"
+)
+
+var (
+	traceQLOps = []string{"=", "!=", ">", ">=", "<", "<=", "=~", "!~"}
+
+	// traceIDRe matches trace IDs; 64 or 128 bit IDs in hex. Leading zeros are often dropped so IDs can have
+	// fewer than 16 or 32 hex characters.
+	traceIDRe = regexp.MustCompile(`^[0-9a-fA-F]{1,32}$`)
+
+	// unquotedAttributes are the intrinsic attributes whose values are keywords rather than strings
+	// e.g. status = error
+	unquotedAttributes = map[string]bool{
+		"status": true,
+		"kind":   true,
+	}
+)
+
+// TraceQLCondition is a condition in a TraceQL spanset filter e.g. resource.service.name = "app"
+type TraceQLCondition struct {
+	Attribute string
+	Op        string
+	// Value is the value as it appears in the query i.e. strings are quoted.
+	Value string
+}
+
+func (c TraceQLCondition) String() string {
+	return c.Attribute + " " + c.Op + " " + c.Value
+}
+
+// NewTraceQLCondition returns a condition; op defaults to =. If quote is true value is quoted as a string.
+func NewTraceQLCondition(attribute string, op string, value string, quote bool) (TraceQLCondition, error) {
+	if op == "" {
+		op = "="
+	}
+	if strings.TrimSpace(attribute) == "" || strings.ContainsAny(attribute, " {}\"&|") {
+		return TraceQLCondition{}, errors.Errorf("Invalid TraceQL attribute %q", attribute)
+	}
+	valid := false
+	for _, o := range traceQLOps {
+		if o == op {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return TraceQLCondition{}, errors.Errorf("Invalid TraceQL operator %v; operator must be one of %v", op, traceQLOps)
+	}
+	if quote && !unquotedAttributes[attribute] {
+		value = strconv.Quote(value)
+	}
+	return TraceQLCondition{Attribute: attribute, Op: op, Value: value}, nil
+}
+
+// BuildTraceQL composes a TraceQL query from conditions e.g. { resource.service.name = "app" && status = error }
+//
+// If query is empty a new query is built. Otherwise the conditions are and'ed to every spanset filter in the query.
+func BuildTraceQL(query string, conditions []TraceQLCondition) (string, error) {
+	if strings.TrimSpace(query) == "" {
+		query = "{}"
+	}
+
+	spans, err := findSelectors(query)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to parse TraceQL query")
+	}
+	if len(spans) == 0 {
+		return "", errors.Errorf("TraceQL query %v doesn't have a spanset filter", query)
+	}
+
+	pieces := make([]string, 0, len(conditions))
+	for _, c := range conditions {
+		pieces = append(pieces, c.String())
+	}
+	added := strings.Join(pieces, " && ")
+
+	var sb strings.Builder
+	last := 0
+	for _, s := range spans {
+		body := strings.TrimSpace(query[s.start+1 : s.end-1])
+		sb.WriteString(query[last:s.start])
+		switch {
+		case added == "":
+			sb.WriteString(query[s.start:s.end])
+		case body == "":
+			sb.WriteString("{ " + added + " }")
+		default:
+			sb.WriteString("{ " + body + " && " + added + " }")
+		}
+		last = s.end
+	}
+	sb.WriteString(query[last:])
+	return sb.String(), nil
+}
+
+// IsTraceID returns true if id is a valid trace ID.
+func IsTraceID(id string) bool {
+	return traceIDRe.MatchString(id)
+}
+
+// NormalizeTraceID left pads the trace ID with zeros to 16 hex characters for 64 bit IDs or 32 hex characters for
+// 128 bit IDs; e.g. an ID whose leading zeros were dropped when it was printed as a number.
+func NormalizeTraceID(id string) (string, error) {
+	if !IsTraceID(id) {
+		return "", errors.Errorf("Invalid trace ID %v; trace IDs are at most 32 hex characters", id)
+	}
+	width := 32
+	if len(id) <= 16 {
+		width = 16
+	}
+	return strings.Repeat("0", width-len(id)) + id, nil
+}
+
+// NewTraceLink returns a GrafanaLink for an Explore view of the Tempo datasource with the uid. The link can be used
+// as the template for TracePatch.
+func NewTraceLink(baseURL string, datasourceUID string) *api.GrafanaLink {
+	return &api.GrafanaLink{
+		APIVersion: api.LinkGVK.GroupVersion().String(),
+		Kind:       api.LinkGVK.Kind,
+		Metadata:   api.Metadata{Name: tracePaneID},
+		BaseURL:    baseURL,
+		Panes: api.Panes{
+			tracePaneID: api.PaneBody{
+				Datasource: datasourceUID,
+				Queries: []api.Query{
+					{
+						RefID: "A",
+						Datasource: api.Datasource{
+							Type: api.TempoDatasourceType,
+							UID:  datasourceUID,
+						},
+						QueryType: api.TraceQLQueryType,
+					},
+				},
+			},
+		},
+	}
+}
+
+// TracePatch returns a patch that looks up the trace with the ID using the first Tempo query in the template.
+func TracePatch(template *api.GrafanaLink, traceID string) (*api.PanePatch, error) {
+	traceID, err := NormalizeTraceID(traceID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, paneID := range sortedKeys(template.Panes) {
+		for _, q := range template.Panes[paneID].Queries {
+			if q.Datasource.Type != api.TempoDatasourceType {
+				continue
+			}
+			fixTime := false
+			return &api.PanePatch{
+				Template: template.Metadata.Name,
+				Pane:     paneID,
+				RefID:    q.RefID,
+				Query: map[string]interface{}{
+					"queryType": api.TraceQLQueryType,
+					"query":     traceID,
+				},
+				// Trace lookups don't depend on the time range so use a relative range.
+				Range: api.TimeRange{
+					From: "now-1h",
+					To:   "now",
+				},
+				FixTime: &fixTime,
+			}, nil
+		}
+	}
+	return nil, errors.Errorf("Template %v doesn't have a query for a %v datasource", template.Metadata.Name, api.TempoDatasourceType)
+}
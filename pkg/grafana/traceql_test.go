@@ -0,0 +1,180 @@
+package grafana
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/grafctl/api"
+)
+
+func Test_BuildTraceQL(t *testing.T) {
+	service := TraceQLCondition{Attribute: "resource.service.name", Op: "=", Value: `"app"`}
+	slow := TraceQLCondition{Attribute: "duration", Op: ">", Value: "2s"}
+
+	type testCase struct {
+		name       string
+		query      string
+		conditions []TraceQLCondition
+		expected   string
+		expectErr  bool
+	}
+
+	cases := []testCase{
+		{
+			name:       "new",
+			conditions: []TraceQLCondition{service, slow},
+			expected:   `{ resource.service.name = "app" && duration > 2s }`,
+		},
+		{
+			name:       "existing",
+			query:      `{ status = error } | count() > 2`,
+			conditions: []TraceQLCondition{service},
+			expected:   `{ status = error && resource.service.name = "app" } | count() > 2`,
+		},
+		{
+			name:       "structural",
+			query:      `{ span.http.url = "/api/{id}" } >> {}`,
+			conditions: []TraceQLCondition{slow},
+			expected:   `{ span.http.url = "/api/{id}" && duration > 2s } >> { duration > 2s }`,
+		},
+		{
+			name:       "trace-id",
+			query:      `4bf92f3577b34da6a3ce929d0e0e4736`,
+			conditions: []TraceQLCondition{service},
+			expectErr:  true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := BuildTraceQL(c.query, c.conditions)
+			if c.expectErr {
+				if err == nil {
+					t.Fatalf("Expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to build TraceQL: %v", err)
+			}
+			if actual != c.expected {
+				t.Errorf("Got %v;\n Want %v", actual, c.expected)
+			}
+		})
+	}
+}
+
+func Test_TracePatch(t *testing.T) {
+	base := NewTraceLink("https://grafana.acme.com", "tempouid")
+	patch, err := TracePatch(base, "4bf92f3577b34da6a3ce929d0e0e4736")
+	if err != nil {
+		t.Fatalf("Failed to create patch: %v", err)
+	}
+
+	link, err := NewPatcher(FakeClock{}).ApplyPatch([]*api.GrafanaLink{base}, *patch)
+	if err != nil {
+		t.Fatalf("Error applying patch: %v", err)
+	}
+
+	expected := api.Panes{
+		"trace": api.PaneBody{
+			Datasource: "tempouid",
+			Queries: []api.Query{
+				{
+					RefID:            "A",
+					Datasource:       api.Datasource{Type: "tempo", UID: "tempouid"},
+					QueryType:        "traceql",
+					Query:            "4bf92f3577b34da6a3ce929d0e0e4736",
+					AdditionalFields: map[string]interface{}{},
+				},
+			},
+			Range: api.TimeRange{From: "now-1h", To: "now"},
+		},
+	}
+	if d := cmp.Diff(expected, link.Panes); d != "" {
+		t.Errorf("Unexpected diff:\n%v", d)
+	}
+
+	for _, id := range []string{"not-a-trace-id", "", "4bf92f3577b34da6a3ce929d0e0e4736ab"} {
+		if _, err := TracePatch(base, id); err == nil {
+			t.Errorf("Expected an error for the invalid trace ID %v", id)
+		}
+	}
+	if _, err := TracePatch(base, "4bf92f3577b34da6"); err != nil {
+		t.Errorf("Failed to build a patch for a 64 bit trace ID: %v", err)
+	}
+
+	logs := &api.GrafanaLink{
+		Metadata: api.Metadata{Name: "logs"},
+		Panes: api.Panes{
+			"eja": api.PaneBody{Queries: []api.Query{{Datasource: api.Datasource{Type: "loki"}}}},
+		},
+	}
+	if _, err := TracePatch(logs, "4bf92f3577b34da6a3ce929d0e0e4736"); err == nil {
+		t.Errorf("Expected an error for a template without a Tempo query")
+	}
+}
+
+func Test_NormalizeTraceID(t *testing.T) {
+	type testCase struct {
+		id        string
+		expected  string
+		expectErr bool
+	}
+
+	cases := []testCase{
+		{id: "4bf92f3577b34da6", expected: "4bf92f3577b34da6"},
+		{id: "bf92f3577b34da6", expected: "0bf92f3577b34da6"},
+		{id: "4bf92f3577b34da6a3ce929d0e0e4736", expected: "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{id: "bf92f3577b34da6a3ce929d0e0e4736", expected: "0bf92f3577b34da6a3ce929d0e0e4736"},
+		{id: "4bf92f3577b34da6a", expected: "0000000000000004bf92f3577b34da6a"},
+		{id: "abc", expected: "0000000000000abc"},
+		{id: "", expectErr: true},
+		{id: "not-a-trace-id", expectErr: true},
+		{id: "4bf92f3577b34da6a3ce929d0e0e4736a", expectErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.id, func(t *testing.T) {
+			actual, err := NormalizeTraceID(c.id)
+			if c.expectErr {
+				if err == nil {
+					t.Fatalf("Expected an error for trace ID %v", c.id)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to normalize trace ID %v: %v", c.id, err)
+			}
+			if d := cmp.Diff(c.expected, actual); d != "" {
+				t.Errorf("Unexpected diff:\n%v", d)
+			}
+		})
+	}
+}
+
+func Test_ApplyPatchTraceQLParams(t *testing.T) {
+	fixTime := false
+	base := NewTraceLink("https://grafana.acme.com", "tempouid")
+	base.Parameters = []api.Parameter{
+		{Name: "service", Attribute: "resource.service.name"},
+		{Name: "minDuration", Type: api.ParameterTypeDuration, Attribute: "duration", Operator: ">", Default: "2s"},
+		{Name: "status", Type: api.ParameterTypeEnum, Values: []string{"error", "ok", "unset"}, Attribute: "status", Default: "error"},
+	}
+
+	patch := api.PanePatch{
+		Template: "trace",
+		Params:   map[string]interface{}{"service": "app"},
+		FixTime:  &fixTime,
+	}
+
+	link, err := NewPatcher(FakeClock{}).ApplyPatch([]*api.GrafanaLink{base}, patch)
+	if err != nil {
+		t.Fatalf("Error applying patch: %v", err)
+	}
+
+	expected := `{ resource.service.name = "app" && duration > 2s && status = error }`
+	if actual := link.Panes["trace"].Queries[0].Query; actual != expected {
+		t.Errorf("Got %v;\n Want %v", actual, expected)
+	}
+}
@@ -0,0 +1,179 @@
+package grafana
+
+import (
+	"net/url"
+
+	"github.com/jlewi/grafctl/api"
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultOrgID is the organization links open if the GrafanaLink doesn't set one.
+	defaultOrgID = "1"
+	// defaultSchemaVersion is the version of the format of the panes of Explore links.
+	defaultSchemaVersion = "1"
+)
+
+var (
+	kioskModes = []string{api.KioskFull, api.KioskTV}
+	themes     = []string{api.ThemeLight, api.ThemeDark}
+)
+
+// linkQueryParams returns the query parameters of the link other than the ones describing the panes or dashboard.
+func linkQueryParams(link api.GrafanaLink) (url.Values, error) {
+	if err := checkURLOptions(link); err != nil {
+		return nil, err
+	}
+
+	queryParams := url.Values{}
+	for k, values := range link.QueryParams {
+		for _, v := range values {
+			queryParams.Add(k, v)
+		}
+	}
+
+	orgID := link.OrgID
+	if orgID == "" {
+		orgID = defaultOrgID
+	}
+	queryParams.Set("orgId", orgID)
+
+	switch link.Kiosk {
+	case api.KioskFull:
+		// Grafana shows the page in full kiosk mode if kiosk is set without a value.
+		queryParams.Set("kiosk", "")
+	case api.KioskTV:
+		queryParams.Set("kiosk", api.KioskTV)
+	}
+	if link.Theme != "" {
+		queryParams.Set("theme", link.Theme)
+	}
+
+	if link.Dashboard == nil {
+		schemaVersion := link.SchemaVersion
+		if schemaVersion == "" {
+			schemaVersion = defaultSchemaVersion
+		}
+		queryParams.Set("schemaVersion", schemaVersion)
+		if link.Refresh != "" {
+			queryParams.Set("refresh", link.Refresh)
+		}
+	}
+	return queryParams, nil
+}
+
+// setURLOptions sets the fields of the link from the query parameters of a URL. Defaults are omitted from the link
+// and parameters grafctl doesn't interpret are stored in QueryParams; e.g. a theme other than light or dark. Only
+// parameters that the link doesn't set itself (see reservedQueryParams) end up in QueryParams.
+func setURLOptions(link *api.GrafanaLink, queryParams map[string][]string) {
+	for k, values := range queryParams {
+		value := ""
+		if len(values) > 0 {
+			value = values[0]
+		}
+		switch {
+		case k == "orgId":
+			if value != defaultOrgID {
+				link.OrgID = value
+			}
+		case k == "kiosk" && (value == "" || value == "1" || value == "true" || value == api.KioskFull):
+			link.Kiosk = api.KioskFull
+		case k == "kiosk" && value == api.KioskTV:
+			link.Kiosk = api.KioskTV
+		case k == "theme" && isOneOf(themes, value):
+			link.Theme = value
+		case k == "schemaVersion" && link.Dashboard == nil:
+			if value != defaultSchemaVersion {
+				link.SchemaVersion = value
+			}
+		case k == "refresh" && link.Dashboard == nil:
+			link.Refresh = value
+		default:
+			if link.QueryParams == nil {
+				link.QueryParams = map[string][]string{}
+			}
+			link.QueryParams[k] = values
+		}
+	}
+}
+
+// applyURLOptions applies the patch's overrides of the query parameters of the link.
+func applyURLOptions(link *api.GrafanaLink, patch api.PanePatch) error {
+	if patch.OrgID != "" {
+		link.OrgID = patch.OrgID
+	}
+	// The fields override values of kiosk and theme that were kept in QueryParams.
+	switch patch.Kiosk {
+	case "":
+	case api.KioskOff:
+		link.Kiosk = ""
+		delete(link.QueryParams, "kiosk")
+	default:
+		link.Kiosk = patch.Kiosk
+		delete(link.QueryParams, "kiosk")
+	}
+	if patch.Theme != "" {
+		link.Theme = patch.Theme
+		delete(link.QueryParams, "theme")
+	}
+	if patch.Refresh != "" {
+		if link.Dashboard != nil {
+			link.Dashboard.Refresh = patch.Refresh
+		} else {
+			link.Refresh = patch.Refresh
+		}
+	}
+	for k, values := range patch.QueryParams {
+		if len(values) == 0 {
+			delete(link.QueryParams, k)
+			continue
+		}
+		if link.QueryParams == nil {
+			link.QueryParams = map[string][]string{}
+		}
+		link.QueryParams[k] = values
+	}
+	return checkURLOptions(*link)
+}
+
+// checkURLOptions checks the values of the fields of the link that are stored in query parameters.
+func checkURLOptions(link api.GrafanaLink) error {
+	if link.Kiosk != "" && !isOneOf(kioskModes, link.Kiosk) {
+		return errors.Errorf("Invalid kiosk mode %v; kiosk must be one of %v", link.Kiosk, kioskModes)
+	}
+	if link.Theme != "" && !isOneOf(themes, link.Theme) {
+		return errors.Errorf("Invalid theme %v; theme must be one of %v", link.Theme, themes)
+	}
+	for _, k := range reservedQueryParams(link) {
+		if _, ok := link.QueryParams[k]; ok {
+			return errors.Errorf("queryParams can't set %v; use the field of the GrafanaLink instead", k)
+		}
+	}
+	return nil
+}
+
+// reservedQueryParams returns the query parameters the link sets from its fields. QueryParams can't contain them.
+// kiosk and theme are only reserved if the link sets them so that values grafctl doesn't know about (e.g.
+// theme=system) are kept in QueryParams.
+func reservedQueryParams(link api.GrafanaLink) []string {
+	reserved := []string{"orgId"}
+	if link.Dashboard == nil {
+		reserved = append(reserved, "schemaVersion", "refresh", "panes")
+	}
+	if link.Kiosk != "" {
+		reserved = append(reserved, "kiosk")
+	}
+	if link.Theme != "" {
+		reserved = append(reserved, "theme")
+	}
+	return reserved
+}
+
+func isOneOf(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package grafana
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/grafctl/api"
+)
+
+func Test_URLOptionsRoundTrip(t *testing.T) {
+	type testCase struct {
+		name     string
+		input    string
+		expected *api.GrafanaLink
+	}
+
+	cases := []testCase{
+		{
+			name:  "explore",
+			input: "https://grafana.acme.com/explore?kiosk=&orgId=2&panes=%7B%7D&plugin=foo&refresh=30s&schemaVersion=1&theme=light",
+			expected: &api.GrafanaLink{
+				APIVersion:  api.LinkGVK.GroupVersion().String(),
+				Kind:        api.LinkGVK.Kind,
+				BaseURL:     "https://grafana.acme.com",
+				OrgID:       "2",
+				Kiosk:       api.KioskFull,
+				Theme:       api.ThemeLight,
+				Refresh:     "30s",
+				QueryParams: map[string][]string{"plugin": {"foo"}},
+				Panes:       api.Panes{},
+			},
+		},
+		{
+			name:  "dashboard",
+			input: "https://grafana.acme.com/d/abc123?kiosk=tv&orgId=1&refresh=1m&theme=dark",
+			expected: &api.GrafanaLink{
+				APIVersion: api.LinkGVK.GroupVersion().String(),
+				Kind:       api.LinkGVK.Kind,
+				BaseURL:    "https://grafana.acme.com",
+				Kiosk:      api.KioskTV,
+				Theme:      api.ThemeDark,
+				Dashboard: &api.Dashboard{
+					UID:     "abc123",
+					Refresh: "1m",
+				},
+			},
+		},
+		{
+			name:  "unknown-values",
+			input: "https://grafana.acme.com/explore?kiosk=off&orgId=1&panes=%7B%7D&schemaVersion=1&theme=system",
+			expected: &api.GrafanaLink{
+				APIVersion:  api.LinkGVK.GroupVersion().String(),
+				Kind:        api.LinkGVK.Kind,
+				BaseURL:     "https://grafana.acme.com",
+				QueryParams: map[string][]string{"kiosk": {"off"}, "theme": {"system"}},
+				Panes:       api.Panes{},
+			},
+		},
+		{
+			name:  "dashboard-schema-version",
+			input: "https://grafana.acme.com/d/abc123?orgId=1&schemaVersion=1&theme=system",
+			expected: &api.GrafanaLink{
+				APIVersion:  api.LinkGVK.GroupVersion().String(),
+				Kind:        api.LinkGVK.Kind,
+				BaseURL:     "https://grafana.acme.com",
+				QueryParams: map[string][]string{"schemaVersion": {"1"}, "theme": {"system"}},
+				Dashboard: &api.Dashboard{
+					UID: "abc123",
+				},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			link, err := URLToLink(c.input)
+			if err != nil {
+				t.Fatalf("Failed to convert URL to link: %v", err)
+			}
+			if d := cmp.Diff(c.expected, link); d != "" {
+				t.Fatalf("Unexpected diff:\n%v", d)
+			}
+
+			u, err := LinkToURL(*link)
+			if err != nil {
+				t.Fatalf("Failed to convert link to URL: %v", err)
+			}
+			if u != c.input {
+				t.Errorf("Got URL %v; want %v", u, c.input)
+			}
+		})
+	}
+}
+
+func Test_applyURLOptions(t *testing.T) {
+	type testCase struct {
+		name      string
+		link      api.GrafanaLink
+		patch     api.PanePatch
+		expected  api.GrafanaLink
+		expectErr bool
+	}
+
+	cases := []testCase{
+		{
+			name: "override",
+			link: api.GrafanaLink{
+				Kiosk:       api.KioskTV,
+				QueryParams: map[string][]string{"plugin": {"foo"}, "other": {"bar"}},
+			},
+			patch: api.PanePatch{
+				OrgID:       "3",
+				Kiosk:       api.KioskOff,
+				Theme:       api.ThemeDark,
+				Refresh:     "5s",
+				QueryParams: map[string][]string{"plugin": {}, "new": {"baz"}},
+			},
+			expected: api.GrafanaLink{
+				OrgID:       "3",
+				Theme:       api.ThemeDark,
+				Refresh:     "5s",
+				QueryParams: map[string][]string{"other": {"bar"}, "new": {"baz"}},
+			},
+		},
+		{
+			name: "dashboard-refresh",
+			link: api.GrafanaLink{
+				Dashboard: &api.Dashboard{UID: "abc123"},
+			},
+			patch: api.PanePatch{
+				Refresh: "5s",
+			},
+			expected: api.GrafanaLink{
+				Dashboard: &api.Dashboard{UID: "abc123", Refresh: "5s"},
+			},
+		},
+		{
+			name: "override-unknown-values",
+			link: api.GrafanaLink{
+				QueryParams: map[string][]string{"kiosk": {"off"}, "theme": {"system"}},
+			},
+			patch: api.PanePatch{
+				Kiosk: api.KioskTV,
+				Theme: api.ThemeDark,
+			},
+			expected: api.GrafanaLink{
+				Kiosk:       api.KioskTV,
+				Theme:       api.ThemeDark,
+				QueryParams: map[string][]string{},
+			},
+		},
+		{
+			name:      "bad-theme",
+			patch:     api.PanePatch{Theme: "blue"},
+			expectErr: true,
+		},
+		{
+			name:      "reserved-param",
+			patch:     api.PanePatch{QueryParams: map[string][]string{"orgId": {"2"}}},
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			link := c.link
+			err := applyURLOptions(&link, c.patch)
+			if c.expectErr {
+				if err == nil {
+					t.Fatalf("Expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to apply URL options: %v", err)
+			}
+			if d := cmp.Diff(c.expected, link); d != "" {
+				t.Errorf("Unexpected diff:\n%v", d)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package grafana
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/jlewi/grafctl/api"
+	"github.com/jlewi/grafctl/api/v1alpha1"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// SupportedVersions returns the apiVersions grafctl can read. Resources are written using the first version.
+func SupportedVersions() []string {
+	return []string{api.LinkGVK.GroupVersion().String(), v1alpha1.LinkGVK.GroupVersion().String()}
+}
+
+// DecodeGrafanaLink decodes a GrafanaLink of any supported version and converts it to the current version.
+func DecodeGrafanaLink(n *yaml.Node) (*api.GrafanaLink, error) {
+	version, err := apiVersion(n)
+	if err != nil {
+		return nil, err
+	}
+
+	switch version {
+	case api.LinkGVK.GroupVersion().String():
+		link := &api.GrafanaLink{}
+		if err := n.Decode(link); err != nil {
+			return nil, errors.Wrapf(err, "Failed to decode GrafanaLink")
+		}
+		return link, nil
+	case v1alpha1.LinkGVK.GroupVersion().String():
+		old := &v1alpha1.GrafanaLink{}
+		if err := n.Decode(old); err != nil {
+			return nil, errors.Wrapf(err, "Failed to decode %v GrafanaLink", v1alpha1.Version)
+		}
+		return v1alpha1.Upgrade(old)
+	}
+	return nil, errors.Errorf("Unsupported apiVersion %v; apiVersion must be one of %v", version, SupportedVersions())
+}
+
+// DecodeLinkBundle decodes a LinkBundle of any supported version and converts it to the current version.
+func DecodeLinkBundle(n *yaml.Node) (*api.LinkBundle, error) {
+	version, err := apiVersion(n)
+	if err != nil {
+		return nil, err
+	}
+	if !isSupportedVersion(version) {
+		return nil, errors.Errorf("Unsupported apiVersion %v; apiVersion must be one of %v", version, SupportedVersions())
+	}
+
+	// LinkBundles have the same shape in every version.
+	bundle := &api.LinkBundle{}
+	if err := n.Decode(bundle); err != nil {
+		return nil, errors.Wrapf(err, "Failed to decode LinkBundle")
+	}
+	bundle.APIVersion = api.BundleGVK.GroupVersion().String()
+	return bundle, nil
+}
+
+// UpgradePatch converts a patch of any supported version to the current version. apiVersion is optional for
+// patches.
+func UpgradePatch(patch *api.PanePatch) error {
+	if patch.APIVersion == "" {
+		return nil
+	}
+	if !isSupportedVersion(patch.APIVersion) {
+		return errors.Errorf("Unsupported apiVersion %v; apiVersion must be one of %v", patch.APIVersion, SupportedVersions())
+	}
+	// Patches have the same shape in every version.
+	patch.APIVersion = api.PatchGVK.GroupVersion().String()
+	return nil
+}
+
+func isSupportedVersion(version string) bool {
+	for _, v := range SupportedVersions() {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+func apiVersion(n *yaml.Node) (string, error) {
+	meta := struct {
+		APIVersion string `yaml:"apiVersion"`
+	}{}
+	if err := n.Decode(&meta); err != nil {
+		return "", errors.Wrapf(err, "Failed to decode apiVersion")
+	}
+	return meta.APIVersion, nil
+}
+
+// MigrateYAML converts the GrafanaLinks and LinkBundles in the YAML documents in data to the current version.
+// Other documents are left unchanged. It returns false if none of the documents needed to be converted. Comments
+// in converted GrafanaLinks are lost.
+func MigrateYAML(data []byte) ([]byte, bool, error) {
+	current := api.LinkGVK.GroupVersion().String()
+	docs := make([]*yaml.Node, 0)
+	changed := false
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		doc := &yaml.Node{}
+		err := decoder.Decode(doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false, errors.Wrapf(err, "Failed to decode YAML")
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		docs = append(docs, doc)
+
+		n := doc.Content[0]
+		meta := struct {
+			APIVersion string `yaml:"apiVersion"`
+			Kind       string `yaml:"kind"`
+		}{}
+		if err := n.Decode(&meta); err != nil || meta.APIVersion == current {
+			continue
+		}
+
+		switch meta.Kind {
+		case api.LinkGVK.Kind:
+			link, err := DecodeGrafanaLink(n)
+			if err != nil {
+				return nil, false, err
+			}
+			converted := &yaml.Node{}
+			if err := converted.Encode(link); err != nil {
+				return nil, false, errors.Wrapf(err, "Failed to encode GrafanaLink %v", link.Metadata.Name)
+			}
+			doc.Content[0] = converted
+			changed = true
+		case api.BundleGVK.Kind:
+			if _, err := DecodeLinkBundle(n); err != nil {
+				return nil, false, err
+			}
+			// LinkBundles have the same shape in every version so only the apiVersion changes.
+			setAPIVersion(n, current)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return data, false, nil
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	for _, doc := range docs {
+		if err := encoder.Encode(doc); err != nil {
+			return nil, false, errors.Wrapf(err, "Failed to encode YAML")
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, false, errors.Wrapf(err, "Failed to encode YAML")
+	}
+	return buf.Bytes(), true, nil
+}
+
+func setAPIVersion(n *yaml.Node, version string) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == "apiVersion" {
+			n.Content[i+1].Value = version
+			return
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package grafana
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/grafctl/api"
+	"gopkg.in/yaml.v3"
+)
+
+func Test_DecodeGrafanaLink(t *testing.T) {
+	type testCase struct {
+		name      string
+		input     string
+		expected  *api.GrafanaLink
+		expectErr bool
+	}
+
+	expected := &api.GrafanaLink{
+		APIVersion: "grafctl.foyle.io/v1alpha2",
+		Kind:       "GrafanaLink",
+		Metadata:   api.Metadata{Name: "logs"},
+		BaseURL:    "https://grafana.acme.com",
+		Panes: api.Panes{
+			"eja": api.PaneBody{
+				Queries: []api.Query{
+					{
+						RefID: "A",
+						AdditionalFields: map[string]interface{}{
+							"builderOptions": map[string]interface{}{"table": "logs"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	cases := []testCase{
+		{
+			name: "v1alpha2",
+			input: `apiVersion: grafctl.foyle.io/v1alpha2
+kind: GrafanaLink
+metadata:
+  name: logs
+baseURL: https://grafana.acme.com
+panes:
+  eja:
+    queries:
+      - refId: A
+        builderOptions:
+          table: logs
+`,
+			expected: expected,
+		},
+		{
+			name: "v1alpha1",
+			input: `apiVersion: grafctl.foyle.io/v1alpha1
+kind: GrafanaLink
+metadata:
+  name: logs
+baseURL: https://grafana.acme.com
+panes:
+  eja:
+    queries:
+      - refId: A
+        builderOptions:
+          table: logs
+`,
+			expected: expected,
+		},
+		{
+			name: "unsupported",
+			input: `apiVersion: grafctl.foyle.io/v2
+kind: GrafanaLink
+`,
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			n := &yaml.Node{}
+			if err := yaml.Unmarshal([]byte(c.input), n); err != nil {
+				t.Fatalf("Failed to unmarshal: %v", err)
+			}
+			actual, err := DecodeGrafanaLink(n.Content[0])
+			if c.expectErr {
+				if err == nil {
+					t.Fatalf("Expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to decode link: %v", err)
+			}
+			if d := cmp.Diff(c.expected, actual); d != "" {
+				t.Errorf("Unexpected diff:\n%v", d)
+			}
+		})
+	}
+}
+
+func Test_MigrateYAML(t *testing.T) {
+	type testCase struct {
+		name     string
+		input    string
+		expected string
+		changed  bool
+	}
+
+	cases := []testCase{
+		{
+			name: "migrate",
+			input: `apiVersion: grafctl.foyle.io/v1alpha1
+kind: GrafanaLink
+metadata:
+  name: logs
+baseURL: https://grafana.acme.com
+panes:
+  eja:
+    queries:
+      - refId: A
+        builderOptions:
+          table: logs
+---
+# The bundle keeps its comments.
+apiVersion: grafctl.foyle.io/v1alpha1
+kind: LinkBundle
+metadata:
+  name: overview
+templates:
+  - template: logs
+---
+logLevel: info
+`,
+			expected: `apiVersion: grafctl.foyle.io/v1alpha2
+kind: GrafanaLink
+metadata:
+  name: logs
+  labels: {}
+baseURL: https://grafana.acme.com
+panes:
+  eja:
+    queries:
+      - builderOptions:
+          table: logs
+        refId: A
+---
+# The bundle keeps its comments.
+apiVersion: grafctl.foyle.io/v1alpha2
+kind: LinkBundle
+metadata:
+  name: overview
+templates:
+  - template: logs
+---
+logLevel: info
+`,
+			changed: true,
+		},
+		{
+			name: "current",
+			input: `apiVersion: grafctl.foyle.io/v1alpha2
+kind: GrafanaLink
+metadata:
+  name: logs
+`,
+			expected: `apiVersion: grafctl.foyle.io/v1alpha2
+kind: GrafanaLink
+metadata:
+  name: logs
+`,
+			changed: false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, changed, err := MigrateYAML([]byte(c.input))
+			if err != nil {
+				t.Fatalf("Failed to migrate: %v", err)
+			}
+			if changed != c.changed {
+				t.Errorf("Expected changed to be %v but got %v", c.changed, changed)
+			}
+			if d := cmp.Diff(c.expected, string(actual)); d != "" {
+				t.Errorf("Unexpected diff:\n%v", d)
+			}
+		})
+	}
+}
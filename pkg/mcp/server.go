@@ -0,0 +1,464 @@
+// Package mcp implements a Model Context Protocol server that advertises the templates in the config directory as
+// tools so that agents can discover the templates and build links without generating patch files.
+// https://modelcontextprotocol.io/specification/2024-11-05
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/go-logr/zapr"
+	"github.com/jlewi/grafctl/api"
+	"github.com/jlewi/grafctl/pkg/grafana"
+	"github.com/jlewi/grafctl/pkg/schema"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// ProtocolVersion is the version of the protocol the server implements.
+	ProtocolVersion = "2024-11-05"
+
+	// maxMessageSize is the maximum size of a message read from the client.
+	maxMessageSize = 10 << 20
+
+	jsonRPCVersion = "2.0"
+
+	// Error codes defined by JSON-RPC.
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+var (
+	// invalidToolChars matches the characters that aren't allowed in the names of tools.
+	invalidToolChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+	// defaultRange is the time range of links built by tools that don't set one and whose template doesn't have one.
+	defaultRange = api.TimeRange{From: "now-1h", To: "now"}
+)
+
+// QueryClient runs queries using the Grafana API.
+type QueryClient interface {
+	Query(ctx context.Context, request grafana.QueryRequest) (*grafana.QueryResponse, error)
+}
+
+// Tool is a tool advertised to the client.
+type Tool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema *schema.Schema `json:"inputSchema"`
+}
+
+// Content is an item of the result of a tool.
+type Content struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// CallToolResult is the result of calling a tool. Errors building the link are reported in the result with IsError
+// set so that the model can see them and correct its arguments.
+type CallToolResult struct {
+	Content []Content `json:"content"`
+	IsError bool      `json:"isError,omitempty"`
+}
+
+// toolArguments are the arguments of the tools.
+type toolArguments struct {
+	Params     map[string]interface{} `json:"params,omitempty"`
+	Range      api.TimeRange          `json:"range,omitempty"`
+	RunQueries bool                   `json:"runQueries,omitempty"`
+}
+
+// request is a JSON-RPC request or notification. Notifications don't have an ID.
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Server is an MCP server using the stdio transport. Each GrafanaLink and LinkBundle in Dir is a tool. The templates
+// are read for every request so that changes are picked up without restarting the server.
+type Server struct {
+	// Dir is the directory containing the GrafanaLinks and LinkBundles.
+	Dir string
+	// Version is the version of grafctl reported to the client.
+	Version string
+	patcher *grafana.Patcher
+	client  QueryClient
+
+	mu sync.Mutex
+}
+
+// NewServer creates a server that builds links from the templates in dir using the patcher. client runs the queries
+// of links when a tool is called with runQueries; it can be nil if the Grafana API isn't configured.
+func NewServer(dir string, patcher *grafana.Patcher, client QueryClient) (*Server, error) {
+	if patcher == nil {
+		return nil, errors.New("Patcher must be set to create an MCP server")
+	}
+	return &Server{
+		Dir:     dir,
+		Version: "dev",
+		patcher: patcher,
+		client:  client,
+	}, nil
+}
+
+// Serve reads newline delimited JSON-RPC messages from r and writes the responses to w until r is closed or ctx is
+// cancelled.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	log := zapr.NewLogger(zap.L())
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		resp := s.handleMessage(ctx, line)
+		if resp == nil {
+			continue
+		}
+		if err := s.write(w, resp); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrapf(err, "Failed to read messages")
+	}
+	log.Info("Client closed the connection")
+	return nil
+}
+
+func (s *Server) write(w io.Writer, resp *response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to marshal response")
+	}
+	b = append(b, '\n')
+	if _, err := w.Write(b); err != nil {
+		return errors.Wrapf(err, "Failed to write response")
+	}
+	return nil
+}
+
+// handleMessage handles a single message. It returns nil for notifications.
+func (s *Server) handleMessage(ctx context.Context, data []byte) *response {
+	log := zapr.NewLogger(zap.L())
+	req := request{}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return errorResponse(json.RawMessage("null"), codeParseError, fmt.Sprintf("Failed to parse message: %v", err))
+	}
+	if req.JSONRPC != jsonRPCVersion || req.Method == "" {
+		if len(req.ID) == 0 {
+			return nil
+		}
+		return errorResponse(req.ID, codeInvalidRequest, "Invalid JSON-RPC request")
+	}
+
+	log.V(1).Info("Handling request", "method", req.Method)
+	result, rpcErr := s.handle(ctx, req)
+	if len(req.ID) == 0 {
+		// Notifications don't get a response.
+		return nil
+	}
+	if rpcErr != nil {
+		return &response{JSONRPC: jsonRPCVersion, ID: req.ID, Error: rpcErr}
+	}
+	return &response{JSONRPC: jsonRPCVersion, ID: req.ID, Result: result}
+}
+
+func (s *Server) handle(ctx context.Context, req request) (interface{}, *rpcError) {
+	switch req.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"protocolVersion": ProtocolVersion,
+			"capabilities": map[string]interface{}{
+				"tools": map[string]interface{}{},
+			},
+			"serverInfo": map[string]interface{}{
+				"name":    "grafctl",
+				"version": s.Version,
+			},
+		}, nil
+	case "notifications/initialized", "notifications/cancelled":
+		return nil, nil
+	case "ping":
+		return map[string]interface{}{}, nil
+	case "tools/list":
+		links, bundles, err := s.templates()
+		if err != nil {
+			return nil, &rpcError{Code: codeInvalidRequest, Message: err.Error()}
+		}
+		tools, _ := toolsFor(links, bundles)
+		return map[string]interface{}{"tools": tools}, nil
+	case "tools/call":
+		params := struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments,omitempty"`
+		}{}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("Invalid params: %v", err)}
+		}
+		result, err := s.CallTool(ctx, params.Name, params.Arguments)
+		if err != nil {
+			return nil, &rpcError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		return result, nil
+	}
+	return nil, &rpcError{Code: codeMethodNotFound, Message: fmt.Sprintf("Method %v not found", req.Method)}
+}
+
+// templates loads the templates in the directory.
+func (s *Server) templates() ([]*api.GrafanaLink, []*api.LinkBundle, error) {
+	links, err := grafana.LoadGrafanaLinksInDir(s.Dir)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Error loading Grafana links from %v", s.Dir)
+	}
+	bundles, err := grafana.LoadLinkBundlesInDir(s.Dir)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Error loading link bundles from %v", s.Dir)
+	}
+	return links, bundles, nil
+}
+
+// toolsFor returns the tools for the templates and a map from the names of the tools to the names of the templates.
+func toolsFor(links []*api.GrafanaLink, bundles []*api.LinkBundle) ([]Tool, map[string]string) {
+	log := zapr.NewLogger(zap.L())
+	tools := make([]Tool, 0, len(links)+len(bundles))
+	names := map[string]string{}
+	add := func(template string, description string, params []api.Parameter) {
+		name := ToolName(template)
+		if existing, ok := names[name]; ok {
+			log.Info("Skipping template because its tool name is already used", "template", template, "tool", name, "usedBy", existing)
+			return
+		}
+		names[name] = template
+		tools = append(tools, Tool{
+			Name:        name,
+			Description: toolDescription(template, description),
+			InputSchema: inputSchema(params),
+		})
+	}
+
+	for _, b := range bundles {
+		params := []api.Parameter{}
+		seen := map[string]bool{}
+		for _, t := range b.Templates {
+			for _, l := range links {
+				if l.Metadata.Name != t.Template {
+					continue
+				}
+				for _, p := range l.Parameters {
+					if seen[p.Name] {
+						continue
+					}
+					seen[p.Name] = true
+					// The bundle sets some of the parameters of its templates; those become optional.
+					if _, ok := t.Params[p.Name]; ok && p.Default == nil {
+						p.Default = t.Params[p.Name]
+					}
+					params = append(params, p)
+				}
+			}
+		}
+		add(b.Metadata.Name, b.Description, params)
+	}
+	for _, l := range links {
+		add(l.Metadata.Name, l.Description, l.Parameters)
+	}
+
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+	return tools, names
+}
+
+// CallTool builds the link for the template of the tool. If runQueries is set in the arguments the queries of the
+// link are also run and the results are returned after the URL.
+func (s *Server) CallTool(ctx context.Context, name string, arguments json.RawMessage) (*CallToolResult, error) {
+	links, bundles, err := s.templates()
+	if err != nil {
+		return nil, err
+	}
+	_, names := toolsFor(links, bundles)
+	template, ok := names[name]
+	if !ok {
+		return nil, errors.Errorf("Unknown tool %v", name)
+	}
+
+	args := toolArguments{}
+	if len(arguments) > 0 {
+		if err := json.Unmarshal(arguments, &args); err != nil {
+			return toolError(errors.Wrapf(err, "Invalid arguments")), nil
+		}
+	}
+
+	r := args.Range
+	if r.From == "" && r.To == "" {
+		r = templateRange(template, links)
+	}
+	patch := api.PanePatch{
+		Template: template,
+		Params:   args.Params,
+		Range:    r,
+	}
+
+	link, err := s.patcher.ApplyTemplatePatch(links, bundles, patch)
+	if err != nil {
+		return toolError(err), nil
+	}
+	u, err := grafana.LinkToURL(*link)
+	if err != nil {
+		return toolError(err), nil
+	}
+
+	result := &CallToolResult{
+		Content: []Content{{Type: "text", Text: u}},
+	}
+	if !args.RunQueries {
+		return result, nil
+	}
+
+	results, err := s.runQueries(ctx, link)
+	if err != nil {
+		result.Content = append(result.Content, Content{Type: "text", Text: fmt.Sprintf("Failed to run the queries: %v", err)})
+		result.IsError = true
+		return result, nil
+	}
+	result.Content = append(result.Content, Content{Type: "text", Text: results})
+	return result, nil
+}
+
+// runQueries runs the queries of the link and returns the results as tables.
+func (s *Server) runQueries(ctx context.Context, link *api.GrafanaLink) (string, error) {
+	if s.client == nil {
+		return "", errors.New("The Grafana API isn't configured so queries can't be run")
+	}
+	requests, err := grafana.LinkToQueryRequests(*link)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	for _, request := range requests {
+		resp, err := s.client.Query(ctx, request)
+		if err != nil {
+			return "", err
+		}
+		if err := grafana.WriteQueryResponse(&b, resp, grafana.OutputTable); err != nil {
+			return "", errors.Wrapf(err, "Error writing query results")
+		}
+	}
+	return b.String(), nil
+}
+
+// ToolName returns the name of the tool for the template. Characters that aren't allowed in the names of tools are
+// replaced with underscores.
+func ToolName(template string) string {
+	name := invalidToolChars.ReplaceAllString(template, "_")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+func toolDescription(template string, description string) string {
+	d := fmt.Sprintf("Build a link to the Grafana template %v and return its URL.", template)
+	if description != "" {
+		d = description + "\n\n" + d
+	}
+	return d + " Set runQueries to also run the queries and return the results."
+}
+
+// inputSchema returns the schema of the arguments of the tool for a template with the parameters.
+func inputSchema(params []api.Parameter) *schema.Schema {
+	ps := schema.ForParams(params)
+	ps.Description = "The values of the template's parameters."
+	s := &schema.Schema{
+		Type: "object",
+		Properties: map[string]*schema.Schema{
+			"params": ps,
+			"range": {
+				Type:        "object",
+				Description: "The time range of the link using Grafana's syntax e.g. now-1h or an RFC3339 time. Defaults to the range of the template.",
+				Properties: map[string]*schema.Schema{
+					"from": {Type: "string"},
+					"to":   {Type: "string"},
+				},
+				AdditionalProperties: false,
+			},
+			"runQueries": {
+				Type:        "boolean",
+				Description: "Run the queries of the link using the Grafana API and return the results as well as the URL.",
+			},
+		},
+		AdditionalProperties: false,
+	}
+	if len(ps.Required) > 0 {
+		s.Required = []string{"params"}
+	}
+	return s
+}
+
+// templateRange returns the time range of the template; the range of its dashboard or of its first pane. It returns
+// defaultRange if the template doesn't have a range e.g. because it is a bundle.
+func templateRange(template string, links []*api.GrafanaLink) api.TimeRange {
+	for _, l := range links {
+		if l.Metadata.Name != template {
+			continue
+		}
+		if l.Dashboard != nil && l.Dashboard.Range.From != "" {
+			return l.Dashboard.Range
+		}
+		ids := make([]string, 0, len(l.Panes))
+		for id := range l.Panes {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			if r := l.Panes[id].Range; r.From != "" && r.To != "" {
+				return r
+			}
+		}
+	}
+	return defaultRange
+}
+
+func toolError(err error) *CallToolResult {
+	return &CallToolResult{
+		Content: []Content{{Type: "text", Text: err.Error()}},
+		IsError: true,
+	}
+}
+
+func errorResponse(id json.RawMessage, code int, message string) *response {
+	return &response{
+		JSONRPC: jsonRPCVersion,
+		ID:      id,
+		Error:   &rpcError{Code: code, Message: message},
+	}
+}
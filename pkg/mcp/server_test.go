@@ -0,0 +1,242 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/grafctl/pkg/grafana"
+)
+
+const testLinks = `apiVersion: grafctl.foyle.io/v1alpha2
+kind: GrafanaLink
+metadata:
+  name: service.logs
+description: The logs of a service.
+baseURL: https://grafana.acme.com
+parameters:
+  - name: app
+    label: app
+    description: The name of the service.
+  - name: level
+    type: enum
+    values: [info, error]
+    label: level
+    default: error
+panes:
+  a:
+    datasource: loki
+    queries:
+      - refId: A
+        datasource:
+          type: loki
+          uid: loki
+        expr: '{env="prod"}'
+    range:
+      from: now-6h
+      to: now
+---
+apiVersion: grafctl.foyle.io/v1alpha2
+kind: GrafanaLink
+metadata:
+  name: overview
+baseURL: https://grafana.acme.com
+dashboard:
+  uid: abc123
+`
+
+// fakeQueryClient returns the same response for every query.
+type fakeQueryClient struct {
+	requests []grafana.QueryRequest
+}
+
+func (f *fakeQueryClient) Query(ctx context.Context, request grafana.QueryRequest) (*grafana.QueryResponse, error) {
+	f.requests = append(f.requests, request)
+	return &grafana.QueryResponse{
+		Results: map[string]grafana.QueryResult{
+			"A": {
+				Frames: []grafana.Frame{
+					{
+						Schema: grafana.FrameSchema{RefID: "A", Fields: []grafana.FrameField{{Name: "line"}}},
+						Data:   grafana.FrameData{Values: [][]any{{"hello"}}},
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+func newTestServer(t *testing.T) (*Server, *fakeQueryClient) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "links.yaml"), []byte(testLinks), 0644); err != nil {
+		t.Fatalf("Failed to write templates: %v", err)
+	}
+	client := &fakeQueryClient{}
+	s, err := NewServer(dir, grafana.NewPatcher(grafana.RealClock{}), client)
+	if err != nil {
+		t.Fatalf("Failed to create server: %+v", err)
+	}
+	return s, client
+}
+
+// call sends the messages to the server and returns the responses.
+func call(t *testing.T, s *Server, messages ...string) []map[string]interface{} {
+	var out bytes.Buffer
+	if err := s.Serve(context.Background(), strings.NewReader(strings.Join(messages, "\n")), &out); err != nil {
+		t.Fatalf("Serve failed: %+v", err)
+	}
+	responses := []map[string]interface{}{}
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		resp := map[string]interface{}{}
+		if err := decoder.Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		responses = append(responses, resp)
+	}
+	return responses
+}
+
+func Test_Protocol(t *testing.T) {
+	s, _ := newTestServer(t)
+	responses := call(t, s,
+		`{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {"protocolVersion": "2024-11-05", "capabilities": {}, "clientInfo": {"name": "test"}}}`,
+		`{"jsonrpc": "2.0", "method": "notifications/initialized"}`,
+		`{"jsonrpc": "2.0", "id": "two", "method": "ping"}`,
+		`{"jsonrpc": "2.0", "id": 3, "method": "resources/list"}`,
+		`{"jsonrpc": "2.0", "id": 4, "method": `,
+	)
+
+	if len(responses) != 4 {
+		t.Fatalf("Got %v responses; want 4: %v", len(responses), responses)
+	}
+	result := responses[0]["result"].(map[string]interface{})
+	if result["protocolVersion"] != ProtocolVersion {
+		t.Errorf("Got protocolVersion %v; want %v", result["protocolVersion"], ProtocolVersion)
+	}
+	if responses[1]["id"] != "two" {
+		t.Errorf("Got id %v; want two", responses[1]["id"])
+	}
+	for i, code := range map[int]float64{2: codeMethodNotFound, 3: codeParseError} {
+		rpcErr := responses[i]["error"].(map[string]interface{})
+		if rpcErr["code"] != code {
+			t.Errorf("Response %v has error code %v; want %v", i, rpcErr["code"], code)
+		}
+	}
+}
+
+func Test_ListTools(t *testing.T) {
+	s, _ := newTestServer(t)
+	responses := call(t, s, `{"jsonrpc": "2.0", "id": 1, "method": "tools/list"}`)
+
+	b, err := json.Marshal(responses[0]["result"])
+	if err != nil {
+		t.Fatalf("Failed to marshal result: %v", err)
+	}
+	result := struct {
+		Tools []Tool `json:"tools"`
+	}{}
+	if err := json.Unmarshal(b, &result); err != nil {
+		t.Fatalf("Failed to unmarshal tools: %v", err)
+	}
+
+	names := []string{}
+	for _, tool := range result.Tools {
+		names = append(names, tool.Name)
+	}
+	if d := cmp.Diff([]string{"overview", "service_logs"}, names); d != "" {
+		t.Fatalf("Unexpected tools:\n%v", d)
+	}
+
+	tool := result.Tools[1]
+	if !strings.HasPrefix(tool.Description, "The logs of a service.") {
+		t.Errorf("Tool description %v doesn't start with the template's description", tool.Description)
+	}
+	params := tool.InputSchema.Properties["params"]
+	if d := cmp.Diff([]string{"app"}, params.Required); d != "" {
+		t.Errorf("Unexpected required params:\n%v", d)
+	}
+	if d := cmp.Diff([]interface{}{"info", "error"}, params.Properties["level"].Enum); d != "" {
+		t.Errorf("Unexpected enum:\n%v", d)
+	}
+	if d := cmp.Diff([]string{"params"}, tool.InputSchema.Required); d != "" {
+		t.Errorf("Unexpected required arguments:\n%v", d)
+	}
+}
+
+func Test_CallTool(t *testing.T) {
+	type testCase struct {
+		name      string
+		tool      string
+		arguments string
+		contains  []string
+		isError   bool
+		queries   int
+	}
+
+	cases := []testCase{
+		{
+			name:      "link",
+			tool:      "service_logs",
+			arguments: `{"params": {"app": "foyle"}}`,
+			contains:  []string{"https://grafana.acme.com/explore?", "app%3D%5C%22foyle%5C%22", "level%3D%5C%22error%5C%22"},
+		},
+		{
+			name:      "run-queries",
+			tool:      "service_logs",
+			arguments: `{"params": {"app": "foyle", "level": "info"}, "range": {"from": "now-15m", "to": "now"}, "runQueries": true}`,
+			contains:  []string{"level%3D%5C%22info%5C%22", "hello"},
+			queries:   1,
+		},
+		{
+			name:      "dashboard",
+			tool:      "overview",
+			arguments: `{}`,
+			contains:  []string{"https://grafana.acme.com/d/abc123?", "from="},
+		},
+		{
+			name:      "missing-param",
+			tool:      "service_logs",
+			arguments: `{"params": {}}`,
+			contains:  []string{"Parameter app is required"},
+			isError:   true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s, client := newTestServer(t)
+			result, err := s.CallTool(context.Background(), c.tool, json.RawMessage(c.arguments))
+			if err != nil {
+				t.Fatalf("CallTool failed: %+v", err)
+			}
+			if result.IsError != c.isError {
+				t.Fatalf("Got isError %v; want %v; result %+v", result.IsError, c.isError, result)
+			}
+			text := ""
+			for _, content := range result.Content {
+				text += content.Text + "\n"
+			}
+			for _, s := range c.contains {
+				if !strings.Contains(text, s) {
+					t.Errorf("Result %v doesn't contain %v", text, s)
+				}
+			}
+			if len(client.requests) != c.queries {
+				t.Errorf("Got %v queries; want %v", len(client.requests), c.queries)
+			}
+		})
+	}
+}
+
+func Test_UnknownTool(t *testing.T) {
+	s, _ := newTestServer(t)
+	if _, err := s.CallTool(context.Background(), "metrics", nil); err == nil {
+		t.Errorf("Expected an error calling an unknown tool")
+	}
+}
@@ -0,0 +1,446 @@
+// Package schema generates JSON Schemas for grafctl's resources so that editors and agents can validate and
+// autocomplete them.
+package schema
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/jlewi/grafctl/api"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Draft is the version of JSON Schema the schemas conform to. Draft 7 is the most widely supported draft
+	// e.g. by the YAML language server used by VS Code.
+	Draft = "http://json-schema.org/draft-07/schema#"
+)
+
+var (
+	queryType    = reflect.TypeOf(api.Query{})
+	paneBodyType = reflect.TypeOf(api.PaneBody{})
+
+	// enums are the allowed values of the string types of the API.
+	enums = map[reflect.Type][]interface{}{
+		reflect.TypeOf(api.ParameterType("")): {api.ParameterTypeString, api.ParameterTypeEnum, api.ParameterTypeInt, api.ParameterTypeDuration},
+		reflect.TypeOf(api.PatchType("")):     {api.MergePatchType, api.StrategicPatchType},
+	}
+
+	// durationPattern matches durations using Grafana's units e.g. 30s, 5m, 1h30m or 7d.
+	durationPattern = `^(\d+(ms|s|m|h|d|w|y))+$`
+)
+
+// Schema is a JSON Schema.
+// https://json-schema.org/draft-07/json-schema-release-notes
+type Schema struct {
+	Schema      string             `json:"$schema,omitempty"`
+	Title       string             `json:"title,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	// AdditionalProperties is either a bool or a *Schema.
+	AdditionalProperties interface{}   `json:"additionalProperties,omitempty"`
+	Items                *Schema       `json:"items,omitempty"`
+	Enum                 []interface{} `json:"enum,omitempty"`
+	Const                interface{}   `json:"const,omitempty"`
+	Pattern              string        `json:"pattern,omitempty"`
+	Default              interface{}   `json:"default,omitempty"`
+}
+
+// Kinds returns the kinds of resources there are schemas for.
+func Kinds() []string {
+	return []string{api.LinkGVK.Kind, api.BundleGVK.Kind, api.PatchGVK.Kind}
+}
+
+// ForKind returns the schema for the kind of resource.
+func ForKind(kind string) (*Schema, error) {
+	g, err := newGenerator()
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case api.LinkGVK.Kind:
+		return g.resource(reflect.TypeOf(api.GrafanaLink{}), kind, true, "metadata", "baseURL"), nil
+	case api.BundleGVK.Kind:
+		return g.resource(reflect.TypeOf(api.LinkBundle{}), kind, true, "metadata", "templates"), nil
+	case api.PatchGVK.Kind:
+		return g.patch(), nil
+	}
+	return nil, errors.Errorf("Unknown kind %v; kind must be one of %v", kind, Kinds())
+}
+
+// ForTemplate returns the schema for patches of the template. The schema only allows the template's parameters
+// and, for the queries of Explore links, the fields of the template's queries.
+func ForTemplate(link *api.GrafanaLink) (*Schema, error) {
+	g, err := newGenerator()
+	if err != nil {
+		return nil, err
+	}
+
+	s := g.patch()
+	s.Title = fmt.Sprintf("%v for %v", api.PatchGVK.Kind, link.Metadata.Name)
+	if link.Description != "" {
+		s.Description = link.Description
+	}
+	s.Properties["template"].Const = link.Metadata.Name
+
+	if link.Dashboard != nil {
+		for _, k := range []string{"pane", "refId", "query", "targets", "panes", "patchType"} {
+			delete(s.Properties, k)
+		}
+	} else {
+		delete(s.Properties, "variables")
+		paneIDs := make([]interface{}, 0, len(link.Panes))
+		for _, id := range sortedKeys(link.Panes) {
+			paneIDs = append(paneIDs, id)
+		}
+		s.Properties["pane"].Enum = paneIDs
+		s.Properties["targets"].Items.Properties["pane"].Enum = paneIDs
+		s.Properties["panes"].Properties = map[string]*Schema{}
+		for _, id := range sortedKeys(link.Panes) {
+			s.Properties["panes"].Properties[id] = s.Properties["panes"].AdditionalProperties.(*Schema)
+		}
+		s.Properties["panes"].AdditionalProperties = false
+
+		// Restrict the fields of queries to the typed fields and the fields of the template's queries.
+		query := s.Properties["query"]
+		for _, id := range sortedKeys(link.Panes) {
+			for _, q := range link.Panes[id].Queries {
+				for k := range q.AdditionalFields {
+					query.Properties[k] = &Schema{}
+				}
+			}
+		}
+		query.AdditionalProperties = false
+	}
+
+	g.setParams(s, link.Parameters, nil)
+	return s, nil
+}
+
+// ForBundle returns the schema for patches of the bundle. links are the templates of the bundle.
+func ForBundle(bundle *api.LinkBundle, links []*api.GrafanaLink) (*Schema, error) {
+	g, err := newGenerator()
+	if err != nil {
+		return nil, err
+	}
+
+	s := g.patch()
+	s.Title = fmt.Sprintf("%v for %v", api.PatchGVK.Kind, bundle.Metadata.Name)
+	if bundle.Description != "" {
+		s.Description = bundle.Description
+	}
+	s.Properties["template"].Const = bundle.Metadata.Name
+	delete(s.Properties, "variables")
+
+	params := []api.Parameter{}
+	seen := map[string]bool{}
+	set := map[string]bool{}
+	for _, t := range bundle.Templates {
+		for name := range t.Params {
+			set[name] = true
+		}
+	}
+	for _, link := range links {
+		for _, p := range link.Parameters {
+			if seen[p.Name] {
+				continue
+			}
+			seen[p.Name] = true
+			params = append(params, p)
+		}
+	}
+	g.setParams(s, params, set)
+	return s, nil
+}
+
+// setParams sets the schema of the params of the patch to the parameters. Parameters without defaults are
+// required unless they are in set.
+func (g *generator) setParams(s *Schema, params []api.Parameter, set map[string]bool) {
+	ps := paramsSchema(params, set)
+	ps.Description = s.Properties["params"].Description
+	s.Properties["params"] = ps
+	if len(ps.Required) > 0 {
+		s.Required = append(s.Required, "params")
+	}
+}
+
+// ForParams returns the schema of the values of the parameters i.e. of the params of a patch. Parameters without
+// defaults are required.
+func ForParams(params []api.Parameter) *Schema {
+	return paramsSchema(params, nil)
+}
+
+// paramsSchema returns the schema of the values of the parameters. Parameters without defaults are required unless
+// they are in set.
+func paramsSchema(params []api.Parameter, set map[string]bool) *Schema {
+	ps := &Schema{
+		Type:                 "object",
+		Properties:           map[string]*Schema{},
+		AdditionalProperties: false,
+	}
+	for _, p := range params {
+		ps.Properties[p.Name] = paramSchema(p)
+		if p.Default == nil && !set[p.Name] {
+			ps.Required = append(ps.Required, p.Name)
+		}
+	}
+	sort.Strings(ps.Required)
+	return ps
+}
+
+// paramSchema returns the schema of the value of the parameter.
+func paramSchema(p api.Parameter) *Schema {
+	s := &Schema{
+		Description: p.Description,
+		Default:     p.Default,
+	}
+	switch p.Type {
+	case api.ParameterTypeEnum:
+		s.Type = "string"
+		for _, v := range p.Values {
+			s.Enum = append(s.Enum, v)
+		}
+	case api.ParameterTypeInt:
+		s.Type = "integer"
+	case api.ParameterTypeDuration:
+		s.Type = "string"
+		s.Pattern = durationPattern
+	default:
+		s.Type = "string"
+	}
+	return s
+}
+
+// generator generates schemas for Go types using their YAML field names and doc comments.
+type generator struct {
+	// docs maps the names of types to their doc comments.
+	docs map[string]string
+	// fieldDocs maps the names of types to the doc comments of their fields.
+	fieldDocs map[string]map[string]string
+}
+
+func newGenerator() (*generator, error) {
+	g := &generator{
+		docs:      map[string]string{},
+		fieldDocs: map[string]map[string]string{},
+	}
+	files, err := fs.Glob(api.Sources, "*.go")
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to list the API sources")
+	}
+	fset := token.NewFileSet()
+	for _, name := range files {
+		src, err := fs.ReadFile(api.Sources, name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to read API source %v", name)
+		}
+		f, err := parser.ParseFile(fset, name, src, parser.ParseComments)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse API source %v", name)
+		}
+		g.addDocs(f)
+	}
+	return g, nil
+}
+
+func (g *generator) addDocs(f *ast.File) {
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			doc := ts.Doc
+			if doc == nil && len(gen.Specs) == 1 {
+				doc = gen.Doc
+			}
+			g.docs[ts.Name.Name] = docText(doc)
+
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+			fields := map[string]string{}
+			for _, field := range st.Fields.List {
+				for _, n := range field.Names {
+					fields[n.Name] = docText(field.Doc)
+				}
+			}
+			g.fieldDocs[ts.Name.Name] = fields
+		}
+	}
+}
+
+// docText converts a doc comment into a single paragraph.
+func docText(doc *ast.CommentGroup) string {
+	if doc == nil {
+		return ""
+	}
+	lines := strings.Split(strings.TrimSpace(doc.Text()), "\n")
+	kept := make([]string, 0, len(lines))
+	for _, l := range lines {
+		l = strings.TrimSpace(l)
+		// Drop notes to the maintainers.
+		if l == "" || strings.HasPrefix(l, "TODO") || strings.HasPrefix(l, "N.B.") {
+			continue
+		}
+		kept = append(kept, l)
+	}
+	return strings.Join(kept, " ")
+}
+
+// resource returns the schema for a resource with apiVersion and kind.
+func (g *generator) resource(t reflect.Type, kind string, requireKind bool, required ...string) *Schema {
+	s := g.forType(t)
+	s.Schema = Draft
+	s.Title = kind
+	s.Properties["apiVersion"].Const = api.LinkGVK.GroupVersion().String()
+	s.Properties["kind"].Const = kind
+	if requireKind {
+		s.Required = append([]string{"apiVersion", "kind"}, required...)
+	} else {
+		s.Required = required
+	}
+	return s
+}
+
+// patch returns the schema for a PanePatch. The queries of a patch have the fields of api.Query.
+func (g *generator) patch() *Schema {
+	s := g.resource(reflect.TypeOf(api.PanePatch{}), api.PatchGVK.Kind, false, "template")
+	query := func(description string) *Schema {
+		q := g.forType(queryType)
+		q.Description = description
+		q.Properties["$patch"] = patchDirective()
+		return q
+	}
+	s.Properties["query"] = query(s.Properties["query"].Description)
+	targets := s.Properties["targets"].Items
+	targets.Properties["query"] = query(targets.Properties["query"].Description)
+
+	s.Properties["operations"].Items.Properties["op"].Enum = []interface{}{"add", "remove", "replace", "move", "copy", "test"}
+
+	pane := g.forType(paneBodyType)
+	pane.Properties["$patch"] = patchDirective()
+	pane.Properties["queries"].Items = query(g.docs[queryType.Name()])
+	s.Properties["panes"].AdditionalProperties = pane
+	return s
+}
+
+// patchDirective is the schema of the $patch directive of a strategic merge patch.
+func patchDirective() *Schema {
+	return &Schema{
+		Type:        "string",
+		Description: "A strategic merge patch directive; delete removes the object and replace replaces it rather than merging it.",
+		Enum:        []interface{}{"delete", "replace"},
+	}
+}
+
+// forType returns the schema for values of type t.
+func (g *generator) forType(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if values, ok := enums[t]; ok {
+		return &Schema{Type: "string", Enum: values}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		s := &Schema{
+			Type:        "object",
+			Description: g.docs[t.Name()],
+			Properties:  map[string]*Schema{},
+		}
+		// Queries can have fields specific to the datasource.
+		if t == queryType {
+			s.AdditionalProperties = true
+		} else {
+			s.AdditionalProperties = false
+		}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, ok := fieldName(f)
+			if !ok {
+				continue
+			}
+			fs := g.forType(f.Type)
+			if doc := g.fieldDocs[t.Name()][f.Name]; doc != "" {
+				fs.Description = doc
+			}
+			s.Properties[name] = fs
+			if isRequired(f) {
+				s.Required = append(s.Required, name)
+			}
+		}
+		return s
+	case reflect.Map:
+		s := &Schema{Type: "object"}
+		if t.Elem().Kind() == reflect.Interface {
+			s.AdditionalProperties = true
+		} else {
+			s.AdditionalProperties = g.forType(t.Elem())
+		}
+		return s
+	case reflect.Slice:
+		return &Schema{Type: "array", Items: g.forType(t.Elem())}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	}
+	// interface{} fields can have any value.
+	return &Schema{}
+}
+
+// fieldName returns the YAML name of the field. It returns false if the field isn't serialized.
+func fieldName(f reflect.StructField) (string, bool) {
+	if !f.IsExported() {
+		return "", false
+	}
+	name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+	if name == "-" {
+		return "", false
+	}
+	if name == "" {
+		name = strings.ToLower(f.Name)
+	}
+	return name, true
+}
+
+// isRequired returns true if the field of a nested object is required. Fields of nested objects are required if
+// they are strings or lists that aren't omitted when empty e.g. the name of a parameter.
+func isRequired(f reflect.StructField) bool {
+	tag := f.Tag.Get("yaml")
+	if tag == "" || strings.Contains(tag, "omitempty") {
+		return false
+	}
+	switch f.Type.Kind() {
+	case reflect.String, reflect.Slice:
+		return true
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,157 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/grafctl/api"
+)
+
+func Test_ForKind(t *testing.T) {
+	type testCase struct {
+		kind        string
+		required    []string
+		property    string
+		description string
+	}
+
+	cases := []testCase{
+		{
+			kind:        api.LinkGVK.Kind,
+			required:    []string{"apiVersion", "kind", "metadata", "baseURL"},
+			property:    "baseURL",
+			description: "BaseURL is the base URL for links generated from this template",
+		},
+		{
+			kind:        api.BundleGVK.Kind,
+			required:    []string{"apiVersion", "kind", "metadata", "templates"},
+			property:    "templates",
+			description: "Templates are the templates to combine. Explore displays the panes in the order of their IDs.",
+		},
+		{
+			kind:        api.PatchGVK.Kind,
+			required:    []string{"template"},
+			property:    "template",
+			description: "Template is the name of the template to apply the patch to",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.kind, func(t *testing.T) {
+			s, err := ForKind(c.kind)
+			if err != nil {
+				t.Fatalf("Failed to generate schema: %v", err)
+			}
+			if d := cmp.Diff(c.required, s.Required); d != "" {
+				t.Errorf("Unexpected required fields:\n%v", d)
+			}
+			if d := cmp.Diff(c.description, s.Properties[c.property].Description); d != "" {
+				t.Errorf("Unexpected description:\n%v", d)
+			}
+			if s.Properties["kind"].Const != c.kind {
+				t.Errorf("Expected kind to be %v but got %v", c.kind, s.Properties["kind"].Const)
+			}
+			if _, err := json.Marshal(s); err != nil {
+				t.Errorf("Failed to marshal schema: %v", err)
+			}
+		})
+	}
+
+	if _, err := ForKind("Dashboard"); err == nil {
+		t.Errorf("Expected an error for an unknown kind")
+	}
+}
+
+func Test_ForTemplate(t *testing.T) {
+	link := &api.GrafanaLink{
+		Metadata: api.Metadata{Name: "logs"},
+		Parameters: []api.Parameter{
+			{Name: "service", Description: "The service"},
+			{Name: "level", Type: api.ParameterTypeEnum, Values: []string{"info", "error"}, Default: "info"},
+			{Name: "limit", Type: api.ParameterTypeInt, Default: 100},
+			{Name: "window", Type: api.ParameterTypeDuration, Default: "5m"},
+		},
+		Panes: api.Panes{
+			"eja": api.PaneBody{
+				Queries: []api.Query{
+					{RefID: "A", AdditionalFields: map[string]interface{}{"customarg": "value"}},
+				},
+			},
+		},
+	}
+
+	s, err := ForTemplate(link)
+	if err != nil {
+		t.Fatalf("Failed to generate schema: %v", err)
+	}
+
+	expected := &Schema{
+		Type:        "object",
+		Description: "Params are the values of the parameters declared by the template.",
+		Properties: map[string]*Schema{
+			"service": {Type: "string", Description: "The service"},
+			"level":   {Type: "string", Enum: []interface{}{"info", "error"}, Default: "info"},
+			"limit":   {Type: "integer", Default: 100},
+			"window":  {Type: "string", Pattern: durationPattern, Default: "5m"},
+		},
+		Required:             []string{"service"},
+		AdditionalProperties: false,
+	}
+	if d := cmp.Diff(expected, s.Properties["params"]); d != "" {
+		t.Errorf("Unexpected params schema:\n%v", d)
+	}
+	if d := cmp.Diff([]string{"template", "params"}, s.Required); d != "" {
+		t.Errorf("Unexpected required fields:\n%v", d)
+	}
+	if s.Properties["template"].Const != "logs" {
+		t.Errorf("Expected template to be logs but got %v", s.Properties["template"].Const)
+	}
+	if d := cmp.Diff([]interface{}{"eja"}, s.Properties["pane"].Enum); d != "" {
+		t.Errorf("Unexpected panes:\n%v", d)
+	}
+
+	query := s.Properties["query"]
+	if query.AdditionalProperties != false {
+		t.Errorf("Expected the query to only allow the fields of the template's queries")
+	}
+	for _, f := range []string{"rawSql", "expr", "customarg", "$patch"} {
+		if _, ok := query.Properties[f]; !ok {
+			t.Errorf("Expected query to have field %v", f)
+		}
+	}
+	if _, ok := s.Properties["variables"]; ok {
+		t.Errorf("Expected variables to be removed from the schema of an Explore link")
+	}
+}
+
+func Test_ForBundle(t *testing.T) {
+	links := []*api.GrafanaLink{
+		{
+			Metadata:   api.Metadata{Name: "logs"},
+			Parameters: []api.Parameter{{Name: "service"}, {Name: "cluster"}},
+		},
+		{
+			Metadata:   api.Metadata{Name: "metrics"},
+			Parameters: []api.Parameter{{Name: "service"}},
+		},
+	}
+	bundle := &api.LinkBundle{
+		Metadata: api.Metadata{Name: "overview"},
+		Templates: []api.BundleTemplate{
+			{Template: "logs", Params: map[string]interface{}{"cluster": "prod"}},
+			{Template: "metrics"},
+		},
+	}
+
+	s, err := ForBundle(bundle, links)
+	if err != nil {
+		t.Fatalf("Failed to generate schema: %v", err)
+	}
+	if d := cmp.Diff([]string{"service"}, s.Properties["params"].Required); d != "" {
+		t.Errorf("Unexpected required params:\n%v", d)
+	}
+	if d := cmp.Diff([]string{"cluster", "service"}, sortedKeys(s.Properties["params"].Properties)); d != "" {
+		t.Errorf("Unexpected params:\n%v", d)
+	}
+}
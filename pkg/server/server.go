@@ -0,0 +1,352 @@
+// Package server exposes building, parsing and validating links over HTTP so that tools don't have to shell out to
+// grafctl for every link.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-logr/zapr"
+	"github.com/jlewi/grafctl/api"
+	"github.com/jlewi/grafctl/pkg/grafana"
+	"github.com/jlewi/grafctl/pkg/validate"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// reloadDelay is how long the server waits after a change to the templates before reloading them so that a burst
+	// of writes (e.g. an editor saving a file) only triggers one reload.
+	reloadDelay = 200 * time.Millisecond
+
+	// maxBodySize is the maximum size of the body of a request.
+	maxBodySize = 1 << 20
+)
+
+// BuildResponse is the response to a request to build a link.
+type BuildResponse struct {
+	// URL is the URL of the link.
+	URL string `json:"url"`
+	// Link is the GrafanaLink the URL was built from.
+	Link *api.GrafanaLink `json:"link"`
+}
+
+// ParseRequest is a request to convert a URL to a GrafanaLink.
+type ParseRequest struct {
+	// URL is the link to Explore or to a dashboard.
+	URL string `json:"url"`
+	// Name is the name to give the GrafanaLink.
+	Name string `json:"name,omitempty"`
+}
+
+// ParseResponse is the response to a request to parse a URL.
+type ParseResponse struct {
+	Link *api.GrafanaLink `json:"link"`
+}
+
+// TemplatesResponse lists the templates the server builds links from.
+type TemplatesResponse struct {
+	Links   []*api.GrafanaLink `json:"links"`
+	Bundles []*api.LinkBundle  `json:"bundles"`
+}
+
+// ValidateResponse lists the problems found in the resources in a request to validate resources.
+type ValidateResponse struct {
+	Errors []validate.Error `json:"errors"`
+}
+
+// ErrorResponse is the body of responses to requests that failed.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Server serves the API. The templates are loaded from Dir when the server is created and reloaded when the files
+// in Dir change.
+type Server struct {
+	// Dir is the directory containing the GrafanaLinks and LinkBundles.
+	Dir     string
+	patcher *grafana.Patcher
+
+	mu      sync.RWMutex
+	links   []*api.GrafanaLink
+	bundles []*api.LinkBundle
+}
+
+// NewServer creates a server that builds links from the templates in dir using the patcher.
+func NewServer(dir string, patcher *grafana.Patcher) (*Server, error) {
+	if patcher == nil {
+		return nil, errors.New("Patcher must be set to create a server")
+	}
+	s := &Server{
+		Dir:     dir,
+		patcher: patcher,
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload loads the templates in the directory. The templates in use are only replaced if they are loaded
+// successfully.
+func (s *Server) Reload() error {
+	links, err := grafana.LoadGrafanaLinksInDir(s.Dir)
+	if err != nil {
+		return errors.Wrapf(err, "Error loading Grafana links from %v", s.Dir)
+	}
+	bundles, err := grafana.LoadLinkBundlesInDir(s.Dir)
+	if err != nil {
+		return errors.Wrapf(err, "Error loading link bundles from %v", s.Dir)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.links = links
+	s.bundles = bundles
+	return nil
+}
+
+// templates returns the templates currently in use. The slices must not be modified.
+func (s *Server) templates() ([]*api.GrafanaLink, []*api.LinkBundle) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.links, s.bundles
+}
+
+// Handler returns the handler for the API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.healthz)
+	mux.HandleFunc("GET /api/v1/templates", s.listTemplates)
+	mux.HandleFunc("POST /api/v1/links/build", s.build)
+	mux.HandleFunc("POST /api/v1/links/parse", s.parse)
+	mux.HandleFunc("POST /api/v1/validate", s.validate)
+	return logRequests(mux)
+}
+
+// Run serves the API on addr and reloads the templates when they change. It blocks until ctx is cancelled and then
+// shuts the server down.
+func (s *Server) Run(ctx context.Context, addr string) error {
+	log := zapr.NewLogger(zap.L())
+
+	watcher, err := s.watch(ctx)
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: s.Handler(),
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		log.Info("Starting server", "address", addr, "dir", s.Dir)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return errors.Wrapf(err, "Server failed")
+	case <-ctx.Done():
+	}
+
+	log.Info("Shutting down server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+// watch watches the directory and its subdirectories and reloads the templates when YAML files change.
+func (s *Server) watch(ctx context.Context) (*fsnotify.Watcher, error) {
+	log := zapr.NewLogger(zap.L())
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to create a watcher for %v", s.Dir)
+	}
+
+	err = filepath.WalkDir(s.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return watcher.Add(path)
+		}
+		return nil
+	})
+	if err != nil {
+		watcher.Close()
+		return nil, errors.Wrapf(err, "Failed to watch %v", s.Dir)
+	}
+
+	go func() {
+		var timer *time.Timer
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Has(fsnotify.Create) {
+					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+						if err := watcher.Add(event.Name); err != nil {
+							log.Error(err, "Failed to watch directory", "dir", event.Name)
+						}
+						continue
+					}
+				}
+				if !isYAMLFile(event.Name) {
+					continue
+				}
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(reloadDelay, func() {
+					if err := s.Reload(); err != nil {
+						log.Error(err, "Failed to reload templates", "dir", s.Dir)
+						return
+					}
+					log.Info("Reloaded templates", "dir", s.Dir)
+				})
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Error(err, "Error watching templates", "dir", s.Dir)
+			}
+		}
+	}()
+	return watcher, nil
+}
+
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) listTemplates(w http.ResponseWriter, r *http.Request) {
+	links, bundles := s.templates()
+	writeJSON(w, http.StatusOK, TemplatesResponse{Links: links, Bundles: bundles})
+}
+
+// build applies the PanePatch in the body of the request to its template and returns the link.
+func (s *Server) build(w http.ResponseWriter, r *http.Request) {
+	patch := api.PanePatch{}
+	if err := readJSON(r, &patch); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := grafana.UpgradePatch(&patch); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	links, bundles := s.templates()
+	link, err := s.patcher.ApplyTemplatePatch(links, bundles, patch)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.Wrapf(err, "Error applying patch"))
+		return
+	}
+	u, err := grafana.LinkToURL(*link)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, BuildResponse{URL: u, Link: link})
+}
+
+// parse converts the URL in the request to a GrafanaLink.
+func (s *Server) parse(w http.ResponseWriter, r *http.Request) {
+	req := ParseRequest{}
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.URL == "" {
+		writeError(w, http.StatusBadRequest, errors.New("url must be set"))
+		return
+	}
+	link, err := grafana.URLToLink(req.URL)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.Wrapf(err, "Error parsing URL"))
+		return
+	}
+	link.Metadata.Name = req.Name
+	writeJSON(w, http.StatusOK, ParseResponse{Link: link})
+}
+
+// validate validates the resources in the body of the request. The body is YAML or JSON and can contain several
+// YAML documents. Patches are validated against the server's templates.
+func (s *Server) validate(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.Wrapf(err, "Failed to read request"))
+		return
+	}
+	links, bundles := s.templates()
+	v := &validate.Validator{Templates: links, Bundles: bundles}
+	errs := v.Validate("request", data)
+	if errs == nil {
+		errs = []validate.Error{}
+	}
+	writeJSON(w, http.StatusOK, ValidateResponse{Errors: errs})
+}
+
+func readJSON(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxBodySize))
+	if err := decoder.Decode(v); err != nil {
+		return errors.Wrapf(err, "Failed to decode the JSON in the request")
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log := zapr.NewLogger(zap.L())
+		log.Error(err, "Failed to write response")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, ErrorResponse{Error: err.Error()})
+}
+
+func isYAMLFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// statusRecorder records the status code of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests logs every request and its outcome.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := zapr.NewLogger(zap.L())
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		log.Info("Handled request", "method", r.Method, "path", r.URL.Path, "status", rec.status, "duration", time.Since(start).String())
+	})
+}
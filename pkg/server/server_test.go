@@ -0,0 +1,188 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/grafctl/pkg/grafana"
+	"github.com/jlewi/grafctl/pkg/validate"
+)
+
+const testLink = `apiVersion: grafctl.foyle.io/v1alpha2
+kind: GrafanaLink
+metadata:
+  name: logs
+baseURL: https://grafana.acme.com
+parameters:
+  - name: app
+    label: app
+panes:
+  a:
+    datasource: loki
+    queries:
+      - refId: A
+        datasource:
+          type: loki
+          uid: loki
+        expr: '{env="prod"}'
+    range:
+      from: now-1h
+      to: now
+`
+
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "logs.yaml"), []byte(testLink), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	s, err := NewServer(dir, grafana.NewPatcher(grafana.RealClock{}))
+	if err != nil {
+		t.Fatalf("Failed to create server: %+v", err)
+	}
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+func post(t *testing.T, u string, body string, out interface{}) int {
+	resp, err := http.Post(u, "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("Request to %v failed: %v", u, err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return resp.StatusCode
+}
+
+func Test_Build(t *testing.T) {
+	type testCase struct {
+		name     string
+		patch    string
+		status   int
+		contains string
+	}
+
+	cases := []testCase{
+		{
+			name:     "basic",
+			patch:    `{"template": "logs", "params": {"app": "foyle"}, "fixTime": false}`,
+			status:   http.StatusOK,
+			contains: `app%3D%5C%22foyle%5C%22`,
+		},
+		{
+			// Building the same template again checks that the loaded templates aren't modified by patches.
+			name:     "again",
+			patch:    `{"template": "logs", "params": {"app": "grafctl"}, "fixTime": false}`,
+			status:   http.StatusOK,
+			contains: `app%3D%5C%22grafctl%5C%22`,
+		},
+		{
+			name:     "unknown-template",
+			patch:    `{"template": "metrics", "fixTime": false}`,
+			status:   http.StatusBadRequest,
+			contains: "no template metrics",
+		},
+		{
+			name:     "invalid-json",
+			patch:    `{"template": `,
+			status:   http.StatusBadRequest,
+			contains: "Failed to decode",
+		},
+	}
+
+	_, ts := newTestServer(t)
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var resp map[string]interface{}
+			status := post(t, ts.URL+"/api/v1/links/build", c.patch, &resp)
+			if status != c.status {
+				t.Fatalf("Got status %v; want %v; response %v", status, c.status, resp)
+			}
+			got := resp["url"]
+			if status != http.StatusOK {
+				got = resp["error"]
+			}
+			if !strings.Contains(got.(string), c.contains) {
+				t.Errorf("Response %v doesn't contain %v", got, c.contains)
+			}
+		})
+	}
+}
+
+func Test_Parse(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	resp := ParseResponse{}
+	status := post(t, ts.URL+"/api/v1/links/parse", `{"url": "https://grafana.acme.com/d/abc123/service?orgId=2", "name": "service"}`, &resp)
+	if status != http.StatusOK {
+		t.Fatalf("Got status %v; want %v", status, http.StatusOK)
+	}
+	if resp.Link.Metadata.Name != "service" || resp.Link.OrgID != "2" || resp.Link.Dashboard.UID != "abc123" {
+		t.Errorf("Unexpected link %+v", resp.Link)
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	resp := ValidateResponse{}
+	status := post(t, ts.URL+"/api/v1/validate", "template: logs\nparams:\n  ap: foyle\n", &resp)
+	if status != http.StatusOK {
+		t.Fatalf("Got status %v; want %v", status, http.StatusOK)
+	}
+	expected := []validate.Error{
+		{File: "request", Line: 3, Column: 3, Message: "Unknown parameter ap; the template's parameters are [app]"},
+	}
+	if d := cmp.Diff(expected, resp.Errors); d != "" {
+		t.Errorf("Unexpected diff:\n%v", d)
+	}
+}
+
+func Test_Reload(t *testing.T) {
+	s, ts := newTestServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watcher, err := s.watch(ctx)
+	if err != nil {
+		t.Fatalf("Failed to watch templates: %+v", err)
+	}
+	defer watcher.Close()
+
+	metrics := strings.Replace(testLink, "name: logs", "name: metrics", 1)
+	if err := os.WriteFile(filepath.Join(s.Dir, "metrics.yaml"), []byte(metrics), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get(ts.URL + "/api/v1/templates")
+		if err != nil {
+			t.Fatalf("Failed to list templates: %v", err)
+		}
+		templates := TemplatesResponse{}
+		err = json.NewDecoder(resp.Body).Decode(&templates)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(templates.Links) == 2 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Templates weren't reloaded; got %v links", len(templates.Links))
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
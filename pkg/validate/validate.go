@@ -0,0 +1,729 @@
+// Package validate checks GrafanaLink, LinkBundle and PanePatch resources for mistakes that would otherwise
+// silently produce the wrong link, e.g. a typo in the name of a field of a query.
+package validate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/jlewi/grafctl/api"
+	"github.com/jlewi/grafctl/pkg/grafana"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	queryType      = reflect.TypeOf(api.Query{})
+	paneBodyType   = reflect.TypeOf(api.PaneBody{})
+	operationOps   = []string{"add", "remove", "replace", "move", "copy", "test"}
+	patchTypes     = []api.PatchType{api.MergePatchType, api.StrategicPatchType}
+	patchDirective = "$patch"
+)
+
+// Error is a problem with a resource. Line and Column are the 1-based position of the problem in File.
+type Error struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("%v:%v:%v: %v", e.File, e.Line, e.Column, e.Message)
+}
+
+// Validator validates resources.
+type Validator struct {
+	// Templates are the GrafanaLinks that patches are validated against. If there are no templates or bundles the
+	// checks that depend on the template of a patch are skipped.
+	Templates []*api.GrafanaLink
+	// Bundles are the LinkBundles that patches are validated against.
+	Bundles []*api.LinkBundle
+	// SkipUnknownKinds skips documents that aren't GrafanaLinks, LinkBundles or patches rather than reporting
+	// them as errors; e.g. when validating a directory that contains other resources.
+	SkipUnknownKinds bool
+}
+
+// ValidateFile validates all the documents in the YAML file. The returned error is only set if the file
+// couldn't be read.
+func (v *Validator) ValidateFile(path string) ([]Error, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read file %v", path)
+	}
+	return v.Validate(path, data), nil
+}
+
+// Validate validates all the documents in data. file is the name used in errors.
+func (v *Validator) Validate(file string, data []byte) []Error {
+	d := &docValidator{v: v, file: file}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		doc := &yaml.Node{}
+		err := decoder.Decode(doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			d.errs = append(d.errs, Error{File: file, Line: 1, Column: 1, Message: fmt.Sprintf("Invalid YAML: %v", err)})
+			break
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		d.validateDocument(doc.Content[0])
+	}
+	return d.errs
+}
+
+// docValidator accumulates the errors found in the documents of a file.
+type docValidator struct {
+	v    *Validator
+	file string
+	errs []Error
+	// inPatch is true while validating a patch; patches can use $patch directives.
+	inPatch bool
+	// queryFields are the values of the additional fields of the template's queries keyed by the name of the field.
+	// Queries can only have typed fields and the template's additional fields; nil allows any field.
+	queryFields map[string][]interface{}
+}
+
+func (d *docValidator) errorf(n *yaml.Node, format string, args ...interface{}) {
+	d.errs = append(d.errs, Error{File: d.file, Line: n.Line, Column: n.Column, Message: fmt.Sprintf(format, args...)})
+}
+
+func (d *docValidator) validateDocument(n *yaml.Node) {
+	if n.Kind != yaml.MappingNode {
+		d.errorf(n, "A resource must be a YAML object")
+		return
+	}
+
+	kind := scalar(lookup(n, "kind"))
+	switch {
+	case kind == api.LinkGVK.Kind:
+		d.checkAPIVersion(n, true)
+		d.validateLink(n)
+	case kind == api.BundleGVK.Kind:
+		d.checkAPIVersion(n, true)
+		d.validateBundle(n)
+	// Patches usually omit the kind; a document without a kind that sets template or bases is treated as a patch.
+	case kind == api.PatchGVK.Kind || (kind == "" && (lookup(n, "template") != nil || lookup(n, "bases") != nil)):
+		d.checkAPIVersion(n, false)
+		d.validatePatch(n)
+	case d.v.SkipUnknownKinds:
+	case kind == "":
+		d.errorf(n, "Unknown resource; set kind to one of %v or set template for a patch", []string{api.LinkGVK.Kind, api.BundleGVK.Kind, api.PatchGVK.Kind})
+	default:
+		d.errorf(lookup(n, "kind"), "Unknown kind %v; kind must be one of %v", kind, []string{api.LinkGVK.Kind, api.BundleGVK.Kind, api.PatchGVK.Kind})
+	}
+}
+
+// checkAPIVersion checks the apiVersion of the resource. If required is false apiVersion can be omitted.
+func (d *docValidator) checkAPIVersion(n *yaml.Node, required bool) {
+	expected := api.LinkGVK.GroupVersion().String()
+	v := lookup(n, "apiVersion")
+	if v == nil {
+		if required {
+			d.errorf(n, "apiVersion is required; set it to %v", expected)
+		}
+		return
+	}
+	for _, supported := range grafana.SupportedVersions() {
+		if v.Value == supported {
+			return
+		}
+	}
+	d.errorf(v, "Unsupported apiVersion %v; apiVersion must be one of %v", v.Value, grafana.SupportedVersions())
+}
+
+func (d *docValidator) validateLink(n *yaml.Node) {
+	d.inPatch = false
+	d.queryFields = nil
+	d.checkFields(n, reflect.TypeOf(api.GrafanaLink{}))
+
+	link, err := grafana.DecodeGrafanaLink(n)
+	if err != nil {
+		// Unsupported apiVersions are reported by checkAPIVersion; check the rest of the link using the current
+		// version.
+		link = &api.GrafanaLink{}
+		if !d.decode(n, link) {
+			return
+		}
+	}
+
+	if link.Metadata.Name == "" {
+		d.errorf(nodeOr(lookup(n, "metadata"), n), "metadata.name is required; patches refer to the template by its name")
+	}
+	d.checkBaseURL(n, link.BaseURL)
+
+	switch {
+	case link.Dashboard == nil && len(link.Panes) == 0:
+		d.errorf(n, "Either panes (for an Explore link) or dashboard (for a dashboard link) is required")
+	case link.Dashboard != nil && len(link.Panes) > 0:
+		d.errorf(lookup(n, "dashboard"), "A link can't have both panes and dashboard")
+	case link.Dashboard != nil:
+		dashboard := lookup(n, "dashboard")
+		if link.Dashboard.UID == "" {
+			d.errorf(dashboard, "dashboard.uid is required")
+		}
+		d.checkRange(nodeOr(lookup(dashboard, "range"), dashboard), link.Dashboard.Range)
+	}
+
+	panesNode := lookup(n, "panes")
+	for _, paneID := range sortedKeys(link.Panes) {
+		pane := link.Panes[paneID]
+		paneNode := nodeOr(lookup(panesNode, paneID), panesNode)
+		if len(pane.Queries) == 0 {
+			d.errorf(paneNode, "Pane %v doesn't have any queries", paneID)
+		}
+		queriesNode := lookup(paneNode, "queries")
+		for i, q := range pane.Queries {
+			if q.Datasource.UID == "" && pane.Datasource == "" {
+				d.errorf(nodeOr(item(queriesNode, i), paneNode), "Query %v of pane %v doesn't have a datasource; set datasource.uid on the query or datasource on the pane", i, paneID)
+			}
+		}
+		d.checkRange(nodeOr(lookup(paneNode, "range"), paneNode), pane.Range)
+	}
+
+	d.checkTimeSettings(n, link.Timezone, link.WeekStart)
+	d.checkURLOptions(n, link.Kiosk, link.Theme, []string{api.KioskFull, api.KioskTV})
+
+	paramsNode := lookup(n, "parameters")
+	for i, p := range link.Parameters {
+		pNode := nodeOr(item(paramsNode, i), paramsNode)
+		if err := grafana.CheckParameter(p); err != nil {
+			d.errorf(pNode, "%v", err)
+			continue
+		}
+		if p.Path == "" && p.Label == "" && !p.LineFilter && p.Attribute == "" {
+			continue
+		}
+		if link.Dashboard != nil {
+			d.errorf(pNode, "Parameter %v sets a field of a query but dashboard links don't have queries", p.Name)
+			continue
+		}
+		q, err := findQuery(link, p.Pane, p.RefID)
+		if err != nil {
+			d.errorf(pNode, "Parameter %v: %v", p.Name, err)
+			continue
+		}
+		if p.Path == "" {
+			continue
+		}
+		if err := grafana.CheckQueryPath(q, p.Path); err != nil {
+			d.errorf(nodeOr(lookup(pNode, "path"), pNode), "Parameter %v: %v", p.Name, err)
+		}
+	}
+}
+
+func (d *docValidator) validateBundle(n *yaml.Node) {
+	d.inPatch = false
+	d.queryFields = nil
+	d.checkFields(n, reflect.TypeOf(api.LinkBundle{}))
+
+	bundle := &api.LinkBundle{}
+	if !d.decode(n, bundle) {
+		return
+	}
+
+	if bundle.Metadata.Name == "" {
+		d.errorf(nodeOr(lookup(n, "metadata"), n), "metadata.name is required; patches refer to the bundle by its name")
+	}
+	templatesNode := lookup(n, "templates")
+	if len(bundle.Templates) == 0 {
+		d.errorf(nodeOr(templatesNode, n), "A LinkBundle must have at least one template")
+	}
+	for i, t := range bundle.Templates {
+		tNode := nodeOr(item(templatesNode, i), n)
+		if t.Template == "" {
+			d.errorf(tNode, "template is required")
+			continue
+		}
+		if !d.hasTemplates() {
+			continue
+		}
+		link := d.findLink(t.Template)
+		if link == nil {
+			d.errorf(tNode, "There is no template named %v", t.Template)
+			continue
+		}
+		if link.Dashboard != nil {
+			d.errorf(tNode, "Template %v is a dashboard link; bundles can only combine Explore links", t.Template)
+		}
+	}
+}
+
+func (d *docValidator) validatePatch(n *yaml.Node) {
+	d.inPatch = true
+	d.queryFields = nil
+	d.checkFields(n, reflect.TypeOf(api.PanePatch{}))
+
+	patch := &api.PanePatch{}
+	if !d.decode(n, patch) {
+		return
+	}
+
+	templateNode := nodeOr(lookup(n, "template"), n)
+	// An overlay can inherit its template from its bases.
+	if patch.Template == "" && len(patch.Bases) == 0 {
+		d.errorf(templateNode, "template is required; set it to the name of the GrafanaLink or LinkBundle to patch")
+	}
+
+	if patch.PatchType != "" && patch.PatchType != api.MergePatchType && patch.PatchType != api.StrategicPatchType {
+		d.errorf(lookup(n, "patchType"), "Unknown patchType %v; patchType must be one of %v", patch.PatchType, patchTypes)
+	}
+
+	opsNode := lookup(n, "operations")
+	for i, op := range patch.Operations {
+		opNode := nodeOr(item(opsNode, i), opsNode)
+		if !contains(operationOps, op.Op) {
+			d.errorf(opNode, "Unknown op %v; op must be one of %v", op.Op, operationOps)
+		}
+		if !strings.HasPrefix(op.Path, "/") {
+			d.errorf(opNode, "Invalid path %v; path must be a JSON pointer e.g. /panes/<pane>/queries/0/expr", op.Path)
+		}
+	}
+
+	inheritsRange := len(patch.Bases) > 0 && patch.Range.From == "" && patch.Range.To == ""
+	if !inheritsRange && (patch.FixTime == nil || *patch.FixTime || patch.Range.From != "" || patch.Range.To != "") {
+		d.checkRange(nodeOr(lookup(n, "range"), n), patch.Range)
+	}
+	d.checkTimeSettings(n, patch.Timezone, patch.WeekStart)
+	d.checkURLOptions(n, patch.Kiosk, patch.Theme, []string{api.KioskFull, api.KioskTV, api.KioskOff})
+
+	if patch.Template == "" || !d.hasTemplates() {
+		return
+	}
+
+	links := []*api.GrafanaLink{}
+	if bundle := d.findBundle(patch.Template); bundle != nil {
+		for _, t := range bundle.Templates {
+			if link := d.findLink(t.Template); link != nil {
+				links = append(links, link)
+			}
+		}
+	} else if link := d.findLink(patch.Template); link != nil {
+		links = append(links, link)
+		d.checkPatchAgainstLink(n, patch, link)
+	} else {
+		d.errorf(templateNode, "There is no template or bundle named %v", patch.Template)
+		return
+	}
+
+	// Check the queries in the patch against the fields of the template's queries.
+	d.queryFields = map[string][]interface{}{}
+	for _, link := range links {
+		for _, pane := range link.Panes {
+			for _, q := range pane.Queries {
+				for k := range q.AdditionalFields {
+					d.queryFields[k] = append(d.queryFields[k], q.AdditionalFields[k])
+				}
+			}
+		}
+	}
+	d.checkFields(lookup(n, "query"), queryType)
+	targetsNode := lookup(n, "targets")
+	if targetsNode != nil && targetsNode.Kind == yaml.SequenceNode {
+		for _, t := range targetsNode.Content {
+			d.checkFields(lookup(t, "query"), queryType)
+		}
+	}
+	panesNode := lookup(n, "panes")
+	if panesNode != nil && panesNode.Kind == yaml.MappingNode {
+		for i := 1; i < len(panesNode.Content); i += 2 {
+			d.checkFields(panesNode.Content[i], paneBodyType)
+		}
+	}
+}
+
+// checkPatchAgainstLink checks that the patch applies to the link.
+func (d *docValidator) checkPatchAgainstLink(n *yaml.Node, patch *api.PanePatch, link *api.GrafanaLink) {
+	if _, err := grafana.ResolveParams(link.Parameters, patch.Params); err != nil {
+		d.errorf(nodeOr(lookup(n, "params"), n), "%v", err)
+	}
+
+	if link.Dashboard != nil {
+		if patch.Query != nil || len(patch.Targets) > 0 || len(patch.Panes) > 0 {
+			d.errorf(n, "Template %v is a dashboard link; use variables rather than query, targets or panes", link.Metadata.Name)
+		}
+		return
+	}
+	if len(patch.Variables) > 0 {
+		d.errorf(lookup(n, "variables"), "Template %v is an Explore link; variables only apply to dashboard links", link.Metadata.Name)
+	}
+
+	if patch.Query != nil {
+		if err := checkQueryExists(link, patch.Pane, patch.RefID); err != nil {
+			d.errorf(lookup(n, "query"), "%v", err)
+		}
+	}
+	targetsNode := lookup(n, "targets")
+	for i, t := range patch.Targets {
+		if err := checkQueryExists(link, t.Pane, t.RefID); err != nil {
+			d.errorf(nodeOr(item(targetsNode, i), targetsNode), "%v", err)
+		}
+	}
+	panesNode := lookup(n, "panes")
+	for paneID := range patch.Panes {
+		if _, ok := link.Panes[paneID]; !ok {
+			d.errorf(nodeOr(keyNode(panesNode, paneID), panesNode), "Template %v doesn't have a pane with ID %v", link.Metadata.Name, paneID)
+		}
+	}
+}
+
+// checkQueryExists checks that the link has the query selected by paneID and refID.
+func checkQueryExists(link *api.GrafanaLink, paneID string, refID string) error {
+	_, err := findQuery(link, paneID, refID)
+	return err
+}
+
+// findQuery returns the query of the link selected by paneID and refID.
+func findQuery(link *api.GrafanaLink, paneID string, refID string) (*api.Query, error) {
+	if paneID == "" {
+		if len(link.Panes) != 1 {
+			return nil, errors.Errorf("Template %v has %v panes; set pane to select one of %v", link.Metadata.Name, len(link.Panes), sortedKeys(link.Panes))
+		}
+		for k := range link.Panes {
+			paneID = k
+		}
+	}
+	pane, ok := link.Panes[paneID]
+	if !ok {
+		return nil, errors.Errorf("Template %v doesn't have a pane with ID %v; the panes are %v", link.Metadata.Name, paneID, sortedKeys(link.Panes))
+	}
+	if refID == "" {
+		if len(pane.Queries) != 1 {
+			return nil, errors.Errorf("Pane %v of template %v has %v queries; set refId to select one", paneID, link.Metadata.Name, len(pane.Queries))
+		}
+		return &pane.Queries[0], nil
+	}
+	for i := range pane.Queries {
+		if pane.Queries[i].RefID == refID {
+			return &pane.Queries[i], nil
+		}
+	}
+	return nil, errors.Errorf("Pane %v of template %v doesn't have a query with refId %v", paneID, link.Metadata.Name, refID)
+}
+
+// checkFields reports the keys in n that aren't fields of t.
+func (d *docValidator) checkFields(n *yaml.Node, t reflect.Type) {
+	if n == nil {
+		return
+	}
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if n.Kind != yaml.MappingNode {
+			return
+		}
+		fields := grafana.YAMLFields(t)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			if d.inPatch && key.Value == patchDirective {
+				continue
+			}
+			f, ok := fields[key.Value]
+			if !ok {
+				if t == queryType && d.queryFields == nil {
+					continue
+				}
+				if values, ok := d.queryFields[key.Value]; t == queryType && ok {
+					d.checkShape(value, values, grafana.AdditionalFieldTypes[key.Value])
+					continue
+				}
+				if ft, ok := grafana.AdditionalFieldTypes[key.Value]; t == queryType && ok {
+					d.checkFields(value, ft)
+					continue
+				}
+				d.errorf(key, "Unknown field %v%v", key.Value, grafana.Suggest(key.Value, sortedKeys(fields)))
+				continue
+			}
+			d.checkFields(value, f)
+		}
+	case reflect.Map:
+		if n.Kind != yaml.MappingNode || t.Elem().Kind() == reflect.Interface {
+			return
+		}
+		for i := 1; i < len(n.Content); i += 2 {
+			d.checkFields(n.Content[i], t.Elem())
+		}
+	case reflect.Slice:
+		if n.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, c := range n.Content {
+			d.checkFields(c, t.Elem())
+		}
+	}
+}
+
+// checkShape reports the keys in n that aren't in any of the template's values of the same field; e.g. a typo in
+// the name of a field of the builderOptions of a ClickHouse query. t is the type of the field if it is known;
+// the fields of t are allowed even if the template doesn't use them.
+func (d *docValidator) checkShape(n *yaml.Node, values []interface{}, t reflect.Type) {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch n.Kind {
+	case yaml.MappingNode:
+		fields := map[string][]interface{}{}
+		for _, v := range values {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				// There's nothing to check the object against.
+				return
+			}
+			for k, fv := range m {
+				fields[k] = append(fields[k], fv)
+			}
+		}
+		typed := map[string]reflect.Type{}
+		if t != nil && t.Kind() == reflect.Struct {
+			typed = grafana.YAMLFields(t)
+		}
+
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			if d.inPatch && key.Value == patchDirective {
+				continue
+			}
+			if fv, ok := fields[key.Value]; ok {
+				d.checkShape(value, fv, typed[key.Value])
+				continue
+			}
+			if ft, ok := typed[key.Value]; ok {
+				d.checkFields(value, ft)
+				continue
+			}
+			names := make([]string, 0, len(fields)+len(typed))
+			for k := range fields {
+				names = append(names, k)
+			}
+			for k := range typed {
+				if _, ok := fields[k]; !ok {
+					names = append(names, k)
+				}
+			}
+			d.errorf(key, "Unknown field %v%v", key.Value, grafana.Suggest(key.Value, names))
+		}
+	case yaml.SequenceNode:
+		items := []interface{}{}
+		for _, v := range values {
+			l, ok := v.([]interface{})
+			if !ok {
+				return
+			}
+			items = append(items, l...)
+		}
+		var elem reflect.Type
+		if t != nil && t.Kind() == reflect.Slice {
+			elem = t.Elem()
+		}
+		if len(items) == 0 {
+			if elem != nil {
+				d.checkFields(n, t)
+			}
+			return
+		}
+		for _, c := range n.Content {
+			d.checkShape(c, items, elem)
+		}
+	}
+}
+
+// decode decodes n into out and reports any errors. It returns false if n couldn't be decoded.
+func (d *docValidator) decode(n *yaml.Node, out interface{}) bool {
+	if err := n.Decode(out); err != nil {
+		d.errorf(n, "%v", err)
+		return false
+	}
+	return true
+}
+
+func (d *docValidator) checkBaseURL(n *yaml.Node, baseURL string) {
+	node := nodeOr(lookup(n, "baseURL"), n)
+	if baseURL == "" {
+		d.errorf(node, "baseURL is required")
+		return
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		d.errorf(node, "Invalid baseURL %v; baseURL must be an absolute URL e.g. https://grafana.acme.com", baseURL)
+	}
+}
+
+func (d *docValidator) checkRange(n *yaml.Node, r api.TimeRange) {
+	p := grafana.NewRelativeTimeParser()
+	if r.From == "" && r.To == "" {
+		return
+	}
+	for _, field := range []struct {
+		name  string
+		value string
+	}{{"from", r.From}, {"to", r.To}} {
+		node := nodeOr(lookup(n, field.name), n)
+		if field.value == "" {
+			d.errorf(node, "range.%v is required", field.name)
+			continue
+		}
+		if _, err := p.ParseGrafanaTime(field.value, false); err != nil {
+			d.errorf(node, "Invalid time in range.%v: %v", field.name, err)
+		}
+	}
+}
+
+func (d *docValidator) checkTimeSettings(n *yaml.Node, timezone string, weekStart string) {
+	if _, err := grafana.LoadLocation(timezone); err != nil {
+		d.errorf(nodeOr(lookup(n, "timezone"), n), "%v", err)
+	}
+	if _, err := grafana.ParseWeekStart(weekStart); err != nil {
+		d.errorf(nodeOr(lookup(n, "weekStart"), n), "%v", err)
+	}
+}
+
+// checkURLOptions checks the settings stored in the query parameters of links. kioskModes are the allowed values of
+// kiosk.
+func (d *docValidator) checkURLOptions(n *yaml.Node, kiosk string, theme string, kioskModes []string) {
+	if kiosk != "" && !contains(kioskModes, kiosk) {
+		d.errorf(nodeOr(lookup(n, "kiosk"), n), "Invalid kiosk mode %v; kiosk must be one of %v", kiosk, kioskModes)
+	}
+	themes := []string{api.ThemeLight, api.ThemeDark}
+	if theme != "" && !contains(themes, theme) {
+		d.errorf(nodeOr(lookup(n, "theme"), n), "Invalid theme %v; theme must be one of %v", theme, themes)
+	}
+}
+
+func (d *docValidator) hasTemplates() bool {
+	return len(d.v.Templates) > 0 || len(d.v.Bundles) > 0
+}
+
+func (d *docValidator) findLink(name string) *api.GrafanaLink {
+	for _, l := range d.v.Templates {
+		if l.Metadata.Name == name {
+			return l
+		}
+	}
+	return nil
+}
+
+func (d *docValidator) findBundle(name string) *api.LinkBundle {
+	for _, b := range d.v.Bundles {
+		if b.Metadata.Name == name {
+			return b
+		}
+	}
+	return nil
+}
+
+// lookup returns the value of the key in the mapping node or nil if it isn't set.
+func lookup(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// keyNode returns the node of the key in the mapping node or nil if it isn't set.
+func keyNode(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i]
+		}
+	}
+	return nil
+}
+
+// item returns the i'th item of the sequence node or nil.
+func item(n *yaml.Node, i int) *yaml.Node {
+	if n == nil || n.Kind != yaml.SequenceNode || i >= len(n.Content) {
+		return nil
+	}
+	return n.Content[i]
+}
+
+// nodeOr returns n if it isn't nil and fallback otherwise. It's used to report errors at the closest node.
+func nodeOr(n *yaml.Node, fallback *yaml.Node) *yaml.Node {
+	if n != nil {
+		return n
+	}
+	return fallback
+}
+
+func scalar(n *yaml.Node) string {
+	if n == nil {
+		return ""
+	}
+	return n.Value
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// AddTemplates adds the GrafanaLinks and LinkBundles in the file to the templates patches are validated against.
+// Documents that can't be decoded are ignored; Validate reports them.
+func (v *Validator) AddTemplates(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read file %v", path)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		doc := &yaml.Node{}
+		if err := decoder.Decode(doc); err != nil {
+			// Stop at the end of the file or the first invalid document.
+			return nil
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		switch scalar(lookup(doc.Content[0], "kind")) {
+		case api.LinkGVK.Kind:
+			if link, err := grafana.DecodeGrafanaLink(doc.Content[0]); err == nil {
+				v.Templates = append(v.Templates, link)
+			}
+		case api.BundleGVK.Kind:
+			if bundle, err := grafana.DecodeLinkBundle(doc.Content[0]); err == nil {
+				v.Bundles = append(v.Bundles, bundle)
+			}
+		}
+	}
+}
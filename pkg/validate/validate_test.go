@@ -0,0 +1,249 @@
+package validate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testLink = `apiVersion: grafctl.foyle.io/v1alpha2
+kind: GrafanaLink
+metadata:
+  name: logs
+baseURL: https://grafana.acme.com
+parameters:
+  - name: service
+panes:
+  eja:
+    datasource: someuid
+    queries:
+      - refId: A
+        rawSql: SELECT * FROM logs
+        customarg: somevalue
+        builderOptions:
+          table: logs
+          columns:
+            - name: timestamp
+    range:
+      from: now-1h
+      to: now
+`
+
+func Test_Validate(t *testing.T) {
+	type testCase struct {
+		name     string
+		data     string
+		expected []Error
+	}
+
+	cases := []testCase{
+		{
+			name: "valid-link",
+			data: testLink,
+		},
+		{
+			name: "link-errors",
+			data: `apiVersion: grafctl.foyle.io/v1
+kind: GrafanaLink
+metadata:
+  name: logs
+baseURL: grafana.acme.com
+parameters:
+  - name: level
+    type: enum
+panes:
+  eja:
+    queries:
+      - refId: A
+    range:
+      from: now-1x
+      to: now
+timeZone: utc
+`,
+			expected: []Error{
+				{File: "test.yaml", Line: 1, Column: 13, Message: "Unsupported apiVersion grafctl.foyle.io/v1; apiVersion must be one of [grafctl.foyle.io/v1alpha2 grafctl.foyle.io/v1alpha1]"},
+				{File: "test.yaml", Line: 16, Column: 1, Message: "Unknown field timeZone; did you mean timezone?"},
+				{File: "test.yaml", Line: 5, Column: 10, Message: "Invalid baseURL grafana.acme.com; baseURL must be an absolute URL e.g. https://grafana.acme.com"},
+				{File: "test.yaml", Line: 12, Column: 9, Message: "Query 0 of pane eja doesn't have a datasource; set datasource.uid on the query or datasource on the pane"},
+				{File: "test.yaml", Line: 14, Column: 13, Message: "Invalid time in range.from: unknown time unit 'x'"},
+				{File: "test.yaml", Line: 7, Column: 5, Message: "Parameter level is an enum but doesn't list its values"},
+			},
+		},
+		{
+			name: "parameter-paths",
+			data: `apiVersion: grafctl.foyle.io/v1alpha2
+kind: GrafanaLink
+metadata:
+  name: logs
+baseURL: https://grafana.acme.com
+parameters:
+  - name: table
+    path: builderOptions.table
+  - name: limit
+    type: int
+    path: builderOptions.limt
+  - name: level
+    path: builderOptions.level
+  - name: custom
+    path: customarg.nested
+  - name: uid
+    path: datasource.uid
+  - name: missing
+    path: rawSQL
+  - name: scalar
+    path: rawSql.text
+  - name: order
+    path: builderOptions.orderBy
+  - name: other
+    path: customarg.other
+panes:
+  eja:
+    datasource: someuid
+    queries:
+      - refId: A
+        rawSql: SELECT * FROM logs
+        builderOptions:
+          table: logs
+          orderBy:
+            - name: Timestamp
+              dir: DESC
+        customarg:
+          nested: somevalue
+    range:
+      from: now-1h
+      to: now
+`,
+			expected: []Error{
+				{File: "test.yaml", Line: 11, Column: 11, Message: "Parameter limit: Invalid path builderOptions.limt; limt isn't a field of builderOptions; did you mean limit?"},
+				{File: "test.yaml", Line: 13, Column: 11, Message: "Parameter level: Invalid path builderOptions.level; level isn't a field of builderOptions; the fields are [columns database filters limit meta mode orderBy queryType simplelogQuery table]"},
+				{File: "test.yaml", Line: 19, Column: 11, Message: "Parameter missing: Invalid path rawSQL; rawSQL isn't a field of the query; did you mean rawSql?"},
+				{File: "test.yaml", Line: 21, Column: 11, Message: "Parameter scalar: Invalid path rawSql.text; rawSql isn't an object"},
+				{File: "test.yaml", Line: 25, Column: 11, Message: "Parameter other: Invalid path customarg.other; other isn't a field of customarg; the fields are [nested]"},
+			},
+		},
+		{
+			name: "patch",
+			data: `template: logs
+params:
+  service: foyle
+query:
+  rawSql: SELECT 1
+  customarg: other
+range:
+  from: now-1h
+  to: now
+`,
+		},
+		{
+			name: "patch-errors",
+			data: `template: logs
+params:
+  service: foyle
+  level: error
+query:
+  rawSQL: SELECT 1
+  builderOptions:
+    tabel: logs
+range:
+  from: now-1h
+`,
+			expected: []Error{
+				{File: "test.yaml", Line: 10, Column: 3, Message: "range.to is required"},
+				{File: "test.yaml", Line: 3, Column: 3, Message: "Unknown parameter level; the template's parameters are [service]"},
+				{File: "test.yaml", Line: 6, Column: 3, Message: "Unknown field rawSQL; did you mean rawSql?"},
+				{File: "test.yaml", Line: 8, Column: 5, Message: "Unknown field tabel; did you mean table?"},
+			},
+		},
+		{
+			name: "overlay",
+			data: `bases:
+  - ../shared/logs.yaml
+query:
+  rawSql: SELECT 1
+`,
+		},
+		{
+			name: "url-options",
+			data: `template: logs
+params:
+  service: foyle
+kiosk: "on"
+theme: blue
+`,
+			expected: []Error{
+				{File: "test.yaml", Line: 4, Column: 8, Message: "Invalid kiosk mode on; kiosk must be one of [full tv off]"},
+				{File: "test.yaml", Line: 5, Column: 8, Message: "Invalid theme blue; theme must be one of [light dark]"},
+			},
+		},
+		{
+			name: "template-shape",
+			data: `template: logs
+params:
+  service: foyle
+query:
+  builderOptions:
+    limit: 10
+    columns:
+      - nmae: body
+    orderBy: timestamp
+`,
+			expected: []Error{
+				{File: "test.yaml", Line: 8, Column: 9, Message: "Unknown field nmae; did you mean name?"},
+				{File: "test.yaml", Line: 9, Column: 5, Message: "Unknown field orderBy; the fields are [columns database filters limit meta mode queryType simplelogQuery table]"},
+			},
+		},
+		{
+			name: "v1alpha1",
+			data: strings.Replace(testLink, "v1alpha2", "v1alpha1", 1),
+		},
+		{
+			name: "unknown-template",
+			data: `template: traces
+`,
+			expected: []Error{
+				{File: "test.yaml", Line: 1, Column: 11, Message: "There is no template or bundle named traces"},
+			},
+		},
+		{
+			name: "unknown-kind",
+			data: `kind: Dashboard
+---
+apiVersion: grafctl.foyle.io/v1alpha1
+kind: LinkBundle
+metadata:
+  name: bundle
+`,
+			expected: []Error{
+				{File: "test.yaml", Line: 1, Column: 7, Message: "Unknown kind Dashboard; kind must be one of [GrafanaLink LinkBundle PanePatch]"},
+				{File: "test.yaml", Line: 3, Column: 1, Message: "A LinkBundle must have at least one template"},
+			},
+		},
+	}
+
+	v := &Validator{}
+	if errs := v.Validate("link.yaml", []byte(testLink)); len(errs) > 0 {
+		t.Fatalf("Test link is invalid: %v", errs)
+	}
+	linkFile := filepath.Join(t.TempDir(), "link.yaml")
+	if err := os.WriteFile(linkFile, []byte(testLink), 0644); err != nil {
+		t.Fatalf("Failed to write link: %v", err)
+	}
+	if err := v.AddTemplates(linkFile); err != nil {
+		t.Fatalf("Failed to add template: %v", err)
+	}
+	if len(v.Templates) != 1 {
+		t.Fatalf("Expected 1 template but got %v", len(v.Templates))
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := v.Validate("test.yaml", []byte(c.data))
+			if d := cmp.Diff(c.expected, actual); d != "" {
+				t.Errorf("Unexpected diff:\n%v", d)
+			}
+		})
+	}
+}